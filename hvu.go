@@ -0,0 +1,242 @@
+// Package hvu upgrades Helm values files between chart versions from Go code.
+//
+// A Client classifies values against a chart's defaults, compares the defaults of two chart
+// versions and upgrades values to a new version. Values are passed as file contents and results
+// are returned as structured data; nothing is printed and no values file is written. Charts are
+// downloaded from the request's repository, or read from a helm.ChartSource given with
+// WithChartSource.
+//
+// Downloading a chart from a repository URL works like helm pull: the repository is added to the
+// user's Helm repositories.yaml if it isn't there yet, and its index and the chart are cached in
+// Helm's cache and temporary directories. Those changes are serialized within the process only,
+// so Helm commands run alongside can race with them. Progress is logged with the default slog
+// logger. Charts from a local directory or an oci:// registry, or from a source given with
+// WithChartSource, leave the Helm configuration untouched.
+//
+//	client := hvu.NewClient()
+//	result, err := client.Upgrade(ctx, &hvu.UpgradeRequest{
+//		Chart:       "postgresql",
+//		Repository:  "https://charts.bitnami.com/bitnami",
+//		FromVersion: "12.1.0",
+//		ToVersion:   "16.0.0",
+//		Values:      [][]byte{content},
+//	})
+package hvu
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/service"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// Client runs hvu operations. A Client is safe for concurrent use within a process; see the
+// package doc for the Helm configuration it changes when downloading charts
+type Client struct {
+	source helm.ChartSource
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithChartSource makes the client read every chart from source instead of the request's repository
+func WithChartSource(source helm.ChartSource) Option {
+	return func(c *Client) {
+		c.source = source
+	}
+}
+
+// NewClient returns a Client configured by opts
+func NewClient(opts ...Option) *Client {
+	c := &Client{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ReadValues reads the content of each values file from its reader, for requests whose values
+// are held in readers such as HTTP request bodies
+func ReadValues(readers ...io.Reader) ([][]byte, error) {
+	contents := make([][]byte, 0, len(readers))
+	for i, r := range readers {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read values file %d: %w", i, err)
+		}
+		contents = append(contents, content)
+	}
+	return contents, nil
+}
+
+// ClassifyRequest asks which values are customizations of a chart version's defaults
+type ClassifyRequest struct {
+	Chart      string
+	Repository string // Chart repository URL, OCI registry (oci://...) or local chart directory
+	Version    string
+	Values     [][]byte // Values files layered in order like repeated helm -f flags
+}
+
+// ClassifyResult holds the classification of every user value
+type ClassifyResult struct {
+	Classification *values.ClassificationResult
+	DefaultsCount  int
+	UserCount      int
+}
+
+// Classify classifies the request's values against the defaults of the chart version
+func (c *Client) Classify(ctx context.Context, req *ClassifyRequest) (*ClassifyResult, error) {
+	layers, err := parseValues(req.Values)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := service.Classify(ctx, &service.ClassifyInput{
+		Chart:      req.Chart,
+		Repository: req.Repository,
+		Source:     c.source,
+		Version:    req.Version,
+		Values:     layers,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClassifyResult{
+		Classification: output.Result,
+		DefaultsCount:  output.DefaultsCount,
+		UserCount:      output.UserCount,
+	}, nil
+}
+
+// DiffRequest asks how a chart's defaults changed between two versions
+type DiffRequest struct {
+	Chart       string
+	Repository  string // Chart repository URL, OCI registry (oci://...) or local chart directory
+	FromVersion string
+	ToVersion   string
+}
+
+// DiffResult holds the default values added, removed and changed by the target version.
+// Paths use "::" between keys, see values.PathToDisplayFormat
+type DiffResult struct {
+	Added     []values.ValueChange
+	Removed   []values.ValueChange
+	Changed   []values.ValueChange
+	Changelog string // Changelog shipped with the target chart, if any
+}
+
+// Diff compares the default values of two versions of a chart
+func (c *Client) Diff(ctx context.Context, req *DiffRequest) (*DiffResult, error) {
+	output, err := service.Diff(ctx, &service.DiffInput{
+		Chart:       req.Chart,
+		Repository:  req.Repository,
+		Source:      c.source,
+		FromVersion: req.FromVersion,
+		ToVersion:   req.ToVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &DiffResult{
+		Added:     output.Diff.Added,
+		Removed:   output.Diff.Removed,
+		Changed:   output.Diff.Changed,
+		Changelog: output.Changelog,
+	}, nil
+}
+
+// UpgradeRequest asks to upgrade values files from one chart version to another
+type UpgradeRequest struct {
+	Chart       string
+	Repository  string // Chart repository URL, OCI registry (oci://...) or local chart directory
+	FromVersion string
+	ToVersion   string
+	Values      [][]byte // Values files layered in order like repeated helm -f flags
+
+	UpgradeImages    bool                    // Upgrade custom image tags that still match the old default
+	RemovedKeys      values.RemovedKeyAction // How to write user keys removed in the target chart
+	PreserveComments bool                    // Patch each values file, keeping its comments, key order and anchors
+}
+
+// UpgradeResult holds the upgraded values and what the upgrade changed or needs reviewed
+type UpgradeResult struct {
+	Values            [][]byte // Upgraded content of each values file, in request order
+	Classification    *values.ClassificationResult
+	UpdatedDefaults   []values.ValueChange // Copied defaults moved to a new default value
+	Conflicts         []values.Conflict    // Customized keys whose default also changed
+	CustomImageTags   []values.ImageChange // Custom image tags, upgraded when ImageTagsUpgraded is set
+	ImageTagsUpgraded bool
+	SchemaViolations  []string                 // Target chart schema violations in the upgraded values
+	NoOpDeletions     []string                 // Null deletions dropped because the key no longer exists
+	SecretMigrations  []values.SecretMigration // Hardcoded credentials that can move to a new existingSecret key
+	Changelog         string                   // Changelog shipped with the target chart, if any
+}
+
+// Upgrade upgrades the request's values to the target chart version
+func (c *Client) Upgrade(ctx context.Context, req *UpgradeRequest) (*UpgradeResult, error) {
+	layers, err := parseValues(req.Values)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := service.Upgrade(ctx, &service.UpgradeInput{
+		Chart:            req.Chart,
+		Repository:       req.Repository,
+		Source:           c.source,
+		FromVersion:      req.FromVersion,
+		ToVersion:        req.ToVersion,
+		Values:           layers,
+		DryRun:           true,
+		UpgradeImages:    req.UpgradeImages,
+		RemovedKeys:      req.RemovedKeys,
+		PreserveComments: req.PreserveComments,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &UpgradeResult{
+		Classification:    output.Classification,
+		UpdatedDefaults:   output.UpdatedDefaults,
+		Conflicts:         output.Conflicts,
+		CustomImageTags:   output.CustomImageTags,
+		ImageTagsUpgraded: output.ImageTagsUpgraded,
+		SchemaViolations:  output.SchemaViolations,
+		SecretMigrations:  output.SecretMigrations,
+		NoOpDeletions:     output.NoOpDeletions,
+		Changelog:         output.Changelog,
+	}
+	if len(output.Layers) == 0 {
+		result.Values = [][]byte{[]byte(output.UpgradedYAML)}
+	}
+	for _, layer := range output.Layers {
+		result.Values = append(result.Values, []byte(layer.UpgradedYAML))
+	}
+	return result, nil
+}
+
+// parseValues parses the content of each values file into a layer named after its position
+func parseValues(contents [][]byte) ([]values.Layer, error) {
+	if len(contents) == 0 {
+		return nil, fmt.Errorf("at least one values file is required")
+	}
+
+	layers := make([]values.Layer, 0, len(contents))
+	for i, content := range contents {
+		parsed, err := values.ParseYAML(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse values file %d: %w", i, err)
+		}
+		layers = append(layers, values.Layer{
+			Source:  fmt.Sprintf("values[%d]", i),
+			Values:  parsed,
+			Content: string(content),
+		})
+	}
+	return layers, nil
+}
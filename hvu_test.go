@@ -0,0 +1,141 @@
+package hvu
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+)
+
+// testClient returns a client reading two versions of an app chart from memory
+func testClient(t *testing.T) *Client {
+	t.Helper()
+	source := helm.NewMemorySource()
+	if err := source.AddValues("app", "1.0.0", "# Number of replicas\nreplicaCount: 1\nimage:\n  tag: \"1.0\"\nlegacy: true\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	if err := source.AddValues("app", "2.0.0", "# Number of replicas\nreplicaCount: 1\nimage:\n  tag: \"2.0\"\nmetrics:\n  enabled: false\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	return NewClient(WithChartSource(source))
+}
+
+func TestClient_Classify(t *testing.T) {
+	client := testClient(t)
+
+	result, err := client.Classify(context.Background(), &ClassifyRequest{
+		Chart:   "app",
+		Version: "1.0.0",
+		Values:  [][]byte{[]byte("replicaCount: 3\nimage:\n  tag: \"1.0\"\n")},
+	})
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if result.Classification.Customized != 1 || result.Classification.CopiedDefault != 1 {
+		t.Errorf("unexpected classification %+v", result.Classification)
+	}
+
+	if _, err := client.Classify(context.Background(), &ClassifyRequest{Chart: "app", Version: "1.0.0"}); err == nil {
+		t.Error("expected error without values")
+	}
+	if _, err := client.Classify(context.Background(), &ClassifyRequest{
+		Chart:   "app",
+		Version: "1.0.0",
+		Values:  [][]byte{[]byte("key: [unclosed\n")},
+	}); err == nil {
+		t.Error("expected error for invalid values")
+	}
+}
+
+func TestClient_Diff(t *testing.T) {
+	result, err := testClient(t).Diff(context.Background(), &DiffRequest{Chart: "app", FromVersion: "1.0.0", ToVersion: "2.0.0"})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if len(result.Added) != 1 || len(result.Removed) != 1 || len(result.Changed) != 1 {
+		t.Errorf("unexpected diff added=%+v removed=%+v changed=%+v", result.Added, result.Removed, result.Changed)
+	}
+}
+
+func TestClient_Upgrade(t *testing.T) {
+	client := testClient(t)
+
+	result, err := client.Upgrade(context.Background(), &UpgradeRequest{
+		Chart:       "app",
+		FromVersion: "1.0.0",
+		ToVersion:   "2.0.0",
+		Values:      [][]byte{[]byte("replicaCount: 3\nimage:\n  tag: \"1.0\"\n")},
+	})
+	if err != nil {
+		t.Fatalf("Upgrade() error = %v", err)
+	}
+	if len(result.Values) != 1 {
+		t.Fatalf("expected one upgraded values file, got %d", len(result.Values))
+	}
+	for _, want := range []string{"# Number of replicas", "replicaCount: 3", "tag: \"2.0\""} {
+		if !strings.Contains(string(result.Values[0]), want) {
+			t.Errorf("expected upgraded values to contain %q, got:\n%s", want, result.Values[0])
+		}
+	}
+
+	// Layered files are upgraded one by one, and later layers only keep the keys they set
+	result, err = client.Upgrade(context.Background(), &UpgradeRequest{
+		Chart:       "app",
+		FromVersion: "1.0.0",
+		ToVersion:   "2.0.0",
+		Values: [][]byte{
+			[]byte("replicaCount: 1\n"),
+			[]byte("# production\nreplicaCount: 5\n"),
+		},
+		PreserveComments: true,
+	})
+	if err != nil {
+		t.Fatalf("Upgrade() error = %v", err)
+	}
+	if len(result.Values) != 2 {
+		t.Fatalf("expected two upgraded values files, got %d", len(result.Values))
+	}
+	if got := string(result.Values[1]); got != "# production\nreplicaCount: 5\n" {
+		t.Errorf("expected the override file to be kept as is, got:\n%s", got)
+	}
+}
+
+func TestClient_Concurrent(t *testing.T) {
+	client := testClient(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Upgrade(context.Background(), &UpgradeRequest{
+				Chart:       "app",
+				FromVersion: "1.0.0",
+				ToVersion:   "2.0.0",
+				Values:      [][]byte{[]byte("replicaCount: 3\n")},
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Upgrade() error = %v", err)
+		}
+	}
+}
+
+func TestReadValues(t *testing.T) {
+	contents, err := ReadValues(strings.NewReader("a: 1\n"), strings.NewReader("b: 2\n"))
+	if err != nil {
+		t.Fatalf("ReadValues() error = %v", err)
+	}
+	if len(contents) != 2 || string(contents[1]) != "b: 2\n" {
+		t.Errorf("unexpected contents %q", contents)
+	}
+}
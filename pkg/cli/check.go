@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/service"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// Exit codes returned by the check command, one per kind of problem.
+// When several checks fail, the first one in this list determines the exit code
+const (
+	ExitUnknownKeys      = 2
+	ExitRemovedKeys      = 3
+	ExitConflicts        = 4
+	ExitSchemaViolations = 5
+	ExitOutputDiffers    = 6
+	ExitReviewRequired   = 7
+)
+
+func CheckCmd() *cobra.Command {
+	var (
+		chart       string
+		repository  string
+		fromVersion string
+		toVersion   string
+		valuesFiles []string
+		setValues   helm.SetValues
+	)
+
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check whether a values file is up to date with a chart version",
+		Long: `Check a values file against a chart version without writing anything.
+
+The command runs the same analysis as upgrade and exits non-zero when the values
+file needs attention, which makes it suitable for gating CI pipelines.
+
+Exit codes:
+  0 - values file is up to date
+  1 - the check itself failed (e.g. chart could not be fetched)
+  2 - unknown keys present
+  3 - keys removed in the target chart present
+  4 - customizations conflict with changed chart defaults
+  5 - upgraded values violate the chart's values.schema.json
+  6 - upgraded output differs from the values file
+  7 - keys marked require-review by a policy have changed defaults
+
+When several checks fail, the lowest of codes 2-7 is returned.
+
+Examples:
+  # Is this values file up to date with chart 16.0.0?
+  hvu check --chart postgresql \
+    --repo https://charts.bitnami.com/bitnami \
+    --from 16.0.0 --values ./my-values.yaml
+
+  # Would upgrading from 12.1.0 to 16.0.0 need manual review?
+  hvu check --chart postgresql \
+    --repo https://charts.bitnami.com/bitnami \
+    --from 12.1.0 --to 16.0.0 --values ./my-values.yaml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			slog.Info("checking values file",
+				"chart", chart,
+				"repository", repository,
+				"fromVersion", fromVersion,
+				"toVersion", toVersion,
+				"valuesFiles", valuesFiles,
+			)
+
+			policy, err := loadPolicy()
+			if err != nil {
+				return err
+			}
+			redactor, err := newRedactor()
+			if err != nil {
+				return err
+			}
+
+			output, err := service.Check(cmd.Context(), &service.CheckInput{
+				Chart:       chart,
+				Repository:  repository,
+				FromVersion: fromVersion,
+				ToVersion:   toVersion,
+				ValuesFiles: valuesFiles,
+				SetValues:   setValues,
+				Stdin:       cmd.InOrStdin(),
+				Policy:      policy,
+			})
+			if err != nil {
+				return err
+			}
+
+			printCheckResults(output.Redacted(redactor))
+			return checkExitError(output)
+		},
+	}
+
+	cmd.Flags().StringVar(&chart, "chart", "", "chart name")
+	cmd.Flags().StringVar(&repository, "repo", "", "chart repository URL, OCI registry (oci://...), local chart directory or repository name")
+
+	cmd.Flags().StringVar(&fromVersion, "from", "", "chart version the values file was written for")
+	cmd.Flags().StringVar(&toVersion, "to", "", "chart version to check against (default: --from)")
+
+	cmd.Flags().StringArrayVarP(&valuesFiles, "values", "f", nil, "values file to check, repeat to layer files (\"-\" for stdin)")
+	addSetFlags(cmd, &setValues)
+
+	_ = cmd.MarkFlagRequired("chart")
+	_ = cmd.MarkFlagRequired("repo")
+	_ = cmd.MarkFlagRequired("from")
+	_ = cmd.MarkFlagRequired("values")
+
+	return cmd
+}
+
+// checkExitError maps failed checks to an ExitError, or nil if every check passed
+func checkExitError(output *service.CheckOutput) error {
+	switch {
+	case output.Classification.Unknown > 0:
+		return &ExitError{Code: ExitUnknownKeys}
+	case output.Classification.Removed > 0:
+		return &ExitError{Code: ExitRemovedKeys}
+	case len(output.Conflicts) > 0:
+		return &ExitError{Code: ExitConflicts}
+	case len(output.SchemaViolations) > 0:
+		return &ExitError{Code: ExitSchemaViolations}
+	case output.Policy != nil && len(output.Policy.ReviewRequired) > 0:
+		// Checked before drift: moving a flagged key to its new default is what needs review
+		return &ExitError{Code: ExitReviewRequired}
+	case !output.UpToDate:
+		return &ExitError{Code: ExitOutputDiffers}
+	}
+	return nil
+}
+
+func printCheckResults(output *service.CheckOutput) {
+	result := output.Classification
+
+	fmt.Println("Check Results")
+	fmt.Println("=============")
+	fmt.Println()
+
+	if output.Passed() {
+		fmt.Println("Values file is up to date.")
+		return
+	}
+
+	if result.Unknown > 0 {
+		fmt.Printf("Unknown keys (%d):\n", result.Unknown)
+		for _, entry := range result.Entries {
+			if entry.Classification == values.Unknown {
+				fmt.Printf("  %s\n", values.PathToDisplayFormat(entry.Path))
+			}
+		}
+		fmt.Println()
+	}
+
+	if result.Removed > 0 {
+		fmt.Printf("Keys removed in target chart (%d):\n", result.Removed)
+		for _, entry := range result.Entries {
+			if entry.Classification == values.RemovedInTarget {
+				fmt.Printf("  %s\n", values.PathToDisplayFormat(entry.Path))
+			}
+		}
+		fmt.Println()
+	}
+
+	if len(output.Conflicts) > 0 {
+		fmt.Printf("Conflicts (%d):\n", len(output.Conflicts))
+		for _, conflict := range output.Conflicts {
+			fmt.Printf("  %s\n", values.PathToDisplayFormat(conflict.Path))
+			fmt.Printf("    user:        %v\n", conflict.UserValue)
+			fmt.Printf("    old default: %v\n", conflict.OldDefault)
+			fmt.Printf("    new default: %v\n", conflict.NewDefault)
+		}
+		fmt.Println()
+	}
+
+	if len(output.SchemaViolations) > 0 {
+		fmt.Printf("Schema violations (%d):\n", len(output.SchemaViolations))
+		for _, violation := range output.SchemaViolations {
+			fmt.Printf("  %s\n", violation)
+		}
+		fmt.Println()
+	}
+
+	if !output.UpToDate {
+		fmt.Println("Upgraded output differs from the values file.")
+		fmt.Println()
+	}
+
+	if output.Policy != nil && len(output.Policy.ReviewRequired) > 0 {
+		fmt.Printf("Keys requiring review (%d):\n", len(output.Policy.ReviewRequired))
+		for _, change := range output.Policy.ReviewRequired {
+			fmt.Printf("  %s\n", values.PathToDisplayFormat(change.Path))
+			fmt.Printf("    old default: %v\n", change.OldValue)
+			fmt.Printf("    new default: %v\n", change.NewValue)
+		}
+	}
+}
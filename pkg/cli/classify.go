@@ -6,16 +6,18 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/itsvictorfy/hvu/pkg/helm"
 	"github.com/itsvictorfy/hvu/pkg/service"
 	"github.com/itsvictorfy/hvu/pkg/values"
 )
 
 func ClassifyCmd() *cobra.Command {
 	var (
-		chart      string
-		repository string
-		version    string
-		valuesFile string
+		chart       string
+		repository  string
+		version     string
+		valuesFiles []string
+		setValues   helm.SetValues
 	)
 
 	cmd := &cobra.Command{
@@ -31,40 +33,59 @@ Classification categories:
   CUSTOMIZED     - Value differs from chart default (intentional change)
   COPIED_DEFAULT - Value matches chart default (can be updated)
   UNKNOWN        - Not in chart defaults (may be obsolete or custom)
+  DELETION       - Set to null to delete a chart default
 
 Examples:
   # Classify values against chart version
   hvu classify --chart postgresql \
     --repo https://charts.bitnami.com/bitnami \
-    --version 12.1.0 --values ./my-values.yaml`,
+    --version 12.1.0 --values ./my-values.yaml
+
+  # Classify the combined result of layered values files
+  hvu classify --chart postgresql \
+    --repo https://charts.bitnami.com/bitnami \
+    --version 12.1.0 -f base.yaml -f prod.yaml`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			slog.Info("classifying values",
 				"chart", chart,
 				"repository", repository,
 				"version", version,
-				"valuesFile", valuesFile,
+				"valuesFiles", valuesFiles,
 			)
 
-			output, err := service.Classify(&service.ClassifyInput{
-				Chart:      chart,
-				Repository: repository,
-				Version:    version,
-				ValuesFile: valuesFile,
+			policy, err := loadPolicy()
+			if err != nil {
+				return err
+			}
+			redactor, err := newRedactor()
+			if err != nil {
+				return err
+			}
+
+			output, err := service.Classify(cmd.Context(), &service.ClassifyInput{
+				Chart:       chart,
+				Repository:  repository,
+				Version:     version,
+				ValuesFiles: valuesFiles,
+				SetValues:   setValues,
+				Stdin:       cmd.InOrStdin(),
+				Policy:      policy,
 			})
 			if err != nil {
 				return err
 			}
 
-			printClassifyResults(output)
+			printClassifyResults(output.Redacted(redactor), len(valuesFiles) > 1 || !setValues.Empty())
 			return nil
 		},
 	}
 
 	cmd.Flags().StringVar(&chart, "chart", "", "chart name")
-	cmd.Flags().StringVar(&repository, "repo", "", "chart repository URL")
+	cmd.Flags().StringVar(&repository, "repo", "", "chart repository URL, OCI registry (oci://...), local chart directory or repository name")
 	cmd.Flags().StringVar(&version, "version", "", "chart version to compare against")
 
-	cmd.Flags().StringVarP(&valuesFile, "values", "f", "", "values file to classify")
+	cmd.Flags().StringArrayVarP(&valuesFiles, "values", "f", nil, "values file to classify, repeat to layer files (\"-\" for stdin)")
+	addSetFlags(cmd, &setValues)
 
 	_ = cmd.MarkFlagRequired("chart")
 	_ = cmd.MarkFlagRequired("repo")
@@ -74,7 +95,7 @@ Examples:
 	return cmd
 }
 
-func printClassifyResults(output *service.ClassifyOutput) {
+func printClassifyResults(output *service.ClassifyOutput, layered bool) {
 	result := output.Result
 
 	fmt.Println("Classification Results")
@@ -85,6 +106,10 @@ func printClassifyResults(output *service.ClassifyOutput) {
 	fmt.Printf("  CUSTOMIZED:     %d keys (user modifications)\n", result.Customized)
 	fmt.Printf("  COPIED_DEFAULT: %d keys (match chart defaults)\n", result.CopiedDefault)
 	fmt.Printf("  UNKNOWN:        %d keys (not in chart defaults)\n", result.Unknown)
+	fmt.Printf("  DELETION:       %d keys (set to null to delete a default)\n", result.Deletions)
+	if result.Ignored > 0 {
+		fmt.Printf("  IGNORED:        %d keys (excluded by policy)\n", result.Ignored)
+	}
 	fmt.Printf("  Total:          %d keys\n", result.Total)
 	fmt.Println()
 
@@ -93,7 +118,7 @@ func printClassifyResults(output *service.ClassifyOutput) {
 		fmt.Println("--------------------------------------------")
 		for _, entry := range result.Entries {
 			if entry.Classification == values.Customized {
-				fmt.Printf("  %s\n", values.PathToDisplayFormat(entry.Path))
+				fmt.Printf("  %s%s\n", values.PathToDisplayFormat(entry.Path), sourceSuffix(entry, layered))
 				fmt.Printf("    user:    %v\n", entry.UserValue)
 				fmt.Printf("    default: %v\n", entry.DefaultValue)
 			}
@@ -101,14 +126,33 @@ func printClassifyResults(output *service.ClassifyOutput) {
 		fmt.Println()
 	}
 
+	if result.Deletions > 0 {
+		fmt.Println("DELETION (null deletes the chart default):")
+		fmt.Println("-----------------------------------------")
+		for _, entry := range result.Entries {
+			if entry.Classification == values.Deletion {
+				fmt.Printf("  %s%s\n", values.PathToDisplayFormat(entry.Path), sourceSuffix(entry, layered))
+			}
+		}
+		fmt.Println()
+	}
+
 	if result.Unknown > 0 {
 		fmt.Println("UNKNOWN (not in chart defaults - may be obsolete):")
 		fmt.Println("--------------------------------------------------")
 		for _, entry := range result.Entries {
 			if entry.Classification == values.Unknown {
-				fmt.Printf("  %s: %v\n", values.PathToDisplayFormat(entry.Path), entry.UserValue)
+				fmt.Printf("  %s: %v%s\n", values.PathToDisplayFormat(entry.Path), entry.UserValue, sourceSuffix(entry, layered))
 			}
 		}
 		fmt.Println()
 	}
 }
+
+// sourceSuffix names the file (or --set) that set a key when several layers are combined
+func sourceSuffix(entry values.ClassifiedValue, layered bool) string {
+	if !layered || entry.Source == "" {
+		return ""
+	}
+	return " (from " + entry.Source + ")"
+}
@@ -2,10 +2,17 @@ package cli
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"strings"
 	"testing"
 
 	"github.com/spf13/cobra"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/service"
+	"github.com/itsvictorfy/hvu/pkg/values"
 )
 
 func TestRootCmd_Exists(t *testing.T) {
@@ -21,7 +28,7 @@ func TestRootCmd_Exists(t *testing.T) {
 func TestRootCmd_HasSubcommands(t *testing.T) {
 	commands := rootCmd.Commands()
 
-	expectedCommands := []string{"upgrade", "classify", "version"}
+	expectedCommands := []string{"upgrade", "classify", "check", "version"}
 	foundCommands := make(map[string]bool)
 
 	for _, cmd := range commands {
@@ -66,7 +73,7 @@ func TestUpgradeCmd_RequiredFlags(t *testing.T) {
 func TestUpgradeCmd_OptionalFlags(t *testing.T) {
 	cmd := UpgradeCmd()
 
-	optionalFlags := []string{"output", "dry-run"}
+	optionalFlags := []string{"output", "dry-run", "report"}
 
 	for _, flag := range optionalFlags {
 		if cmd.Flags().Lookup(flag) == nil {
@@ -194,6 +201,22 @@ func TestClassifyCmd_ValuesShorthand(t *testing.T) {
 	}
 }
 
+func TestValuesFlag_Repeatable(t *testing.T) {
+	for _, cmd := range []*cobra.Command{UpgradeCmd(), ClassifyCmd(), CheckCmd()} {
+		if err := cmd.ParseFlags([]string{"-f", "base.yaml", "-f", "prod,eu.yaml"}); err != nil {
+			t.Fatalf("%s: failed to parse flags: %v", cmd.Name(), err)
+		}
+
+		files, err := cmd.Flags().GetStringArray("values")
+		if err != nil {
+			t.Fatalf("%s: %v", cmd.Name(), err)
+		}
+		if len(files) != 2 || files[0] != "base.yaml" || files[1] != "prod,eu.yaml" {
+			t.Errorf("%s: expected both values files in order, got %v", cmd.Name(), files)
+		}
+	}
+}
+
 func TestUpgradeCmd_ValuesShorthand(t *testing.T) {
 	cmd := UpgradeCmd()
 
@@ -227,3 +250,420 @@ func TestRootCmd_SilenceErrors(t *testing.T) {
 		t.Error("expected SilenceErrors to be true")
 	}
 }
+
+func TestCheckCmd_RequiredFlags(t *testing.T) {
+	cmd := CheckCmd()
+
+	for _, flag := range []string{"chart", "repo", "from", "to", "values"} {
+		if cmd.Flags().Lookup(flag) == nil {
+			t.Errorf("expected flag %q to exist on check command", flag)
+		}
+	}
+
+	cmd.SetArgs([]string{})
+	var buf bytes.Buffer
+	cmd.SetOut(&buf)
+	cmd.SetErr(&buf)
+
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected error when required flags are missing")
+	}
+}
+
+func TestCheck_ReviewRequiredExitCode(t *testing.T) {
+	source := helm.NewMemorySource()
+	if err := source.AddValues("app", "1.0.0", "replicaCount: 1\nresources:\n  cpu: 100m\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	if err := source.AddValues("app", "2.0.0", "replicaCount: 1\nresources:\n  cpu: 200m\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	policy, err := values.ParsePolicy([]byte("policies:\n  - path: resources.cpu\n    action: require-review\n"))
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+
+	for _, content := range []string{"resources:\n  cpu: 500m\n", "resources:\n  cpu: 100m\n"} {
+		userValues, err := values.ParseYAML(content)
+		if err != nil {
+			t.Fatalf("ParseYAML() error = %v", err)
+		}
+		output, err := service.Check(context.Background(), &service.CheckInput{
+			Chart:       "app",
+			Source:      source,
+			FromVersion: "1.0.0",
+			ToVersion:   "2.0.0",
+			Values:      []values.Layer{{Source: "values.yaml", Values: userValues, Content: content}},
+			Policy:      policy,
+		})
+		if err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+
+		var exitErr *ExitError
+		if err := checkExitError(output); !errors.As(err, &exitErr) || exitErr.Code != ExitReviewRequired {
+			t.Errorf("expected exit code %d for %q, got %v", ExitReviewRequired, content, err)
+		}
+	}
+}
+
+func TestCheckExitError(t *testing.T) {
+	clean := func() *service.CheckOutput {
+		return &service.CheckOutput{Classification: &values.ClassificationResult{}, UpToDate: true}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(o *service.CheckOutput)
+		want   int
+	}{
+		{"passed", func(o *service.CheckOutput) {}, 0},
+		{"unknown keys", func(o *service.CheckOutput) { o.Classification.Unknown = 1 }, ExitUnknownKeys},
+		{"removed keys", func(o *service.CheckOutput) { o.Classification.Removed = 1 }, ExitRemovedKeys},
+		{"conflicts", func(o *service.CheckOutput) { o.Conflicts = []values.Conflict{{Path: "a"}} }, ExitConflicts},
+		{"schema violations", func(o *service.CheckOutput) { o.SchemaViolations = []string{"bad"} }, ExitSchemaViolations},
+		{"output differs", func(o *service.CheckOutput) { o.UpToDate = false }, ExitOutputDiffers},
+		{"review required", func(o *service.CheckOutput) {
+			o.Policy = &values.PolicyReport{ReviewRequired: []values.ValueChange{{Path: "a"}}}
+		}, ExitReviewRequired},
+		{"first failure wins", func(o *service.CheckOutput) {
+			o.UpToDate = false
+			o.Classification.Removed = 2
+		}, ExitRemovedKeys},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := clean()
+			tt.modify(output)
+
+			err := checkExitError(output)
+			if tt.want == 0 {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var exitErr *ExitError
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("expected ExitError, got %v", err)
+			}
+			if exitErr.Code != tt.want {
+				t.Errorf("expected exit code %d, got %d", tt.want, exitErr.Code)
+			}
+		})
+	}
+}
+
+func TestUpgradeCmd_OutputModeFlags(t *testing.T) {
+	cmd := UpgradeCmd()
+
+	for _, flag := range []string{"in-place", "backup", "output-file"} {
+		if cmd.Flags().Lookup(flag) == nil {
+			t.Errorf("expected flag %q to exist on upgrade command", flag)
+		}
+	}
+
+	cmd.SetArgs([]string{
+		"--chart", "c", "--repo", "r", "--from", "1", "--to", "2", "--values", "v.yaml",
+		"--in-place", "--output-file", "out.yaml",
+	})
+	var buf bytes.Buffer
+	cmd.SetOut(&buf)
+	cmd.SetErr(&buf)
+
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "in-place") {
+		t.Errorf("expected mutually exclusive flag error, got %v", err)
+	}
+}
+
+func TestUpgradeCmd_ValuesSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "neither values nor release",
+			args:    []string{"--chart", "c", "--repo", "r", "--from", "1", "--to", "2"},
+			wantErr: "one of --values or --release is required",
+		},
+		{
+			name:    "values without from",
+			args:    []string{"--chart", "c", "--repo", "r", "--to", "2", "--values", "v.yaml"},
+			wantErr: "--from is required",
+		},
+		{
+			name:    "values and release",
+			args:    []string{"--chart", "c", "--repo", "r", "--to", "2", "--values", "v.yaml", "--release", "db"},
+			wantErr: "release",
+		},
+		{
+			name:    "git and patch",
+			args:    []string{"--chart", "c", "--repo", "r", "--from", "1", "--to", "2", "--values", "v.yaml", "--git", "--patch", "out.diff"},
+			wantErr: "[git patch]",
+		},
+		{
+			name:    "git and release",
+			args:    []string{"--chart", "c", "--repo", "r", "--to", "2", "--release", "db", "--git"},
+			wantErr: "release",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := UpgradeCmd()
+			cmd.SetArgs(tt.args)
+			var buf bytes.Buffer
+			cmd.SetOut(&buf)
+			cmd.SetErr(&buf)
+
+			err := cmd.Execute()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	cmd := UpgradeCmd()
+	for _, flag := range []string{"release", "namespace"} {
+		if cmd.Flags().Lookup(flag) == nil {
+			t.Errorf("expected flag %q to exist on upgrade command", flag)
+		}
+	}
+}
+
+func TestSetFlags(t *testing.T) {
+	for _, cmd := range []*cobra.Command{UpgradeCmd(), ClassifyCmd(), CheckCmd()} {
+		for _, flag := range []string{"set", "set-string", "set-file"} {
+			if cmd.Flags().Lookup(flag) == nil {
+				t.Errorf("expected flag %q to exist on %s command", flag, cmd.Name())
+			}
+		}
+	}
+}
+
+func TestRenamedHint(t *testing.T) {
+	if hint := renamedHint(nil); hint != "" {
+		t.Errorf("expected no hint without candidates, got %q", hint)
+	}
+	hint := renamedHint([]string{"primary::persistence::size", "readReplicas::persistence::size"})
+	if hint != " (renamed to primary.persistence.size or readReplicas.persistence.size?)" {
+		t.Errorf("unexpected hint %q", hint)
+	}
+}
+
+func TestPrintUpgradeResults(t *testing.T) {
+	output := &service.UpgradeOutput{
+		OutputPath: "values-upgraded.yaml",
+		Classification: &values.ClassificationResult{
+			Customized:    1,
+			CopiedDefault: 3,
+		},
+		UpdatedDefaults: []values.ValueChange{{Path: "image::tag", OldValue: "1.0", NewValue: "2.0"}},
+		Policy: &values.PolicyReport{
+			Pinned: []values.ValueChange{{Path: "persistence::size", OldValue: "8Gi", NewValue: "10Gi"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	printUpgradeResults(&buf, output, false, "")
+
+	for _, want := range []string{
+		"1 customizations preserved",
+		"1 defaults updated to new version",
+		"1 defaults pinned by policy",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestPrintScanResults(t *testing.T) {
+	output := &service.ScanOutput{
+		Releases: []service.ScanResult{
+			{
+				File: "apps/db.yaml", Kind: "HelmRelease", Name: "db", Namespace: "data", Chart: "postgresql",
+				FromVersion: "12.1.0", ToVersion: "16.0.0", Upgraded: true,
+				Classification: &values.ClassificationResult{Customized: 3},
+			},
+			{
+				File: "apps/cache.yaml", Kind: "Application", Name: "cache", Chart: "redis",
+				FromVersion: "19.0.0", Err: errors.New("OCI chart repositories are not supported"),
+			},
+		},
+		ChangedFiles: []string{"apps/db.yaml"},
+	}
+
+	var buf bytes.Buffer
+	printScanResults(&buf, output, false)
+
+	for _, want := range []string{
+		"data/db",
+		"12.1.0 -> 16.0.0",
+		"upgraded",
+		"error: OCI chart repositories are not supported",
+		"1 manifests rewritten",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	printScanResults(&buf, &service.ScanOutput{}, false)
+	if !strings.Contains(buf.String(), "No Helm releases found") {
+		t.Errorf("unexpected output for no releases: %s", buf.String())
+	}
+}
+
+func TestPrintHelmfileResults(t *testing.T) {
+	output := &service.HelmfileOutput{
+		Environment: "production",
+		Releases: []service.HelmfileResult{
+			{
+				Name: "db", Namespace: "data", Chart: "postgresql", FromVersion: "12.1.0", ToVersion: "16.0.0",
+				ValuesFiles: []string{"values/db.yaml", "values/db-production.yaml"}, Upgraded: true,
+				Skipped:        []string{"inline values (only values files are upgraded)"},
+				Classification: &values.ClassificationResult{Customized: 3},
+			},
+			{Name: "local", Chart: "./charts/local", FromVersion: "0.1.0", Err: errors.New("chart is not from a repository declared in the helmfile")},
+		},
+		Changed: true,
+	}
+
+	var buf bytes.Buffer
+	printHelmfileResults(&buf, output, true)
+
+	for _, want := range []string{
+		"data/db",
+		"12.1.0 -> 16.0.0",
+		"would upgrade",
+		"error: chart is not from a repository declared in the helmfile",
+		"db: inline values",
+		"Helmfile would be updated for environment production (dry run)",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	printHelmfileResults(&buf, &service.HelmfileOutput{}, false)
+	if !strings.Contains(buf.String(), "No matching releases found") {
+		t.Errorf("unexpected output for no releases: %s", buf.String())
+	}
+}
+
+func outdatedOutput() *service.OutdatedOutput {
+	return &service.OutdatedOutput{
+		Releases: []service.OutdatedResult{
+			{
+				File: "apps/db.yaml", Kind: "HelmRelease", Name: "db", Namespace: "data", Chart: "postgresql", Version: "12.1.0",
+				Newer:           &helm.NewerVersions{Patch: "12.1.9", Major: "16.0.0"},
+				Classification:  &values.ClassificationResult{Customized: 4},
+				PinnedImageTags: []string{"image::tag", "metrics::image::tag"},
+			},
+			{File: "platform/Chart.yaml", Kind: service.KindDependency, Name: "cache", Chart: "redis", Version: "19.0.0", Err: errors.New("OCI chart repositories are not supported")},
+		},
+	}
+}
+
+func TestPrintOutdatedResults(t *testing.T) {
+	var buf bytes.Buffer
+	printOutdatedResults(&buf, outdatedOutput())
+
+	for _, want := range []string{
+		"data/db",
+		"12.1.9",
+		"16.0.0",
+		"image.tag,metrics.image.tag",
+		"Could not be checked:",
+		"cache (platform/Chart.yaml): OCI chart repositories are not supported",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestPrintOutdatedJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printOutdatedJSON(&buf, outdatedOutput()); err != nil {
+		t.Fatalf("printOutdatedJSON() error = %v", err)
+	}
+
+	var releases []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &releases); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if len(releases) != 2 {
+		t.Fatalf("expected 2 releases, got %d", len(releases))
+	}
+	if releases[0]["latestPatch"] != "12.1.9" || releases[0]["customized"] != float64(4) {
+		t.Errorf("unexpected first release %v", releases[0])
+	}
+	if _, ok := releases[0]["latestMinor"]; ok {
+		t.Error("expected an empty latestMinor to be omitted")
+	}
+	if releases[1]["error"] != "OCI chart repositories are not supported" {
+		t.Errorf("unexpected second release %v", releases[1])
+	}
+}
+
+func TestPrintDependencyResults(t *testing.T) {
+	output := &service.DependencyOutput{
+		ChartFile:  "charts/platform/Chart.yaml",
+		ValuesFile: "charts/platform/values.yaml",
+		Key:        "db",
+		Chart:      "postgresql",
+		ToVersion:  "16.0.0",
+		Upgrade: &service.UpgradeOutput{
+			Classification: &values.ClassificationResult{Customized: 2, CopiedDefault: 1},
+			FromVersion:    "12.1.0",
+			OutputPath:     "charts/platform/values.yaml",
+		},
+	}
+
+	var buf bytes.Buffer
+	printDependencyResults(&buf, output, false)
+
+	for _, want := range []string{
+		"Dependency db (postgresql): 12.1.0 -> 16.0.0 in charts/platform/Chart.yaml",
+		"Output: charts/platform/values.yaml",
+		"2 customizations preserved",
+		"helm dependency update",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestApplyTimeout(t *testing.T) {
+	useConfig(t, "timeout: 1m\n")
+
+	tests := []struct {
+		name         string
+		cmd          *cobra.Command
+		wantDeadline bool
+	}{
+		{name: "upgrade", cmd: UpgradeCmd(), wantDeadline: true},
+		{name: "serve", cmd: ServeCmd(), wantDeadline: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cmd.SetContext(context.Background())
+			applyTimeout(tt.cmd)
+			defer cancelTimeout()
+
+			if _, ok := tt.cmd.Context().Deadline(); ok != tt.wantDeadline {
+				t.Errorf("context has deadline = %v, want %v", ok, tt.wantDeadline)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+)
+
+const (
+	// configFileName is the project config file looked for in the working directory and its parents
+	configFileName = ".hvu.yaml"
+
+	// userConfigFile is the user config file under the XDG config directory
+	userConfigFile = "hvu/config.yaml"
+
+	// envPrefix prefixes the environment variables that override config and flag defaults
+	envPrefix = "HVU"
+
+	// mutuallyExclusiveAnnotation is where cobra records a flag's MarkFlagsMutuallyExclusive groups
+	mutuallyExclusiveAnnotation = "cobra_annotation_mutually_exclusive"
+)
+
+// readConfig reads HVU_* environment variables and the --config file, or the config file found
+// by findConfigFile
+func readConfig() error {
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
+	viper.AutomaticEnv()
+
+	path := viper.GetString("config")
+	if path == "" {
+		found, err := findConfigFile()
+		if err != nil || found == "" {
+			return err
+		}
+		path = found
+	}
+
+	viper.SetConfigFile(path)
+	viper.SetConfigType("yaml")
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyConfig applies the config and environment to the command: they set the flags the user
+// didn't pass and the chart cache directory, and name the repositories --repo can refer to
+func applyConfig(cmd *cobra.Command) error {
+	if path := viper.ConfigFileUsed(); path != "" {
+		slog.Debug("using config file", "path", path)
+	}
+	if dir := viper.GetString("cache-dir"); dir != "" {
+		if rest, found := strings.CutPrefix(dir, "~/"); found {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return fmt.Errorf("failed to expand cache-dir: %w", err)
+			}
+			dir = filepath.Join(home, rest)
+		}
+		helm.SetCacheDir(dir)
+	}
+	if err := applyFlagDefaults(cmd); err != nil {
+		return err
+	}
+	return resolveRepoAlias(cmd)
+}
+
+// resolveRepoAlias replaces a --repo that names a repository, rather than giving a URL or a
+// local chart directory, with the URL of that repository in the config's repositories or in
+// Helm's repositories.yaml
+func resolveRepoAlias(cmd *cobra.Command) error {
+	flag := cmd.Flags().Lookup("repo")
+	if flag == nil {
+		return nil
+	}
+	name := flag.Value.String()
+	if name == "" || strings.ContainsAny(name, "/\\:") {
+		return nil
+	}
+	if _, err := os.Stat(name); err == nil {
+		return nil
+	}
+
+	url := helm.ResolveRepoName(name, configRepoURL)
+	if url == "" {
+		return fmt.Errorf("unknown repository %q: not a URL, a local chart directory or a repository name from the config or Helm's repositories.yaml", name)
+	}
+	slog.Debug("resolved repository alias", "name", name, "url", url)
+	return flag.Value.Set(url)
+}
+
+// configRepoURL returns the URL the config's repositories give name, or ""
+func configRepoURL(name string) string {
+	return viper.GetString("repositories." + name)
+}
+
+// findConfigFile looks for .hvu.yaml in the working directory and its parents, then for
+// hvu/config.yaml in the user's config directory. It returns "" when there is none
+func findConfigFile() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %w", err)
+	}
+	for {
+		path := filepath.Join(dir, configFileName)
+		if exists, err := fileExists(path); err != nil || exists {
+			return path, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", nil
+	}
+	path := filepath.Join(configDir, userConfigFile)
+	if exists, err := fileExists(path); err != nil || exists {
+		return path, err
+	}
+	return "", nil
+}
+
+// fileExists reports whether a regular file exists at path
+func fileExists(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return !info.IsDir(), nil
+}
+
+// applyFlagDefaults sets each flag the user didn't pass from the config or environment, as its
+// default rather than as if it was passed, so a flag passed on the command line still wins over a
+// mutually exclusive one from the config. Settings under charts.<name> apply when --chart names
+// that chart and win over top-level settings. Root flags are bound to viper instead and read
+// through it
+func applyFlagDefaults(cmd *cobra.Command) error {
+	flags := cmd.Flags()
+	local := cmd.LocalFlags()
+
+	// --chart may itself come from the config, so resolve it before the chart's settings
+	chart := local.Lookup("chart")
+	if chart != nil && !chart.Changed {
+		if err := setFlagFromConfig(chart, chart.Name); err != nil {
+			return err
+		}
+	}
+	prefix := ""
+	if chart != nil && chart.Value.String() != "" {
+		prefix = "charts." + chart.Value.String() + "."
+	}
+
+	var err error
+	local.VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed || flag == chart || flag.Name == "help" {
+			return
+		}
+		if excludedByPassedFlag(flags, flag) {
+			slog.Debug("config setting overridden by flag", "flag", flag.Name)
+			return
+		}
+		key := flag.Name
+		if prefix != "" && viper.IsSet(prefix+flag.Name) {
+			key = prefix + flag.Name
+		}
+		err = setFlagFromConfig(flag, key)
+	})
+	return err
+}
+
+// setFlagFromConfig sets a flag to the config or environment value of key, if there is one
+func setFlagFromConfig(flag *pflag.Flag, key string) error {
+	if !viper.IsSet(key) {
+		return nil
+	}
+
+	settings := []string{viper.GetString(key)}
+	if _, repeatable := flag.Value.(pflag.SliceValue); repeatable {
+		settings = viper.GetStringSlice(key)
+	}
+	// Setting the value directly leaves the flag unchanged for cobra's flag group checks
+	for _, setting := range settings {
+		if err := flag.Value.Set(setting); err != nil {
+			return fmt.Errorf("invalid %s in config: %w", key, err)
+		}
+	}
+	flag.DefValue = flag.Value.String()
+	// A required flag the config sets no longer has to be passed
+	delete(flag.Annotations, cobra.BashCompOneRequiredFlag)
+	slog.Debug("flag set from config", "flag", flag.Name, "key", key)
+	return nil
+}
+
+// excludedByPassedFlag reports whether flag is mutually exclusive with a flag passed on the
+// command line
+func excludedByPassedFlag(flags *pflag.FlagSet, flag *pflag.Flag) bool {
+	for _, group := range flag.Annotations[mutuallyExclusiveAnnotation] {
+		for _, name := range strings.Fields(group) {
+			if other := flags.Lookup(name); other != nil && other != flag && other.Changed {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// useConfig makes readConfig read content as the config file and restores viper afterwards
+func useConfig(t *testing.T, content string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	t.Setenv("HVU_CONFIG", path)
+	t.Cleanup(func() {
+		viper.Reset()
+		bindFlags()
+	})
+
+	if err := readConfig(); err != nil {
+		t.Fatalf("readConfig() error = %v", err)
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	project := t.TempDir()
+	nested := filepath.Join(project, "clusters", "prod")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	userConfigDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", userConfigDir)
+	t.Chdir(nested)
+
+	if path, err := findConfigFile(); err != nil || path != "" {
+		t.Fatalf("findConfigFile() = %q, %v, want no config", path, err)
+	}
+
+	userConfig := filepath.Join(userConfigDir, userConfigFile)
+	if err := os.MkdirAll(filepath.Dir(userConfig), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(userConfig, []byte("repo: https://charts.example.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if path, err := findConfigFile(); err != nil || path != userConfig {
+		t.Errorf("findConfigFile() = %q, %v, want %q", path, err, userConfig)
+	}
+
+	projectConfig := filepath.Join(project, configFileName)
+	if err := os.WriteFile(projectConfig, []byte("repo: https://charts.example.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if path, err := findConfigFile(); err != nil || path != projectConfig {
+		t.Errorf("findConfigFile() = %q, %v, want %q", path, err, projectConfig)
+	}
+}
+
+func TestApplyConfig_FlagDefaults(t *testing.T) {
+	useConfig(t, `repo: https://charts.example.com
+removed-keys: comment
+dry-run: true
+charts:
+  postgresql:
+    repo: https://charts.bitnami.com/bitnami
+    values:
+      - base.yaml
+      - prod.yaml
+`)
+	t.Setenv("HVU_REMOVED_KEYS", "drop")
+
+	cmd := UpgradeCmd()
+	if err := cmd.ParseFlags([]string{"--chart", "postgresql", "--values", "mine.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(cmd); err != nil {
+		t.Fatalf("applyConfig() error = %v", err)
+	}
+
+	flags := cmd.Flags()
+	if repo, _ := flags.GetString("repo"); repo != "https://charts.bitnami.com/bitnami" {
+		t.Errorf("expected chart setting to win over top-level repo, got %q", repo)
+	}
+	if removedKeys, _ := flags.GetString("removed-keys"); removedKeys != "drop" {
+		t.Errorf("expected environment to win over config, got %q", removedKeys)
+	}
+	if dryRun, _ := flags.GetBool("dry-run"); !dryRun {
+		t.Error("expected dry-run from config")
+	}
+	if valuesFiles, _ := flags.GetStringArray("values"); len(valuesFiles) != 1 || valuesFiles[0] != "mine.yaml" {
+		t.Errorf("expected command line values to win over config, got %v", valuesFiles)
+	}
+}
+
+func TestApplyConfig_ChartFromConfig(t *testing.T) {
+	useConfig(t, `chart: redis
+charts:
+  redis:
+    version: 19.0.0
+    values: [base.yaml, prod.yaml]
+`)
+
+	cmd := ClassifyCmd()
+	if err := cmd.ParseFlags(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(cmd); err != nil {
+		t.Fatalf("applyConfig() error = %v", err)
+	}
+
+	flags := cmd.Flags()
+	if chart, _ := flags.GetString("chart"); chart != "redis" {
+		t.Errorf("expected chart from config, got %q", chart)
+	}
+	if version, _ := flags.GetString("version"); version != "19.0.0" {
+		t.Errorf("expected chart's version from config, got %q", version)
+	}
+	if valuesFiles, _ := flags.GetStringArray("values"); len(valuesFiles) != 2 || valuesFiles[1] != "prod.yaml" {
+		t.Errorf("expected values files from config, got %v", valuesFiles)
+	}
+	if err := cmd.ValidateRequiredFlags(); err == nil || flags.Lookup("repo").Changed {
+		t.Error("expected --repo to still be required")
+	}
+}
+
+func TestApplyConfig_FlagGroups(t *testing.T) {
+	useConfig(t, `repo: https://charts.example.com
+output-file: upgraded.yaml
+values: [values.yaml]
+`)
+
+	tests := []struct {
+		name     string
+		args     []string
+		flag     string
+		wantFlag string
+	}{
+		{
+			name:     "in-place overrides output-file",
+			args:     []string{"--chart", "app", "--to", "2.0.0", "--values", "mine.yaml", "--in-place"},
+			flag:     "output-file",
+			wantFlag: "",
+		},
+		{
+			name:     "release overrides values",
+			args:     []string{"--chart", "app", "--to", "2.0.0", "--release", "app", "--output-file", "-"},
+			flag:     "values",
+			wantFlag: "[]",
+		},
+		{
+			name:     "config satisfies required repo",
+			args:     []string{"--chart", "app", "--to", "2.0.0"},
+			flag:     "repo",
+			wantFlag: "https://charts.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := UpgradeCmd()
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfig(cmd); err != nil {
+				t.Fatalf("applyConfig() error = %v", err)
+			}
+
+			if err := cmd.ValidateRequiredFlags(); err != nil {
+				t.Errorf("ValidateRequiredFlags() error = %v", err)
+			}
+			if err := cmd.ValidateFlagGroups(); err != nil {
+				t.Errorf("ValidateFlagGroups() error = %v", err)
+			}
+			if got := cmd.Flags().Lookup(tt.flag).Value.String(); got != tt.wantFlag {
+				t.Errorf("--%s = %q, want %q", tt.flag, got, tt.wantFlag)
+			}
+		})
+	}
+}
+
+func TestApplyConfig_InvalidSetting(t *testing.T) {
+	useConfig(t, "dry-run: maybe\n")
+
+	cmd := UpgradeCmd()
+	if err := cmd.ParseFlags(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(cmd); err == nil {
+		t.Error("expected error for an invalid boolean")
+	}
+}
+
+func TestLoadPolicy_FromConfig(t *testing.T) {
+	useConfig(t, `policies:
+  - path: persistence.size
+    action: pin
+`)
+
+	policy, err := loadPolicy()
+	if err != nil {
+		t.Fatalf("loadPolicy() error = %v", err)
+	}
+	if policy == nil || len(policy.Rules) != 1 {
+		t.Fatalf("expected policy from config, got %+v", policy)
+	}
+}
+
+func TestResolveRepoAlias(t *testing.T) {
+	useConfig(t, `repositories:
+  internal: oci://registry.example.com/charts
+`)
+
+	repoFile := filepath.Join(t.TempDir(), "repositories.yaml")
+	t.Setenv("HELM_REPOSITORY_CONFIG", repoFile)
+	helmRepos := "repositories:\n- name: bitnami\n  url: https://charts.bitnami.com/bitnami\n- name: internal\n  url: https://helm.example.com\n"
+	if err := os.WriteFile(repoFile, []byte(helmRepos), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	workDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(workDir, "localchart"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(workDir)
+
+	tests := []struct {
+		repo    string
+		want    string
+		wantErr bool
+	}{
+		{repo: "bitnami", want: "https://charts.bitnami.com/bitnami"},
+		{repo: "internal", want: "oci://registry.example.com/charts"},
+		{repo: "https://charts.example.com", want: "https://charts.example.com"},
+		{repo: "localchart", want: "localchart"},
+		{repo: "./charts/app", want: "./charts/app"},
+		{repo: "jetstack", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repo, func(t *testing.T) {
+			cmd := UpgradeCmd()
+			if err := cmd.ParseFlags([]string{"--repo", tt.repo}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := resolveRepoAlias(cmd)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error for an unknown repository name")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveRepoAlias() error = %v", err)
+			}
+			if got, _ := cmd.Flags().GetString("repo"); got != tt.want {
+				t.Errorf("--repo resolved to %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRedactor_FromConfig(t *testing.T) {
+	useConfig(t, `redact:
+  - license
+`)
+
+	redactor, err := newRedactor()
+	if err != nil {
+		t.Fatalf("newRedactor() error = %v", err)
+	}
+	if !redactor.Sensitive("license::owner", "acme") || !redactor.Sensitive("db::password", "hunter2") {
+		t.Error("expected configured and built-in paths to be masked")
+	}
+
+	t.Setenv("HVU_SHOW_SECRETS", "true")
+	if redactor, err := newRedactor(); err != nil || redactor != nil {
+		t.Errorf("expected no redactor with show-secrets, got %v, %v", redactor, err)
+	}
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itsvictorfy/hvu/pkg/service"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+func DependencyCmd() *cobra.Command {
+	var (
+		name          string
+		toVersion     string
+		dryRun        bool
+		backup        bool
+		upgradeImages bool
+		removedKeys   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "dependency [chart]",
+		Short: "Upgrade a subchart of an umbrella chart together with its values",
+		Long: `Bump the version of a dependency in an umbrella chart's Chart.yaml and upgrade
+the overrides under the dependency's alias (or name) in the chart's values.yaml.
+
+Only that subtree is compared against the old and new subchart defaults; the
+rest of values.yaml, including its comments, is left untouched. Like a layered
+values file, the subtree only keeps the keys it sets and does not pick up new
+subchart defaults.
+
+Examples:
+  # Upgrade the subchart aliased "db" to 16.0.0
+  hvu dependency ./charts/platform --name db --to 16.0.0
+
+  # Preview upgrading a subchart to its newest version
+  hvu dependency --name redis --to latest --dry-run`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			chartPath := "."
+			if len(args) > 0 {
+				chartPath = args[0]
+			}
+
+			removedKeyAction, err := values.ParseRemovedKeyAction(removedKeys)
+			if err != nil {
+				return err
+			}
+
+			slog.Info("upgrading chart dependency",
+				"chart", chartPath,
+				"dependency", name,
+				"toVersion", toVersion,
+				"dryRun", dryRun,
+			)
+
+			policy, err := loadPolicy()
+			if err != nil {
+				return err
+			}
+			redactor, err := newRedactor()
+			if err != nil {
+				return err
+			}
+
+			output, err := service.Dependency(cmd.Context(), &service.DependencyInput{
+				ChartPath:     chartPath,
+				Dependency:    name,
+				ToVersion:     toVersion,
+				DryRun:        dryRun,
+				Backup:        backup,
+				UpgradeImages: upgradeImages,
+				RemovedKeys:   removedKeyAction,
+				Policy:        policy,
+				RepoAliases:   configRepoURL,
+			})
+			if err != nil {
+				return err
+			}
+
+			output.Upgrade = output.Upgrade.Redacted(redactor)
+			printDependencyResults(cmd.OutOrStdout(), output, dryRun)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "alias or chart name of the dependency to upgrade")
+	cmd.Flags().StringVar(&toVersion, "to", "", "target dependency version, or \"latest\"")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "preview changes without writing files")
+	cmd.Flags().BoolVar(&backup, "backup", false, "keep a .bak copy of each file before overwriting it")
+	cmd.Flags().BoolVar(&upgradeImages, "upgrade-images", false, "upgrade custom image tags that still match the old subchart default")
+	cmd.Flags().StringVar(&removedKeys, "removed-keys", "keep", "how to handle keys removed in the target subchart: keep, drop or comment")
+
+	_ = cmd.MarkFlagRequired("name")
+	_ = cmd.MarkFlagRequired("to")
+
+	return cmd
+}
+
+func printDependencyResults(w io.Writer, output *service.DependencyOutput, dryRun bool) {
+	fmt.Fprintf(w, "Dependency %s (%s): %s -> %s in %s\n",
+		output.Key, output.Chart, output.Upgrade.FromVersion, output.ToVersion, output.ChartFile)
+	if output.ValuesFile == "" {
+		fmt.Fprintln(w, "  The chart has no values.yaml, only the version was bumped")
+	}
+
+	printUpgradeResults(w, output.Upgrade, dryRun, "")
+
+	if !dryRun {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Run 'helm dependency update' to refresh Chart.lock and the packaged subchart.")
+	}
+}
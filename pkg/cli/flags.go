@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"log/slog"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// addSetFlags registers Helm's --set family of flags
+func addSetFlags(cmd *cobra.Command, set *helm.SetValues) {
+	cmd.Flags().StringArrayVar(&set.Values, "set", nil, "set values on the command line, applied after values files (key1=val1,key2=val2)")
+	cmd.Flags().StringArrayVar(&set.StringValues, "set-string", nil, "set STRING values on the command line (key1=val1,key2=val2)")
+	cmd.Flags().StringArrayVar(&set.FileValues, "set-file", nil, "set values from the content of files (key1=path1,key2=path2)")
+}
+
+// loadPolicy reads the --policy file, or the policies of the config file. It returns a nil
+// policy when neither has rules
+func loadPolicy() (*values.Policy, error) {
+	path := viper.GetString("policy")
+	if path == "" {
+		path = viper.ConfigFileUsed()
+	}
+	if path == "" {
+		return nil, nil
+	}
+
+	policy, err := values.LoadPolicy(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(policy.Rules) == 0 {
+		return nil, nil
+	}
+	slog.Debug("loaded policy", "path", path, "rules", len(policy.Rules))
+	return policy, nil
+}
+
+// newRedactor returns the redactor masking sensitive values in output, with the extra globs of
+// the config's redact setting, or nil with --show-secrets
+func newRedactor() (*values.Redactor, error) {
+	if viper.GetBool("show-secrets") {
+		return nil, nil
+	}
+	return values.NewRedactor(viper.GetStringSlice("redact"))
+}
@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itsvictorfy/hvu/pkg/service"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+func HelmfileCmd() *cobra.Command {
+	var (
+		file          string
+		environment   string
+		release       string
+		chart         string
+		toVersion     string
+		dryRun        bool
+		backup        bool
+		upgradeImages bool
+		removedKeys   string
+		preserve      bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "helmfile",
+		Short: "Upgrade the values files of the releases in a helmfile",
+		Long: `Read the releases of a helmfile.yaml, resolve their chart repositories and
+upgrade each release's values files in place to a new chart version. The
+release version in the helmfile is bumped as well.
+
+Values file paths may use the environment name, the release name and namespace,
+and environment values ({{ .Environment.Name }}, {{ .Release.Name }},
+{{ .Values.region }}). Inline values and any other templating are reported and
+left untouched.
+
+Examples:
+  # Upgrade every release to the newest version of its chart
+  hvu helmfile --to latest
+
+  # Upgrade one release for the production environment, previewing the changes
+  hvu helmfile -f deploy/helmfile.yaml -e production --release db --to 16.0.0 --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			removedKeyAction, err := values.ParseRemovedKeyAction(removedKeys)
+			if err != nil {
+				return err
+			}
+
+			slog.Info("upgrading helmfile releases",
+				"file", file,
+				"environment", environment,
+				"release", release,
+				"chart", chart,
+				"toVersion", toVersion,
+				"dryRun", dryRun,
+			)
+
+			policy, err := loadPolicy()
+			if err != nil {
+				return err
+			}
+
+			output, err := service.Helmfile(cmd.Context(), &service.HelmfileInput{
+				Path:             file,
+				Environment:      environment,
+				Release:          release,
+				Chart:            chart,
+				ToVersion:        toVersion,
+				DryRun:           dryRun,
+				Backup:           backup,
+				UpgradeImages:    upgradeImages,
+				RemovedKeys:      removedKeyAction,
+				PreserveComments: preserve,
+				Policy:           policy,
+			})
+			if err != nil {
+				return err
+			}
+
+			printHelmfileResults(cmd.OutOrStdout(), output, dryRun)
+
+			failed := 0
+			for _, result := range output.Releases {
+				if result.Err != nil {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d releases could not be handled", failed, len(output.Releases))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "helmfile.yaml", "path to the helmfile")
+	cmd.Flags().StringVarP(&environment, "environment", "e", "", "helmfile environment used to resolve values file paths (default \"default\")")
+	cmd.Flags().StringVar(&release, "release", "", "only upgrade this release")
+	cmd.Flags().StringVar(&chart, "chart", "", "only upgrade releases of this chart")
+	cmd.Flags().StringVar(&toVersion, "to", "", "target chart version, or \"latest\" (required)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be upgraded without writing any file")
+	cmd.Flags().BoolVar(&backup, "backup", false, "keep a .bak copy of a file before overwriting it")
+	cmd.Flags().BoolVar(&upgradeImages, "upgrade-images", false, "upgrade custom image tags that still match the old chart default")
+	cmd.Flags().StringVar(&removedKeys, "removed-keys", "keep", "how to handle keys removed in the target chart: keep, drop or comment")
+	cmd.Flags().BoolVar(&preserve, "preserve-comments", false, "patch values files instead of regenerating them, keeping their comments, key order and anchors")
+
+	_ = cmd.MarkFlagRequired("to")
+
+	return cmd
+}
+
+func printHelmfileResults(w io.Writer, output *service.HelmfileOutput, dryRun bool) {
+	if len(output.Releases) == 0 {
+		fmt.Fprintln(w, "No matching releases found.")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RELEASE\tCHART\tVERSION\tVALUES FILES\tCUSTOMIZED\tSTATUS")
+	for _, result := range output.Releases {
+		version := result.FromVersion
+		if result.ToVersion != "" {
+			version += " -> " + result.ToVersion
+		}
+
+		customized := "-"
+		if result.Classification != nil {
+			customized = fmt.Sprintf("%d", result.Classification.Customized)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n",
+			releaseName(result.Namespace, result.Name), result.Chart, version, len(result.ValuesFiles), customized, helmfileStatus(result, dryRun))
+	}
+	tw.Flush()
+
+	var skipped bool
+	for _, result := range output.Releases {
+		for _, entry := range result.Skipped {
+			if !skipped {
+				fmt.Fprintln(w)
+				fmt.Fprintln(w, "Values left untouched:")
+				skipped = true
+			}
+			fmt.Fprintf(w, "  %s: %s\n", result.Name, entry)
+		}
+	}
+
+	if output.Changed {
+		fmt.Fprintln(w)
+		if dryRun {
+			fmt.Fprintf(w, "Helmfile would be updated for environment %s (dry run)\n", output.Environment)
+		} else {
+			fmt.Fprintf(w, "Helmfile updated for environment %s\n", output.Environment)
+		}
+	}
+}
+
+// helmfileStatus describes the outcome for one helmfile release
+func helmfileStatus(result service.HelmfileResult, dryRun bool) string {
+	switch {
+	case result.Err != nil:
+		return "error: " + result.Err.Error()
+	case result.Upgraded && dryRun:
+		return "would upgrade"
+	case result.Upgraded:
+		return "upgraded"
+	default:
+		return "up to date"
+	}
+}
@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itsvictorfy/hvu/pkg/service"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// Output formats of the outdated command
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+)
+
+func OutdatedCmd() *cobra.Command {
+	var (
+		helmfile     string
+		environment  string
+		chart        string
+		versionsOnly bool
+		format       string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "outdated [path]",
+		Short: "List releases with newer chart versions available",
+		Long: `Find the releases declared in GitOps manifests, Chart.yaml dependencies or a
+helmfile and report the newest patch, minor and major chart versions available
+in their repositories.
+
+For each release the number of customized keys and any pinned image tags are
+shown, which hints at how much review an upgrade needs. Counting customized
+keys downloads each chart; use --versions-only to only read repository indexes.
+
+Examples:
+  # Releases and umbrella chart dependencies in a GitOps repository
+  hvu outdated ./clusters
+
+  # Releases of a helmfile, as JSON
+  hvu outdated --helmfile helmfile.yaml -e production --format json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != FormatTable && format != FormatJSON {
+				return fmt.Errorf("invalid format %q: must be %s or %s", format, FormatTable, FormatJSON)
+			}
+			path := "."
+			if len(args) > 0 {
+				if helmfile != "" {
+					return fmt.Errorf("a path and --helmfile cannot be used together")
+				}
+				path = args[0]
+			}
+
+			slog.Info("checking for newer chart versions",
+				"path", path,
+				"helmfile", helmfile,
+				"chart", chart,
+			)
+
+			output, err := service.Outdated(cmd.Context(), &service.OutdatedInput{
+				Path:         path,
+				Helmfile:     helmfile,
+				Environment:  environment,
+				Chart:        chart,
+				VersionsOnly: versionsOnly,
+			})
+			if err != nil {
+				return err
+			}
+
+			if format == FormatJSON {
+				if err := printOutdatedJSON(cmd.OutOrStdout(), output); err != nil {
+					return err
+				}
+			} else {
+				printOutdatedResults(cmd.OutOrStdout(), output)
+			}
+
+			failed := 0
+			for _, result := range output.Releases {
+				if result.Err != nil {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d releases could not be checked", failed, len(output.Releases))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&helmfile, "helmfile", "", "read releases from this helmfile instead of scanning a directory")
+	cmd.Flags().StringVarP(&environment, "environment", "e", "", "helmfile environment used to resolve values file paths (default \"default\")")
+	cmd.Flags().StringVar(&chart, "chart", "", "only report releases of this chart")
+	cmd.Flags().BoolVar(&versionsOnly, "versions-only", false, "only read repository indexes, without counting customized keys")
+	cmd.Flags().StringVar(&format, "format", FormatTable, "output format: table or json")
+
+	return cmd
+}
+
+func printOutdatedResults(w io.Writer, output *service.OutdatedOutput) {
+	if len(output.Releases) == 0 {
+		fmt.Fprintln(w, "No Helm releases found.")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tKIND\tRELEASE\tCHART\tCURRENT\tPATCH\tMINOR\tMAJOR\tCUSTOMIZED\tPINNED TAGS")
+	for _, result := range output.Releases {
+		patch, minor, major := "-", "-", "-"
+		if result.Newer != nil {
+			patch, minor, major = orDash(result.Newer.Patch), orDash(result.Newer.Minor), orDash(result.Newer.Major)
+		}
+
+		customized := "-"
+		if result.Classification != nil {
+			customized = fmt.Sprintf("%d", result.Classification.Customized)
+		}
+
+		pinned := "-"
+		if len(result.PinnedImageTags) > 0 {
+			paths := make([]string, len(result.PinnedImageTags))
+			for i, path := range result.PinnedImageTags {
+				paths[i] = values.PathToDisplayFormat(path)
+			}
+			pinned = strings.Join(paths, ",")
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			result.File, result.Kind, releaseName(result.Namespace, result.Name), result.Chart,
+			orDash(result.Version), patch, minor, major, customized, pinned)
+	}
+	tw.Flush()
+
+	var failed bool
+	for _, result := range output.Releases {
+		if result.Err == nil {
+			continue
+		}
+		if !failed {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "Could not be checked:")
+			failed = true
+		}
+		fmt.Fprintf(w, "  %s (%s): %v\n", releaseName(result.Namespace, result.Name), result.File, result.Err)
+	}
+}
+
+// outdatedRelease is the JSON form of an outdated result
+type outdatedRelease struct {
+	File            string   `json:"file"`
+	Kind            string   `json:"kind"`
+	Name            string   `json:"name"`
+	Namespace       string   `json:"namespace,omitempty"`
+	Chart           string   `json:"chart"`
+	Repository      string   `json:"repository,omitempty"`
+	Version         string   `json:"version,omitempty"`
+	LatestPatch     string   `json:"latestPatch,omitempty"`
+	LatestMinor     string   `json:"latestMinor,omitempty"`
+	LatestMajor     string   `json:"latestMajor,omitempty"`
+	Customized      *int     `json:"customized,omitempty"`
+	PinnedImageTags []string `json:"pinnedImageTags,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
+
+func printOutdatedJSON(w io.Writer, output *service.OutdatedOutput) error {
+	releases := make([]outdatedRelease, 0, len(output.Releases))
+	for _, result := range output.Releases {
+		release := outdatedRelease{
+			File:       result.File,
+			Kind:       result.Kind,
+			Name:       result.Name,
+			Namespace:  result.Namespace,
+			Chart:      result.Chart,
+			Repository: result.Repository,
+			Version:    result.Version,
+		}
+		if result.Newer != nil {
+			release.LatestPatch = result.Newer.Patch
+			release.LatestMinor = result.Newer.Minor
+			release.LatestMajor = result.Newer.Major
+		}
+		if result.Classification != nil {
+			release.Customized = &result.Classification.Customized
+		}
+		for _, path := range result.PinnedImageTags {
+			release.PinnedImageTags = append(release.PinnedImageTags, values.PathToDisplayFormat(path))
+		}
+		if result.Err != nil {
+			release.Error = result.Err.Error()
+		}
+		releases = append(releases, release)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(releases); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return nil
+}
+
+// orDash returns s, or "-" when it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -1,8 +1,12 @@
 package cli
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -29,13 +33,40 @@ Examples:
     --version 12.1.0 --values ./my-values.yaml`,
 	SilenceUsage:  true,
 	SilenceErrors: true,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := readConfig(); err != nil {
+			return err
+		}
 		setupLogging()
+		if err := applyConfig(cmd); err != nil {
+			return err
+		}
+		applyTimeout(cmd)
+		return nil
 	},
 }
 
+// cancelTimeout releases the timeout applied to the running command, if any
+var cancelTimeout context.CancelFunc = func() {}
+
+// Execute runs the root command. Interrupting the process cancels the command's
+// context so downloads are abandoned and temp directories cleaned up
 func Execute() error {
-	return rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	defer func() { cancelTimeout() }()
+
+	return rootCmd.ExecuteContext(ctx)
+}
+
+// ExitError is returned by commands that need a specific process exit code.
+// The command has already reported the reason to the user
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
 }
 
 func init() {
@@ -45,16 +76,39 @@ func init() {
 		"suppress non-essential output")
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false,
 		"enable verbose logging")
+	rootCmd.PersistentFlags().Duration("timeout", 0,
+		"abort the command after this long, e.g. 5m (0 means no limit, serve uses --request-timeout)")
+	rootCmd.PersistentFlags().String("policy", "",
+		"policy file with rules for keys to pin, always update, ignore or review (default: the config file)")
+	rootCmd.PersistentFlags().Bool("show-secrets", false,
+		"show passwords, tokens and other sensitive values in output instead of masking them")
+	rootCmd.PersistentFlags().String("config", "",
+		"config file (default: .hvu.yaml in the working directory or a parent, then $XDG_CONFIG_HOME/hvu/config.yaml)")
 
-	_ = viper.BindPFlag("output", rootCmd.PersistentFlags().Lookup("output"))
-	_ = viper.BindPFlag("quiet", rootCmd.PersistentFlags().Lookup("quiet"))
-	_ = viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
+	bindFlags()
 
 	rootCmd.AddCommand(UpgradeCmd())
 	rootCmd.AddCommand(ClassifyCmd())
+	rootCmd.AddCommand(CheckCmd())
+	rootCmd.AddCommand(ScanCmd())
+	rootCmd.AddCommand(HelmfileCmd())
+	rootCmd.AddCommand(OutdatedCmd())
+	rootCmd.AddCommand(DependencyCmd())
+	rootCmd.AddCommand(ServeCmd())
 	rootCmd.AddCommand(VersionCmd())
 }
 
+// bindFlags binds the root flags to viper, so the config and environment can set them too
+func bindFlags() {
+	_ = viper.BindPFlag("output", rootCmd.PersistentFlags().Lookup("output"))
+	_ = viper.BindPFlag("quiet", rootCmd.PersistentFlags().Lookup("quiet"))
+	_ = viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
+	_ = viper.BindPFlag("timeout", rootCmd.PersistentFlags().Lookup("timeout"))
+	_ = viper.BindPFlag("policy", rootCmd.PersistentFlags().Lookup("policy"))
+	_ = viper.BindPFlag("show-secrets", rootCmd.PersistentFlags().Lookup("show-secrets"))
+	_ = viper.BindPFlag("config", rootCmd.PersistentFlags().Lookup("config"))
+}
+
 func setupLogging() {
 	level := slog.LevelWarn
 	if viper.GetBool("verbose") {
@@ -68,3 +122,21 @@ func setupLogging() {
 	})
 	slog.SetDefault(slog.New(handler))
 }
+
+// noTimeoutAnnotation marks commands that run until interrupted, which --timeout doesn't bound
+const noTimeoutAnnotation = "hvu/no-timeout"
+
+// applyTimeout bounds the command's context by the --timeout flag
+func applyTimeout(cmd *cobra.Command) {
+	timeout := viper.GetDuration("timeout")
+	if timeout <= 0 || cmd.Annotations[noTimeoutAnnotation] == "true" {
+		return
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancelTimeout = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("timed out after %s", timeout))
+	cmd.SetContext(ctx)
+}
@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itsvictorfy/hvu/pkg/service"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+func ScanCmd() *cobra.Command {
+	var (
+		chart         string
+		toVersion     string
+		dryRun        bool
+		upgradeImages bool
+		removedKeys   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "scan [path]",
+		Short: "Classify or upgrade the releases declared in GitOps manifests",
+		Long: `Find Flux HelmRelease and Argo CD Application resources in a directory and
+classify the inline values of each release against its chart version.
+
+With --to, every release is upgraded: its inline values and chart version are
+rewritten in place. Chart repositories are read from the resources themselves;
+Flux HelmRepository resources are looked up anywhere in the scanned tree.
+
+Examples:
+  # Classify the inline values of every release
+  hvu scan ./clusters
+
+  # Upgrade every release to the newest chart version
+  hvu scan ./clusters --to latest
+
+  # Upgrade one chart to a specific version, previewing the changes
+  hvu scan ./clusters --chart postgresql --to 16.0.0 --dry-run`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "."
+			if len(args) > 0 {
+				path = args[0]
+			}
+
+			removedKeyAction, err := values.ParseRemovedKeyAction(removedKeys)
+			if err != nil {
+				return err
+			}
+
+			slog.Info("scanning manifests",
+				"path", path,
+				"chart", chart,
+				"toVersion", toVersion,
+				"dryRun", dryRun,
+			)
+
+			policy, err := loadPolicy()
+			if err != nil {
+				return err
+			}
+
+			output, err := service.Scan(cmd.Context(), &service.ScanInput{
+				Path:          path,
+				Chart:         chart,
+				ToVersion:     toVersion,
+				DryRun:        dryRun,
+				UpgradeImages: upgradeImages,
+				RemovedKeys:   removedKeyAction,
+				Policy:        policy,
+			})
+			if err != nil {
+				return err
+			}
+
+			printScanResults(cmd.OutOrStdout(), output, dryRun)
+
+			failed := 0
+			for _, result := range output.Releases {
+				if result.Err != nil {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d releases could not be handled", failed, len(output.Releases))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&chart, "chart", "", "only handle releases of this chart")
+	cmd.Flags().StringVar(&toVersion, "to", "", "upgrade releases to this chart version, or \"latest\" (default: classify only)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be upgraded without rewriting manifests")
+	cmd.Flags().BoolVar(&upgradeImages, "upgrade-images", false, "upgrade custom image tags that still match the old chart default")
+	cmd.Flags().StringVar(&removedKeys, "removed-keys", "keep", "how to handle keys removed in the target chart: keep, drop or comment")
+
+	return cmd
+}
+
+func printScanResults(w io.Writer, output *service.ScanOutput, dryRun bool) {
+	if len(output.Releases) == 0 {
+		fmt.Fprintln(w, "No Helm releases found.")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tKIND\tRELEASE\tCHART\tVERSION\tCUSTOMIZED\tSTATUS")
+	for _, result := range output.Releases {
+		version := result.FromVersion
+		if result.ToVersion != "" {
+			version += " -> " + result.ToVersion
+		}
+
+		customized := "-"
+		if result.Classification != nil {
+			customized = fmt.Sprintf("%d", result.Classification.Customized)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			result.File, result.Kind, releaseName(result.Namespace, result.Name), result.Chart, version, customized, scanStatus(result, dryRun))
+	}
+	tw.Flush()
+
+	if len(output.ChangedFiles) > 0 {
+		fmt.Fprintln(w)
+		if dryRun {
+			fmt.Fprintf(w, "%d manifests would be rewritten (dry run)\n", len(output.ChangedFiles))
+		} else {
+			fmt.Fprintf(w, "%d manifests rewritten\n", len(output.ChangedFiles))
+		}
+	}
+}
+
+// releaseName formats a release as namespace/name
+func releaseName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// scanStatus describes the outcome for one release
+func scanStatus(result service.ScanResult, dryRun bool) string {
+	switch {
+	case result.Err != nil:
+		return "error: " + result.Err.Error()
+	case result.Upgraded && dryRun:
+		return "would upgrade"
+	case result.Upgraded:
+		return "upgraded"
+	case result.Classification != nil && result.Classification.Removed > 0:
+		return fmt.Sprintf("%d keys removed in target", result.Classification.Removed)
+	default:
+		return "ok"
+	}
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/itsvictorfy/hvu/pkg/server"
+)
+
+// shutdownTimeout is how long in-flight requests get to finish when the server stops
+const shutdownTimeout = 10 * time.Second
+
+func ServeCmd() *cobra.Command {
+	var (
+		addr           string
+		requestTimeout time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve classify, diff and upgrade as a JSON HTTP API",
+		Long: `Run an HTTP server exposing classify, diff and upgrade as JSON endpoints.
+Chart coordinates are query parameters and values files are posted as the
+request body. Values are never written to disk, but fetching a chart registers
+its repository in the Helm repositories file of the user running the server
+and downloads the index and chart to Helm's cache and temporary directories,
+so callers can add repositories to that user's Helm config.
+
+Endpoints:
+  POST /v1/classify?chart=&repo=&version=
+  GET  /v1/diff?chart=&repo=&from=&to=
+  POST /v1/upgrade?chart=&repo=&from=&to=[&upgrade-images=true][&removed-keys=drop][&preserve-comments=true]
+  GET  /healthz
+
+Only http(s):// chart repositories and oci:// registries are accepted. Charts
+are cached in memory and shared across requests. Sensitive values are masked in
+responses, except in upgraded values, unless --show-secrets is set. The global
+--timeout doesn't apply to serve; each request is bounded by --request-timeout.
+
+Examples:
+  hvu serve --addr :8080 --request-timeout 1m
+
+  curl --data-binary @values.yaml \
+    'http://localhost:8080/v1/classify?chart=postgresql&repo=https://charts.bitnami.com/bitnami&version=12.1.0'`,
+		Args: cobra.NoArgs,
+		// The server runs until interrupted; requests are bounded by --request-timeout instead
+		Annotations: map[string]string{noTimeoutAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			redactor, err := newRedactor()
+			if err != nil {
+				return err
+			}
+
+			httpServer := &http.Server{
+				Addr:              addr,
+				Handler:           server.New(requestTimeout, redactor).Handler(),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+
+			errs := make(chan error, 1)
+			go func() {
+				errs <- httpServer.ListenAndServe()
+			}()
+			fmt.Fprintf(cmd.OutOrStdout(), "Listening on %s\n", addr)
+
+			select {
+			case err := <-errs:
+				return fmt.Errorf("failed to serve: %w", err)
+			case <-cmd.Context().Done():
+			}
+
+			slog.Info("shutting down server", "reason", context.Cause(cmd.Context()))
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := httpServer.Shutdown(ctx); err != nil {
+				return fmt.Errorf("failed to shut down server: %w", err)
+			}
+			if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("failed to serve: %w", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", ":8080", "address to listen on")
+	cmd.Flags().DurationVar(&requestTimeout, "request-timeout", 2*time.Minute, "abort a request after this long (0 means no limit)")
+
+	return cmd
+}
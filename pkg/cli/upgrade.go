@@ -2,13 +2,19 @@ package cli
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
+	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/itsvictorfy/hvu/pkg/helm"
 	"github.com/itsvictorfy/hvu/pkg/prompt"
+	"github.com/itsvictorfy/hvu/pkg/report"
 	"github.com/itsvictorfy/hvu/pkg/service"
+	"github.com/itsvictorfy/hvu/pkg/values"
 )
 
 func UpgradeCmd() *cobra.Command {
@@ -17,10 +23,21 @@ func UpgradeCmd() *cobra.Command {
 		repository    string
 		fromVersion   string
 		toVersion     string
-		valuesFile    string
+		valuesFiles   []string
+		setValues     helm.SetValues
+		release       string
+		namespace     string
 		outputDir     string
+		outputFile    string
+		inPlace       bool
+		backup        bool
+		reportFile    string
+		removedKeys   string
 		dryRun        bool
 		upgradeImages bool
+		preserve      bool
+		gitCommit     bool
+		patchFile     string
 	)
 
 	cmd := &cobra.Command{
@@ -45,11 +62,72 @@ Examples:
     --from 12.1.0 --to 16.0.0 --values ./my-values.yaml \
     --output ./upgraded
 
+  # Overwrite the values file, keeping a .bak copy
+  hvu upgrade --chart postgresql \
+    --repo https://charts.bitnami.com/bitnami \
+    --from 12.1.0 --to 16.0.0 --values ./values.yaml \
+    --in-place --backup
+
+  # Write to a fixed path instead of a timestamped file
+  hvu upgrade --chart postgresql \
+    --repo https://charts.bitnami.com/bitnami \
+    --from 12.1.0 --to 16.0.0 --values ./values.yaml \
+    --output-file ./values-16.yaml
+
   # Dry run (preview without writing files)
   hvu upgrade --chart postgresql \
     --repo https://charts.bitnami.com/bitnami \
-    --from 12.1.0 --to 16.0.0 --values ./my-values.yaml --dry-run`,
+    --from 12.1.0 --to 16.0.0 --values ./my-values.yaml --dry-run
+
+  # Include --set overrides from deploy scripts (they are not written to the output)
+  hvu upgrade --chart postgresql \
+    --repo https://charts.bitnami.com/bitnami \
+    --from 12.1.0 --to 16.0.0 --values ./values.yaml \
+    --set primary.persistence.size=50Gi
+
+  # Upgrade layered values files, writing an upgraded version of each
+  hvu upgrade --chart postgresql \
+    --repo https://charts.bitnami.com/bitnami \
+    --from 12.1.0 --to 16.0.0 -f base.yaml -f prod.yaml --in-place
+
+  # Write a markdown report for a pull request description
+  hvu upgrade --chart postgresql \
+    --repo https://charts.bitnami.com/bitnami \
+    --from 12.1.0 --to 16.0.0 --values ./my-values.yaml \
+    --report report.md
+
+  # Stream values through a pipeline (summary goes to stderr)
+  helm get values my-release -o yaml | hvu upgrade --chart postgresql \
+    --repo https://charts.bitnami.com/bitnami \
+    --from 12.1.0 --to 16.0.0 --values - --output - > upgraded.yaml
+
+  # Upgrade the values file in place and commit it to its git repository
+  hvu upgrade --chart postgresql \
+    --repo https://charts.bitnami.com/bitnami \
+    --from 12.1.0 --to 16.0.0 --values ./values.yaml --git
+
+  # Write the upgrade as a patch, leaving the values file untouched
+  hvu upgrade --chart postgresql \
+    --repo https://charts.bitnami.com/bitnami \
+    --from 12.1.0 --to 16.0.0 --values ./values.yaml --patch upgrade.diff
+
+  # Upgrade the values of a deployed release (--from defaults to its chart version)
+  hvu upgrade --chart postgresql \
+    --repo https://charts.bitnami.com/bitnami \
+    --to 16.0.0 --release my-db --namespace data`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(valuesFiles) == 0 && release == "" {
+				return fmt.Errorf("one of --values or --release is required")
+			}
+			if fromVersion == "" && release == "" {
+				return fmt.Errorf("--from is required unless --release is set")
+			}
+
+			removedKeyAction, err := values.ParseRemovedKeyAction(removedKeys)
+			if err != nil {
+				return err
+			}
+
 			// Set default output directory
 			if outputDir == "" {
 				outputDir = viper.GetString("output")
@@ -63,20 +141,54 @@ Examples:
 				"repository", repository,
 				"fromVersion", fromVersion,
 				"toVersion", toVersion,
-				"valuesFile", valuesFile,
+				"valuesFiles", valuesFiles,
+				"release", release,
+				"namespace", namespace,
 				"outputDir", outputDir,
+				"outputFile", outputFile,
+				"inPlace", inPlace,
 				"dryRun", dryRun,
 			)
 
-			output, err := service.Upgrade(&service.UpgradeInput{
+			// Keep stdout clean for the upgraded values when streaming them
+			out := cmd.OutOrStdout()
+			if service.StreamsOutput(outputDir, outputFile, inPlace || gitCommit || patchFile != "") {
+				out = cmd.ErrOrStderr()
+			}
+
+			policy, err := loadPolicy()
+			if err != nil {
+				return err
+			}
+			redactor, err := newRedactor()
+			if err != nil {
+				return err
+			}
+
+			output, err := service.Upgrade(cmd.Context(), &service.UpgradeInput{
 				Chart:         chart,
 				Repository:    repository,
 				FromVersion:   fromVersion,
 				ToVersion:     toVersion,
-				ValuesFile:    valuesFile,
+				ValuesFiles:   valuesFiles,
+				SetValues:     setValues,
+				Release:       release,
+				Namespace:     namespace,
+				Stdin:         cmd.InOrStdin(),
+				Stdout:        cmd.OutOrStdout(),
 				OutputDir:     outputDir,
+				OutputFile:    outputFile,
+				InPlace:       inPlace,
+				Backup:        backup,
 				DryRun:        dryRun,
 				UpgradeImages: upgradeImages,
+				RemovedKeys:   removedKeyAction,
+
+				PreserveComments: preserve,
+				Git:              gitCommit,
+				Redactor:         redactor,
+				PatchFile:        patchFile,
+				Policy:           policy,
 			})
 			if err != nil {
 				return err
@@ -84,10 +196,16 @@ Examples:
 
 			// Handle interactive prompt for custom image tags
 			if output.PromptForImageTags && !dryRun {
-				prompter := prompt.NewInteractivePrompter()
-				applyUpgrades, err := prompter.ConfirmImageUpgrade(output.CustomImageTags)
-				if err != nil {
-					return fmt.Errorf("failed to prompt for image upgrade: %w", err)
+				applyUpgrades := false
+				if slices.Contains(valuesFiles, service.StdioPath) {
+					// Stdin carried the values file, so there is no one to ask
+					slog.Warn("values read from stdin, keeping custom image tags (use --upgrade-images to upgrade them)")
+				} else {
+					prompter := prompt.NewPrompterWithIO(cmd.InOrStdin(), out)
+					applyUpgrades, err = prompter.ConfirmImageUpgrade(output.CustomImageTags)
+					if err != nil {
+						return fmt.Errorf("failed to prompt for image upgrade: %w", err)
+					}
 				}
 
 				output, err = service.FinalizeUpgrade(&service.FinalizeUpgradeInput{
@@ -95,67 +213,217 @@ Examples:
 					ApplyUpgrades:  applyUpgrades,
 					Chart:          chart,
 					ToVersion:      toVersion,
+					ValuesFiles:    valuesFiles,
+					Stdout:         cmd.OutOrStdout(),
 					OutputDir:      outputDir,
+					OutputFile:     outputFile,
+					InPlace:        inPlace,
+					Backup:         backup,
 					DryRun:         dryRun,
+					Git:            gitCommit,
+					Redactor:       redactor,
+					PatchFile:      patchFile,
 				})
 				if err != nil {
 					return err
 				}
 			}
 
-			printUpgradeResults(output, dryRun)
+			// Values files keep their secrets, but the report and summary must not show them
+			shown := output.Redacted(redactor)
+			if reportFile != "" && !dryRun {
+				err := report.WriteFile(reportFile, &report.Input{
+					Chart:       chart,
+					Repository:  repository,
+					FromVersion: output.FromVersion,
+					ToVersion:   toVersion,
+					Output:      shown,
+				})
+				if err != nil {
+					return err
+				}
+				slog.Debug("wrote upgrade report", "path", reportFile)
+			}
+
+			printUpgradeResults(out, shown, dryRun, reportFile)
 			return nil
 		},
 	}
 
 	cmd.Flags().StringVar(&chart, "chart", "", "chart name")
-	cmd.Flags().StringVar(&repository, "repo", "", "chart repository URL")
+	cmd.Flags().StringVar(&repository, "repo", "", "chart repository URL, OCI registry (oci://...), local chart directory or repository name")
 
-	cmd.Flags().StringVar(&fromVersion, "from", "", "source chart version")
+	cmd.Flags().StringVar(&fromVersion, "from", "", "source chart version (default: deployed version with --release)")
 	cmd.Flags().StringVar(&toVersion, "to", "", "target chart version")
 
-	cmd.Flags().StringVarP(&valuesFile, "values", "f", "", "path to current values file")
-	cmd.Flags().StringVarP(&outputDir, "output", "o", "", "output directory (default: current directory)")
+	cmd.Flags().StringArrayVarP(&valuesFiles, "values", "f", nil, "path to current values file, repeat to layer files like helm -f (\"-\" for stdin)")
+	addSetFlags(cmd, &setValues)
+	cmd.Flags().StringVar(&release, "release", "", "read current values from this deployed Helm release instead of a file")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "namespace of the release (default: current kubeconfig namespace)")
+	cmd.Flags().StringVarP(&outputDir, "output", "o", "", "output directory (default: current directory, \"-\" for stdout)")
+	cmd.Flags().StringVar(&outputFile, "output-file", "", "write the upgraded values to this exact path (\"-\" for stdout)")
+	cmd.Flags().BoolVar(&inPlace, "in-place", false, "overwrite each values file with its upgraded values")
+	cmd.Flags().BoolVar(&backup, "backup", false, "keep a .bak copy of a file before overwriting it")
+	cmd.Flags().BoolVar(&preserve, "preserve-comments", false, "patch your values file instead of regenerating it, keeping its comments, key order and anchors")
+	cmd.Flags().BoolVar(&gitCommit, "git", false, "upgrade the values files in place and commit them to their git repository")
+	cmd.Flags().StringVar(&patchFile, "patch", "", "write the upgrade as a git patch to this path, leaving the values files unchanged")
+	cmd.Flags().StringVar(&removedKeys, "removed-keys", "keep", "how to handle keys removed in the target chart: keep, drop or comment")
+	cmd.Flags().StringVar(&reportFile, "report", "", "write a markdown upgrade report to this path")
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "preview changes without writing files")
 	cmd.Flags().BoolVar(&upgradeImages, "upgrade-images", false, "automatically upgrade custom image tags to new chart defaults")
 
 	_ = cmd.MarkFlagRequired("chart")
 	_ = cmd.MarkFlagRequired("repo")
-	_ = cmd.MarkFlagRequired("from")
 	_ = cmd.MarkFlagRequired("to")
-	_ = cmd.MarkFlagRequired("values")
+
+	cmd.MarkFlagsMutuallyExclusive("in-place", "output-file")
+	cmd.MarkFlagsMutuallyExclusive("values", "release")
+	cmd.MarkFlagsMutuallyExclusive("in-place", "release")
+	cmd.MarkFlagsMutuallyExclusive("git", "patch")
+	cmd.MarkFlagsMutuallyExclusive("git", "release")
+	cmd.MarkFlagsMutuallyExclusive("patch", "release")
+	cmd.MarkFlagsMutuallyExclusive("git", "output-file")
+	cmd.MarkFlagsMutuallyExclusive("patch", "output-file")
 
 	return cmd
 }
 
-func printUpgradeResults(output *service.UpgradeOutput, dryRun bool) {
+func printUpgradeResults(w io.Writer, output *service.UpgradeOutput, dryRun bool, reportFile string) {
 	classification := output.Classification
 
 	if dryRun {
-		fmt.Println()
-		fmt.Println("=== DRY RUN - Upgraded values.yaml ===")
-		fmt.Println(output.UpgradedYAML)
-		fmt.Println("=== END DRY RUN ===")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "=== DRY RUN - Upgraded values.yaml ===")
+		fmt.Fprintln(w, output.UpgradedYAML)
+		fmt.Fprintln(w, "=== END DRY RUN ===")
 		return
 	}
 
-	fmt.Println()
-	fmt.Printf("Upgrade complete!\n")
-	fmt.Printf("  Output: %s\n", output.OutputPath)
-	fmt.Println()
-	fmt.Printf("Summary:\n")
-	fmt.Printf("  %d customizations preserved\n", classification.Customized)
-	fmt.Printf("  %d defaults updated to new version\n", classification.CopiedDefault)
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Upgrade complete!\n")
+	switch {
+	case output.PatchFile != "":
+		fmt.Fprintf(w, "  Patch: %s (values files left unchanged)\n", output.PatchFile)
+	case output.OutputPath == service.StdioPath:
+		fmt.Fprintf(w, "  Output: stdout\n")
+	case len(output.Layers) > 1:
+		fmt.Fprintf(w, "  Output:\n")
+		for _, layer := range output.Layers {
+			fmt.Fprintf(w, "    %s -> %s\n", layer.ValuesFile, layer.OutputPath)
+		}
+	default:
+		fmt.Fprintf(w, "  Output: %s\n", output.OutputPath)
+	}
+	if output.Commit != "" {
+		fmt.Fprintf(w, "  Commit: %s\n", shortHash(output.Commit))
+	}
+	if reportFile != "" {
+		fmt.Fprintf(w, "  Report: %s\n", reportFile)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Summary:\n")
+	fmt.Fprintf(w, "  %d customizations preserved\n", classification.Customized)
+	fmt.Fprintf(w, "  %d defaults updated to new version\n", len(output.UpdatedDefaults))
+	if classification.Removed > 0 {
+		fmt.Fprintf(w, "  %d keys removed in target chart (review recommended):\n", classification.Removed)
+		for _, entry := range classification.Entries {
+			if entry.Classification == values.RemovedInTarget {
+				fmt.Fprintf(w, "    %s\n", values.PathToDisplayFormat(entry.Path))
+			}
+		}
+	}
 	if classification.Unknown > 0 {
-		fmt.Printf("  %d unknown keys kept (review recommended)\n", classification.Unknown)
+		fmt.Fprintf(w, "  %d unknown keys kept (review recommended)\n", classification.Unknown)
+	}
+	if kept := classification.Deletions - len(output.NoOpDeletions); kept > 0 {
+		fmt.Fprintf(w, "  %d null deletions kept\n", kept)
+	}
+	if len(output.NoOpDeletions) > 0 {
+		fmt.Fprintf(w, "  %d null deletions dropped, the keys no longer exist in the target chart:\n", len(output.NoOpDeletions))
+		for _, path := range output.NoOpDeletions {
+			fmt.Fprintf(w, "    %s\n", values.PathToDisplayFormat(path))
+		}
+	}
+	if len(output.RemovedOverrides) > 0 {
+		fmt.Fprintf(w, "  %d --set keys removed in target chart (update your deploy scripts):\n", len(output.RemovedOverrides))
+		for _, override := range output.RemovedOverrides {
+			fmt.Fprintf(w, "    %s%s\n", values.PathToDisplayFormat(override.Path), renamedHint(override.RenamedTo))
+		}
+	}
+
+	if len(output.Conflicts) > 0 {
+		fmt.Fprintf(w, "  %d customizations whose chart default also changed (review recommended)\n", len(output.Conflicts))
+	}
+	printPolicyReport(w, output.Policy, classification.Ignored)
+	if len(output.SchemaViolations) > 0 {
+		fmt.Fprintf(w, "  %d schema violations in upgraded values:\n", len(output.SchemaViolations))
+		for _, violation := range output.SchemaViolations {
+			fmt.Fprintf(w, "    %s\n", violation)
+		}
 	}
 
 	// Show image tag info
 	if len(output.CustomImageTags) > 0 {
 		if output.ImageTagsUpgraded {
-			fmt.Printf("  %d custom image tags upgraded to new defaults\n", len(output.CustomImageTags))
+			fmt.Fprintf(w, "  %d custom image tags upgraded to new defaults\n", len(output.CustomImageTags))
 		} else {
-			fmt.Printf("  %d custom image tags preserved (not upgraded)\n", len(output.CustomImageTags))
+			fmt.Fprintf(w, "  %d custom image tags preserved (not upgraded)\n", len(output.CustomImageTags))
 		}
 	}
+	if len(output.SecretMigrations) > 0 {
+		fmt.Fprintf(w, "  %d hardcoded credentials can move to an existing Secret (recommended):\n", len(output.SecretMigrations))
+		for _, migration := range output.SecretMigrations {
+			fmt.Fprintf(w, "    %s -> set %s\n", values.PathToDisplayFormat(migration.Path), values.PathToDisplayFormat(migration.SecretKey))
+		}
+	}
+}
+
+// printPolicyReport lists the keys whose upgrade a policy changed or flagged
+func printPolicyReport(w io.Writer, report *values.PolicyReport, ignored int) {
+	if ignored > 0 {
+		fmt.Fprintf(w, "  %d keys ignored by policy\n", ignored)
+	}
+	if report.Empty() {
+		return
+	}
+
+	if len(report.Pinned) > 0 {
+		fmt.Fprintf(w, "  %d defaults pinned by policy:\n", len(report.Pinned))
+		for _, change := range report.Pinned {
+			fmt.Fprintf(w, "    %s: kept %v (new default %v)\n", values.PathToDisplayFormat(change.Path), change.OldValue, change.NewValue)
+		}
+	}
+	if len(report.ForcedUpdates) > 0 {
+		fmt.Fprintf(w, "  %d customizations updated to new defaults by policy:\n", len(report.ForcedUpdates))
+		for _, change := range report.ForcedUpdates {
+			fmt.Fprintf(w, "    %s: %v -> %v\n", values.PathToDisplayFormat(change.Path), change.OldValue, change.NewValue)
+		}
+	}
+	if len(report.ReviewRequired) > 0 {
+		fmt.Fprintf(w, "  %d keys require review by policy:\n", len(report.ReviewRequired))
+		for _, change := range report.ReviewRequired {
+			fmt.Fprintf(w, "    %s: default %v -> %v\n", values.PathToDisplayFormat(change.Path), change.OldValue, change.NewValue)
+		}
+	}
+}
+
+// renamedHint suggests the likely new names of a removed key
+func renamedHint(candidates []string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	names := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		names[i] = values.PathToDisplayFormat(candidate)
+	}
+	return " (renamed to " + strings.Join(names, " or ") + "?)"
+}
+
+// shortHash abbreviates a commit hash the way git log --oneline does
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
 }
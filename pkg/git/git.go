@@ -0,0 +1,102 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Repo is a git working tree, driven through the git command line
+type Repo struct {
+	Dir string // Top-level directory of the working tree
+}
+
+// Open finds the git working tree that contains path
+func Open(path string) (*Repo, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path %s: %w", path, err)
+	}
+
+	dir, err := run(filepath.Dir(abs), "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("%s is not in a git repository: %w", path, err)
+	}
+
+	return &Repo{Dir: strings.TrimSpace(dir)}, nil
+}
+
+// Changed returns the paths that have staged or unstaged changes
+func (r *Repo) Changed(paths ...string) ([]string, error) {
+	out, err := r.run(append([]string{"status", "--porcelain", "--"}, paths...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git status: %w", err)
+	}
+
+	var changed []string
+	for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		if len(line) > 3 {
+			changed = append(changed, line[3:])
+		}
+	}
+	return changed, nil
+}
+
+// Commit stages paths and commits only those paths, returning the new commit hash
+func (r *Repo) Commit(message string, paths ...string) (string, error) {
+	if _, err := r.run(append([]string{"add", "--"}, paths...)...); err != nil {
+		return "", fmt.Errorf("failed to stage files: %w", err)
+	}
+	if _, err := r.run(append([]string{"commit", "-m", message, "--"}, paths...)...); err != nil {
+		return "", fmt.Errorf("failed to commit: %w", err)
+	}
+
+	hash, err := r.run("rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to read commit hash: %w", err)
+	}
+	return strings.TrimSpace(hash), nil
+}
+
+// Diff returns the unstaged changes to paths as a patch that git apply accepts
+func (r *Repo) Diff(paths ...string) (string, error) {
+	out, err := r.run(append([]string{"diff", "--"}, paths...)...)
+	if err != nil {
+		return "", fmt.Errorf("failed to diff files: %w", err)
+	}
+	return out, nil
+}
+
+// Restore discards the unstaged changes to paths
+func (r *Repo) Restore(paths ...string) error {
+	if _, err := r.run(append([]string{"checkout", "--"}, paths...)...); err != nil {
+		return fmt.Errorf("failed to restore files: %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) run(args ...string) (string, error) {
+	return run(r.Dir, args...)
+}
+
+// run runs a git command in dir and returns its standard output
+func run(dir string, args ...string) (string, error) {
+	slog.Debug("running git", "dir", dir, "args", args)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,98 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itsvictorfy/hvu/pkg/git/gittest"
+)
+
+func TestOpen(t *testing.T) {
+	dir, valuesFile := gittest.InitRepo(t)
+
+	repo, err := Open(valuesFile)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	want, _ := filepath.EvalSymlinks(dir)
+	got, _ := filepath.EvalSymlinks(repo.Dir)
+	if got != want {
+		t.Errorf("Open() dir = %s, want %s", got, want)
+	}
+
+	if _, err := Open(filepath.Join(t.TempDir(), "values.yaml")); err == nil {
+		t.Error("expected error outside a git repository")
+	}
+}
+
+func TestRepo_CommitAndDiff(t *testing.T) {
+	dir, valuesFile := gittest.InitRepo(t)
+	repo, err := Open(valuesFile)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	changed, err := repo.Changed(valuesFile)
+	if err != nil || len(changed) != 0 {
+		t.Fatalf("expected clean file, got %v (err %v)", changed, err)
+	}
+
+	if err := os.WriteFile(valuesFile, []byte("replicaCount: 3\n"), 0644); err != nil {
+		t.Fatalf("failed to write values file: %v", err)
+	}
+	// An unrelated change must stay out of the commit
+	if err := os.WriteFile(filepath.Join(dir, "other.yaml"), []byte("a: 1\n"), 0644); err != nil {
+		t.Fatalf("failed to write other file: %v", err)
+	}
+	if _, err := run(dir, "add", "other.yaml"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+
+	changed, _ = repo.Changed(valuesFile)
+	if len(changed) != 1 || changed[0] != "values.yaml" {
+		t.Errorf("expected values.yaml to be changed, got %v", changed)
+	}
+
+	diff, err := repo.Diff(valuesFile)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if !strings.Contains(diff, "-replicaCount: 1\n+replicaCount: 3") {
+		t.Errorf("unexpected diff:\n%s", diff)
+	}
+
+	hash, err := repo.Commit("Upgrade values", valuesFile)
+	if err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if len(hash) != 40 {
+		t.Errorf("expected a commit hash, got %q", hash)
+	}
+
+	files, _ := run(dir, "show", "--name-only", "--format=%s", "HEAD")
+	if files != "Upgrade values\n\nvalues.yaml\n" {
+		t.Errorf("expected only values.yaml in the commit, got %q", files)
+	}
+}
+
+func TestRepo_Restore(t *testing.T) {
+	_, valuesFile := gittest.InitRepo(t)
+	repo, err := Open(valuesFile)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	if err := os.WriteFile(valuesFile, []byte("replicaCount: 3\n"), 0644); err != nil {
+		t.Fatalf("failed to write values file: %v", err)
+	}
+	if err := repo.Restore(valuesFile); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	content, _ := os.ReadFile(valuesFile)
+	if string(content) != "replicaCount: 1\n" {
+		t.Errorf("expected file to be restored, got %q", content)
+	}
+}
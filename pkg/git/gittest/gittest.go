@@ -0,0 +1,48 @@
+// Package gittest provides git repository fixtures for tests
+package gittest
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// InitRepo creates a git repository with one committed values file and returns the repository
+// directory and the file's path. The test is skipped when git is not installed
+func InitRepo(t *testing.T) (string, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	valuesFile := filepath.Join(dir, "values.yaml")
+	if err := os.WriteFile(valuesFile, []byte("replicaCount: 1\n"), 0644); err != nil {
+		t.Fatalf("failed to write values file: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.name", "Test"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "commit.gpgsign", "false"},
+		{"add", "values.yaml"},
+		{"commit", "-q", "-m", "initial"},
+	} {
+		Output(t, dir, args...)
+	}
+	return dir, valuesFile
+}
+
+// Output runs a git command in dir and returns its output, failing the test if it fails
+func Output(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+	return string(out)
+}
@@ -0,0 +1,90 @@
+package helm
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// chartDefaults returns a chart's default values with the defaults of every subchart in charts/
+// nested under its alias (or name), the way Helm coalesces them at install time. Values the parent
+// sets for a subchart take precedence over the subchart's own defaults. Subcharts are included
+// whether or not their condition enables them by default, since users enable them in their values
+func chartDefaults(c *chart.Chart) (map[string]interface{}, error) {
+	defaults, err := rawValues(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// Subcharts are keyed by alias when the dependency declares one
+	keys := make(map[string][]string)
+	for _, dep := range c.Metadata.Dependencies {
+		key := dep.Name
+		if dep.Alias != "" {
+			key = dep.Alias
+		}
+		keys[dep.Name] = append(keys[dep.Name], key)
+	}
+
+	for _, sub := range c.Dependencies() {
+		subKeys, declared := keys[sub.Name()]
+		if !declared {
+			subKeys = []string{sub.Name()}
+		}
+
+		subDefaults, err := chartDefaults(sub)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read defaults of subchart %s: %w", sub.Name(), err)
+		}
+		// Globals flow down from the parent, a subchart's own globals are not addressable from it
+		delete(subDefaults, "global")
+
+		for _, key := range subKeys {
+			parentValues, _ := defaults[key].(map[string]interface{})
+			defaults[key] = mergeDefaults(parentValues, subDefaults)
+		}
+	}
+
+	return defaults, nil
+}
+
+// rawValues parses a chart's values.yaml the same way user values files are parsed, so that
+// numbers and other scalars compare equal to values read from user files
+func rawValues(c *chart.Chart) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	for _, f := range c.Raw {
+		if f.Name != chartutil.ValuesfileName {
+			continue
+		}
+		if err := yaml.Unmarshal(f.Data, &data); err != nil {
+			return nil, fmt.Errorf("failed to parse %s of chart %s: %w", f.Name, c.Name(), err)
+		}
+		if data == nil {
+			data = make(map[string]interface{})
+		}
+	}
+	return data, nil
+}
+
+// mergeDefaults returns a copy of base with every key of override applied on top. Nested maps are
+// merged key by key, any other override value replaces the base value
+func mergeDefaults(override, base map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(base)+len(override))
+	for key, value := range base {
+		result[key] = value
+	}
+
+	for key, value := range override {
+		overrideMap, overrideIsMap := value.(map[string]interface{})
+		baseMap, baseIsMap := result[key].(map[string]interface{})
+		if overrideIsMap && baseIsMap {
+			result[key] = mergeDefaults(overrideMap, baseMap)
+			continue
+		}
+		result[key] = value
+	}
+
+	return result
+}
@@ -0,0 +1,100 @@
+package helm
+
+import (
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// testChart builds an in-memory chart with the given values.yaml content
+func testChart(name, valuesYAML string, deps ...*chart.Dependency) *chart.Chart {
+	return &chart.Chart{
+		Metadata: &chart.Metadata{Name: name, Version: "1.0.0", APIVersion: chart.APIVersionV2, Dependencies: deps},
+		Raw:      []*chart.File{{Name: chartutil.ValuesfileName, Data: []byte(valuesYAML)}},
+	}
+}
+
+// umbrellaChart returns a parent chart with an aliased postgresql subchart and an undeclared common subchart
+func umbrellaChart() *chart.Chart {
+	parent := testChart("app", "replicaCount: 1\ndb:\n  auth:\n    database: app\n",
+		&chart.Dependency{Name: "postgresql", Version: "1.0.0", Alias: "db", Condition: "db.enabled"},
+	)
+	postgresql := testChart("postgresql", "enabled: false\nauth:\n  database: postgres\n  username: admin\nglobal:\n  storageClass: \"\"\nmaxConnections: 1000000\n")
+	common := testChart("common", "exampleValue: common-chart\n")
+
+	parent.AddDependency(postgresql, common)
+	return parent
+}
+
+func TestChartDefaults(t *testing.T) {
+	defaults, err := chartDefaults(umbrellaChart())
+	if err != nil {
+		t.Fatalf("chartDefaults() error = %v", err)
+	}
+
+	if defaults["replicaCount"] != 1 {
+		t.Errorf("expected parent defaults to be kept, got %v", defaults["replicaCount"])
+	}
+	if _, exists := defaults["postgresql"]; exists {
+		t.Error("expected aliased subchart to be keyed by its alias")
+	}
+
+	db, ok := defaults["db"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected subchart defaults under db, got %v", defaults["db"])
+	}
+	auth := db["auth"].(map[string]interface{})
+	if auth["database"] != "app" {
+		t.Errorf("expected parent value to override subchart default, got %v", auth["database"])
+	}
+	if auth["username"] != "admin" {
+		t.Errorf("expected subchart default to be filled in, got %v", auth["username"])
+	}
+	if db["enabled"] != false {
+		t.Errorf("expected disabled subchart defaults to be included, got %v", db["enabled"])
+	}
+	if db["maxConnections"] != 1000000 {
+		t.Errorf("expected integers to stay integers, got %v (%T)", db["maxConnections"], db["maxConnections"])
+	}
+	if _, exists := db["global"]; exists {
+		t.Error("expected subchart globals to be left out")
+	}
+
+	common, ok := defaults["common"].(map[string]interface{})
+	if !ok || common["exampleValue"] != "common-chart" {
+		t.Errorf("expected undeclared subchart under its name, got %v", defaults["common"])
+	}
+}
+
+func TestReadChart_IncludesSubcharts(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := chartutil.SaveDir(umbrellaChart(), tmpDir); err != nil {
+		t.Fatalf("failed to save chart: %v", err)
+	}
+
+	info, err := readChart(tmpDir, "app")
+	if err != nil {
+		t.Fatalf("readChart() error = %v", err)
+	}
+
+	db, ok := info.Defaults["db"].(map[string]interface{})
+	if !ok || db["auth"].(map[string]interface{})["username"] != "admin" {
+		t.Errorf("expected subchart defaults loaded from charts/, got %v", info.Defaults["db"])
+	}
+}
+
+func TestMergeDefaults(t *testing.T) {
+	base := map[string]interface{}{"a": 1, "nested": map[string]interface{}{"x": 1, "y": 2}}
+	override := map[string]interface{}{"b": 2, "nested": map[string]interface{}{"y": 3}}
+
+	merged := mergeDefaults(override, base)
+
+	nested := merged["nested"].(map[string]interface{})
+	if merged["a"] != 1 || merged["b"] != 2 || nested["x"] != 1 || nested["y"] != 3 {
+		t.Errorf("unexpected merge result %v", merged)
+	}
+	if base["nested"].(map[string]interface{})["y"] != 2 {
+		t.Error("expected base to be left unmodified")
+	}
+}
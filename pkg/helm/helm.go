@@ -1,62 +1,137 @@
 package helm
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
 	"helm.sh/helm/v3/pkg/repo"
 )
 
-// GetValuesFileByVersion fetches the default values.yaml for a specific chart version from a repository
-func GetValuesFileByVersion(repoURL, chartName, version string) (string, error) {
+// changelogFileNames are the file names checked for a changelog shipped inside a chart package
+var changelogFileNames = []string{"CHANGELOG.md", "CHANGELOG", "changelog.md"}
+
+// ChartInfo holds the parts of a pulled chart that hvu works with
+type ChartInfo struct {
+	Name      string
+	Version   string
+	Values    string                 // Raw values.yaml content, including comments
+	Defaults  map[string]interface{} // Default values including subchart defaults under their alias
+	Changelog string                 // Raw changelog content, empty if the chart ships none
+	Schema    []byte                 // Raw values.schema.json content, nil if the chart ships none
+	Metadata  *chart.Metadata
+}
+
+// cacheDir replaces Helm's repository cache directory when set
+var cacheDir string
+
+// SetCacheDir keeps downloaded repository indexes in dir instead of Helm's repository cache.
+// It must be called before any chart is fetched
+func SetCacheDir(dir string) {
+	cacheDir = dir
+}
+
+// newSettings returns Helm's environment settings with the cache directory set by SetCacheDir
+func newSettings() *cli.EnvSettings {
 	settings := cli.New()
+	if cacheDir != "" {
+		settings.RepositoryCache = cacheDir
+	}
+	return settings
+}
 
-	values, err := tryPullChart(chartName, version, repoURL, settings)
+// GetValuesFileByVersion fetches the default values.yaml for a specific chart version from a repository
+func GetValuesFileByVersion(ctx context.Context, repoURL, chartName, version string) (string, error) {
+	info, err := GetChartByVersion(ctx, repoURL, chartName, version)
+	if err != nil {
+		return "", err
+	}
+	return info.Values, nil
+}
+
+// GetChartByVersion fetches a specific chart version from a repository and returns its contents.
+// Downloads are abandoned when ctx is done
+func GetChartByVersion(ctx context.Context, repoURL, chartName, version string) (*ChartInfo, error) {
+	settings := newSettings()
+
+	info, err := tryPullChart(ctx, chartName, version, repoURL, settings)
 	if err == nil {
-		return values, nil
+		return info, nil
+	}
+	if ctx.Err() != nil {
+		return nil, err
 	}
 
-	repoName, err := addRepoIfNotExists(repoURL, settings)
+	repoName, err := runWithContext(ctx, func() (string, error) {
+		return addRepoIfNotExists(repoURL, settings)
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to add repository: %w", err)
+		return nil, fmt.Errorf("failed to add repository: %w", err)
 	}
 
 	chartRef := fmt.Sprintf("%s/%s", repoName, chartName)
-	values, err = tryPullChart(chartRef, version, "", settings)
+	info, err = tryPullChart(ctx, chartRef, version, "", settings)
 	if err != nil {
-		return "", fmt.Errorf("failed to pull chart after adding repo: %w", err)
+		return nil, fmt.Errorf("failed to pull chart after adding repo: %w", err)
 	}
 
-	return values, nil
+	return info, nil
 }
 
-// tryPullChart attempts to pull and extract values from a chart
-func tryPullChart(chartRef, version, repoURL string, settings *cli.EnvSettings) (string, error) {
+// tryPullChart attempts to pull a chart and read its contents. The temp directory the chart
+// is extracted to is removed even when ctx is done before the pull finishes, and again once
+// the abandoned pull returns
+func tryPullChart(ctx context.Context, chartRef, version, repoURL string, settings *cli.EnvSettings) (*ChartInfo, error) {
 	// Create temp directory
 	tmpDir, err := os.MkdirTemp("", "hvu-chart-*")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp directory: %w", err)
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
 	}
 	defer os.RemoveAll(tmpDir)
 
-	err = pullChart(chartRef, version, repoURL, tmpDir, settings)
-	if err != nil {
-		return "", err
-	}
-
-	chartName := filepath.Base(chartRef)
+	return runWithContext(ctx, func() (*ChartInfo, error) {
+		// An abandoned pull may still extract into the directory after it was removed
+		defer os.RemoveAll(tmpDir)
 
-	return readValuesFromChart(tmpDir, chartName)
+		if err := pullChart(chartRef, version, repoURL, tmpDir, settings); err != nil {
+			return nil, err
+		}
+		return readChart(tmpDir, filepath.Base(chartRef))
+	})
 }
 
 // pullChart downloads and extracts a chart to the specified directory
 func pullChart(chartRef, version, repoURL, destDir string, settings *cli.EnvSettings) error {
 	actionConfig := &action.Configuration{}
+	if registry.IsOCI(chartRef) {
+		client, err := registry.NewClient(
+			registry.ClientOptCredentialsFile(settings.RegistryConfig),
+			registry.ClientOptEnableCache(true),
+			// Bound abandoned pulls like Helm's HTTP getter does, the registry client has no timeout
+			registry.ClientOptHTTPClient(&http.Client{
+				Transport: registry.NewTransport(settings.Debug),
+				Timeout:   getter.DefaultHTTPTimeout * time.Second,
+			}),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create registry client: %w", err)
+		}
+		actionConfig.RegistryClient = client
+	}
+
 	pullClient := action.NewPullWithOpts(action.WithConfig(actionConfig))
 	pullClient.Settings = settings
 	pullClient.Version = version
@@ -71,19 +146,80 @@ func pullChart(chartRef, version, repoURL, destDir string, settings *cli.EnvSett
 	return err
 }
 
-// readValuesFromChart reads the values.yaml file from an extracted chart directory
-func readValuesFromChart(tmpDir, chartName string) (string, error) {
+// readChart loads an extracted chart directory and collects its values and changelog
+func readChart(tmpDir, chartName string) (*ChartInfo, error) {
 	chartPath := filepath.Join(tmpDir, chartName)
-	showClient := action.NewShow(action.ShowValues)
-	output, err := showClient.Run(chartPath)
+	loaded, err := loader.Load(chartPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to read values from chart: %w", err)
+		return nil, fmt.Errorf("failed to read values from chart: %w", err)
 	}
-	return output, nil
+	return newChartInfo(loaded)
 }
 
+// newChartInfo collects the values, schema and changelog of a loaded chart
+func newChartInfo(loaded *chart.Chart) (*ChartInfo, error) {
+	defaults, err := chartDefaults(loaded)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ChartInfo{
+		Name:     loaded.Name(),
+		Version:  loaded.Metadata.Version,
+		Defaults: defaults,
+		Schema:   loaded.Schema,
+		Metadata: loaded.Metadata,
+	}
+
+	for _, f := range loaded.Raw {
+		if f.Name == chartutil.ValuesfileName {
+			info.Values = string(f.Data) + "\n"
+		}
+	}
+
+	for _, name := range changelogFileNames {
+		for _, f := range loaded.Files {
+			if f.Name == name {
+				info.Changelog = string(f.Data)
+				return info, nil
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// ValidateValues checks values against a chart's values.schema.json and returns one
+// message per violation. A chart without a schema never reports violations
+func ValidateValues(schema []byte, values map[string]interface{}) []string {
+	if len(schema) == 0 {
+		return nil
+	}
+
+	err := chartutil.ValidateAgainstSingleSchema(values, schema)
+	if err == nil {
+		return nil
+	}
+
+	var violations []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "-"))
+		if line != "" {
+			violations = append(violations, line)
+		}
+	}
+	return violations
+}
+
+// repoFileMu serializes changes to the repositories file, which concurrent fetches would
+// otherwise overwrite with each other's entries
+var repoFileMu sync.Mutex
+
 // addRepoIfNotExists adds a Helm repository if it doesn't exist and returns the repo name
 func addRepoIfNotExists(repoURL string, settings *cli.EnvSettings) (string, error) {
+	repoFileMu.Lock()
+	defer repoFileMu.Unlock()
+
 	existingRepoName := findRepoByURL(repoURL, settings)
 	if existingRepoName != "" {
 		err := updateRepoIndex(existingRepoName, repoURL, settings)
@@ -112,6 +248,32 @@ func findRepoByURL(repoURL string, settings *cli.EnvSettings) string {
 	return ""
 }
 
+// ResolveRepoName returns the URL of the repository named name, looked up with aliases, such as
+// the repositories in hvu's config, then among the repositories registered with Helm. It returns
+// "" if there is none
+func ResolveRepoName(name string, aliases func(name string) string) string {
+	if aliases != nil {
+		if url := aliases(name); url != "" {
+			return url
+		}
+	}
+	return FindRepoURL(name)
+}
+
+// FindRepoURL returns the URL of the repository registered with Helm under name, as by
+// helm repo add, or "" if there is none
+func FindRepoURL(name string) string {
+	repos, err := repo.LoadFile(newSettings().RepositoryConfig)
+	if err != nil {
+		return ""
+	}
+
+	if existing := repos.Get(name); existing != nil {
+		return existing.URL
+	}
+	return ""
+}
+
 // updateRepoIndex updates the index for an existing repository
 func updateRepoIndex(repoName, repoURL string, settings *cli.EnvSettings) error {
 	providers := getter.All(settings)
@@ -142,8 +304,7 @@ func addNewRepo(repoURL string, settings *cli.EnvSettings) (string, error) {
 		repos = repo.NewFile()
 	}
 
-	hash := sha256.Sum256([]byte(repoURL))
-	repoName := fmt.Sprintf("hvu-%x", hash[:8])
+	repoName := repoNameForURL(repoURL)
 
 	entry := &repo.Entry{
 		Name: repoName,
@@ -166,3 +327,37 @@ func addNewRepo(repoURL string, settings *cli.EnvSettings) (string, error) {
 
 	return repoName, nil
 }
+
+// repoNameForURL returns the name hvu gives the repository it adds for a URL
+func repoNameForURL(repoURL string) string {
+	hash := sha256.Sum256([]byte(repoURL))
+	return fmt.Sprintf("hvu-%x", hash[:8])
+}
+
+// runWithContext runs fn and returns its result, or the cause of ctx being done if that happens
+// first. The Helm SDK's downloads take no context, so an abandoned fn finishes in the background,
+// which Helm's HTTP timeout bounds to a couple of minutes per request
+func runWithContext[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	if err := context.Cause(ctx); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, context.Cause(ctx)
+	}
+}
@@ -0,0 +1,114 @@
+package helm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateValues(t *testing.T) {
+	schema := []byte(`{
+  "type": "object",
+  "properties": {
+    "replicaCount": {"type": "integer"},
+    "image": {
+      "type": "object",
+      "properties": {"tag": {"type": "string"}}
+    }
+  }
+}`)
+
+	t.Run("valid values", func(t *testing.T) {
+		violations := ValidateValues(schema, map[string]interface{}{
+			"replicaCount": 3,
+			"image":        map[string]interface{}{"tag": "1.0.0"},
+		})
+		if len(violations) != 0 {
+			t.Errorf("expected no violations, got %v", violations)
+		}
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		violations := ValidateValues(schema, map[string]interface{}{
+			"replicaCount": "three",
+			"image":        map[string]interface{}{"tag": 1},
+		})
+		if len(violations) != 2 {
+			t.Fatalf("expected 2 violations, got %v", violations)
+		}
+		joined := strings.Join(violations, "\n")
+		if !strings.Contains(joined, "/replicaCount") || !strings.Contains(joined, "/image/tag") {
+			t.Errorf("expected violations to name the offending paths, got %v", violations)
+		}
+	})
+
+	t.Run("no schema", func(t *testing.T) {
+		if violations := ValidateValues(nil, map[string]interface{}{"anything": true}); violations != nil {
+			t.Errorf("expected no violations without a schema, got %v", violations)
+		}
+	})
+}
+
+func TestRunWithContext(t *testing.T) {
+	value, err := runWithContext(context.Background(), func() (string, error) {
+		return "done", nil
+	})
+	if err != nil || value != "done" {
+		t.Errorf("runWithContext() = %q, %v", value, err)
+	}
+
+	// A call that never returns is abandoned once the context is done
+	timeout := errors.New("timed out")
+	ctx, cancel := context.WithTimeoutCause(context.Background(), 10*time.Millisecond, timeout)
+	defer cancel()
+	block := make(chan struct{})
+	defer close(block)
+
+	_, err = runWithContext(ctx, func() (string, error) {
+		<-block
+		return "", nil
+	})
+	if !errors.Is(err, timeout) {
+		t.Errorf("expected the context cause, got %v", err)
+	}
+
+	// Nothing is started for a context that is already done
+	called := false
+	_, err = runWithContext(ctx, func() (string, error) {
+		called = true
+		return "", nil
+	})
+	if err == nil || called {
+		t.Errorf("expected no call for a done context, got err %v, called %v", err, called)
+	}
+}
+
+func TestFindRepoURL(t *testing.T) {
+	repoFile := filepath.Join(t.TempDir(), "repositories.yaml")
+	t.Setenv("HELM_REPOSITORY_CONFIG", repoFile)
+
+	if got := FindRepoURL("bitnami"); got != "" {
+		t.Errorf("FindRepoURL() without a repositories file = %q, want none", got)
+	}
+
+	content := `apiVersion: ""
+generated: "0001-01-01T00:00:00Z"
+repositories:
+- name: bitnami
+  url: https://charts.bitnami.com/bitnami
+`
+	if err := os.WriteFile(repoFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := FindRepoURL("bitnami"); got != "https://charts.bitnami.com/bitnami" {
+		t.Errorf("FindRepoURL() = %q, want the registered URL", got)
+	}
+	if got := FindRepoURL("jetstack"); got != "" {
+		t.Errorf("FindRepoURL() for an unregistered name = %q, want none", got)
+	}
+}
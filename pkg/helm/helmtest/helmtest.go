@@ -0,0 +1,50 @@
+// Package helmtest provides Helm release fixtures backed by Helm's in-memory storage driver
+package helmtest
+
+import (
+	"io"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// NewActionConfig returns an action configuration backed by Helm's in-memory storage driver,
+// holding releases
+func NewActionConfig(t *testing.T, releases ...*release.Release) *action.Configuration {
+	t.Helper()
+
+	cfg := &action.Configuration{
+		Releases:     storage.Init(driver.NewMemory()),
+		KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard},
+		Capabilities: chartutil.DefaultCapabilities,
+		Log:          func(format string, v ...interface{}) {},
+	}
+
+	for _, rel := range releases {
+		if err := cfg.Releases.Create(rel); err != nil {
+			t.Fatalf("failed to store release: %v", err)
+		}
+	}
+
+	return cfg
+}
+
+// Release returns a deployed revision of a postgresql release in the default namespace
+func Release(name string, revision int, version string, config map[string]interface{}) *release.Release {
+	return &release.Release{
+		Name:      name,
+		Namespace: "default",
+		Version:   revision,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{Name: "postgresql", Version: version, APIVersion: chart.APIVersionV2},
+		},
+		Config: config,
+	}
+}
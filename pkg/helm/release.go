@@ -0,0 +1,66 @@
+package helm
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"helm.sh/helm/v3/pkg/action"
+)
+
+// ReleaseValues holds the user-supplied values and chart of a deployed release
+type ReleaseValues struct {
+	Name         string
+	Namespace    string
+	Chart        string
+	ChartVersion string
+	Values       map[string]interface{} // User-supplied values only, without chart defaults
+}
+
+// NewActionConfig creates a Helm action configuration for a namespace, using the current
+// kubeconfig and the storage driver selected by HELM_DRIVER (secrets by default)
+func NewActionConfig(namespace string) (*action.Configuration, error) {
+	settings := newSettings()
+	if namespace != "" {
+		settings.SetNamespace(namespace)
+	}
+
+	cfg := &action.Configuration{}
+	debugLog := func(format string, v ...interface{}) {
+		slog.Debug(fmt.Sprintf(format, v...))
+	}
+	if err := cfg.Init(settings.RESTClientGetter(), settings.Namespace(), os.Getenv("HELM_DRIVER"), debugLog); err != nil {
+		return nil, fmt.Errorf("failed to initialize helm configuration: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// GetReleaseValues loads the user-supplied values and the deployed chart of the latest
+// revision of a release
+func GetReleaseValues(cfg *action.Configuration, name string) (*ReleaseValues, error) {
+	userValues, err := action.NewGetValues(cfg).Run(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get values for release %s: %w", name, err)
+	}
+
+	rel, err := action.NewGet(cfg).Run(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get release %s: %w", name, err)
+	}
+	if rel.Chart == nil || rel.Chart.Metadata == nil {
+		return nil, fmt.Errorf("release %s has no chart metadata", name)
+	}
+
+	if userValues == nil {
+		userValues = map[string]interface{}{}
+	}
+
+	return &ReleaseValues{
+		Name:         rel.Name,
+		Namespace:    rel.Namespace,
+		Chart:        rel.Chart.Metadata.Name,
+		ChartVersion: rel.Chart.Metadata.Version,
+		Values:       userValues,
+	}, nil
+}
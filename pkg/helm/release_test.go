@@ -0,0 +1,56 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/itsvictorfy/hvu/pkg/helm/helmtest"
+)
+
+func TestGetReleaseValues(t *testing.T) {
+	cfg := helmtest.NewActionConfig(t,
+		helmtest.Release("db", 1, "12.0.0", map[string]interface{}{"replicaCount": 1}),
+		helmtest.Release("db", 2, "12.1.0", map[string]interface{}{
+			"replicaCount": 3,
+			"auth":         map[string]interface{}{"database": "app"},
+		}),
+	)
+
+	rel, err := GetReleaseValues(cfg, "db")
+	if err != nil {
+		t.Fatalf("GetReleaseValues() error = %v", err)
+	}
+
+	if rel.Chart != "postgresql" {
+		t.Errorf("expected chart postgresql, got %s", rel.Chart)
+	}
+	if rel.ChartVersion != "12.1.0" {
+		t.Errorf("expected latest revision chart version 12.1.0, got %s", rel.ChartVersion)
+	}
+	if rel.Values["replicaCount"] != 3 {
+		t.Errorf("expected replicaCount=3, got %v", rel.Values["replicaCount"])
+	}
+	auth, ok := rel.Values["auth"].(map[string]interface{})
+	if !ok || auth["database"] != "app" {
+		t.Errorf("expected auth.database=app, got %v", rel.Values["auth"])
+	}
+}
+
+func TestGetReleaseValues_NoUserValues(t *testing.T) {
+	cfg := helmtest.NewActionConfig(t, helmtest.Release("db", 1, "12.1.0", nil))
+
+	rel, err := GetReleaseValues(cfg, "db")
+	if err != nil {
+		t.Fatalf("GetReleaseValues() error = %v", err)
+	}
+	if rel.Values == nil || len(rel.Values) != 0 {
+		t.Errorf("expected empty values map, got %v", rel.Values)
+	}
+}
+
+func TestGetReleaseValues_NotFound(t *testing.T) {
+	cfg := helmtest.NewActionConfig(t)
+
+	if _, err := GetReleaseValues(cfg, "missing"); err == nil {
+		t.Error("expected error for missing release")
+	}
+}
@@ -0,0 +1,50 @@
+package helm
+
+import (
+	"fmt"
+	"os"
+
+	"helm.sh/helm/v3/pkg/strvals"
+)
+
+// SetValues holds Helm style command line value overrides
+type SetValues struct {
+	Values       []string // --set key=value
+	StringValues []string // --set-string key=value
+	FileValues   []string // --set-file key=path
+}
+
+// Empty reports whether no overrides were given
+func (s SetValues) Empty() bool {
+	return len(s.Values) == 0 && len(s.StringValues) == 0 && len(s.FileValues) == 0
+}
+
+// Parse applies the overrides in the order Helm does (--set, then --set-string, then --set-file)
+// and returns the resulting nested values
+func (s SetValues) Parse() (map[string]interface{}, error) {
+	base := map[string]interface{}{}
+
+	for _, value := range s.Values {
+		if err := strvals.ParseInto(value, base); err != nil {
+			return nil, fmt.Errorf("failed to parse --set %q: %w", value, err)
+		}
+	}
+
+	for _, value := range s.StringValues {
+		if err := strvals.ParseIntoString(value, base); err != nil {
+			return nil, fmt.Errorf("failed to parse --set-string %q: %w", value, err)
+		}
+	}
+
+	readFile := func(rs []rune) (interface{}, error) {
+		content, err := os.ReadFile(string(rs))
+		return string(content), err
+	}
+	for _, value := range s.FileValues {
+		if err := strvals.ParseIntoFile(value, base, readFile); err != nil {
+			return nil, fmt.Errorf("failed to parse --set-file %q: %w", value, err)
+		}
+	}
+
+	return base, nil
+}
@@ -0,0 +1,60 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetValuesParse(t *testing.T) {
+	certFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(certFile, []byte("CERT"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	set := SetValues{
+		Values:       []string{"replicaCount=3,image.tag=1.2.3", "auth.enabled=true"},
+		StringValues: []string{"image.tag=1.2", "build=0123"},
+		FileValues:   []string{"tls.ca=" + certFile},
+	}
+
+	got, err := set.Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if got["replicaCount"] != int64(3) {
+		t.Errorf("expected replicaCount=3, got %v (%T)", got["replicaCount"], got["replicaCount"])
+	}
+	image := got["image"].(map[string]interface{})
+	if image["tag"] != "1.2" {
+		t.Errorf("expected --set-string to override --set, got %v", image["tag"])
+	}
+	if got["build"] != "0123" {
+		t.Errorf("expected build to stay a string, got %v (%T)", got["build"], got["build"])
+	}
+	if got["auth"].(map[string]interface{})["enabled"] != true {
+		t.Errorf("expected auth.enabled=true, got %v", got["auth"])
+	}
+	if got["tls"].(map[string]interface{})["ca"] != "CERT" {
+		t.Errorf("expected file content for tls.ca, got %v", got["tls"])
+	}
+}
+
+func TestSetValuesParse_Invalid(t *testing.T) {
+	if _, err := (SetValues{Values: []string{"noequals"}}).Parse(); err == nil {
+		t.Error("expected error for malformed --set")
+	}
+	if _, err := (SetValues{FileValues: []string{"key=/nonexistent/file"}}).Parse(); err == nil {
+		t.Error("expected error for missing --set-file")
+	}
+}
+
+func TestSetValuesEmpty(t *testing.T) {
+	if !(SetValues{}).Empty() {
+		t.Error("expected zero SetValues to be empty")
+	}
+	if (SetValues{StringValues: []string{"a=b"}}).Empty() {
+		t.Error("expected SetValues with overrides not to be empty")
+	}
+}
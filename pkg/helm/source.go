@@ -0,0 +1,216 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// ChartSource fetches a specific version of a chart: its default values, values.yaml with
+// comments, schema and metadata
+type ChartSource interface {
+	GetChart(ctx context.Context, chartName, version string) (*ChartInfo, error)
+}
+
+// NewChartSource returns the source for a chart repository reference: an OCI registry for
+// oci:// references, a local directory for file:// references and existing directories,
+// and an HTTP chart repository otherwise
+func NewChartSource(repository string) ChartSource {
+	if strings.HasPrefix(repository, "oci://") {
+		return &OCISource{Registry: repository}
+	}
+	if path, ok := strings.CutPrefix(repository, "file://"); ok {
+		return &DirSource{Path: path}
+	}
+	if info, err := os.Stat(repository); err == nil && info.IsDir() {
+		return &DirSource{Path: repository}
+	}
+	return &RepoSource{URL: repository}
+}
+
+// RepoSource fetches charts from an HTTP chart repository
+type RepoSource struct {
+	URL string
+}
+
+// GetChart pulls a chart version from the repository
+func (s *RepoSource) GetChart(ctx context.Context, chartName, version string) (*ChartInfo, error) {
+	return GetChartByVersion(ctx, s.URL, chartName, version)
+}
+
+// OCISource fetches charts from an OCI registry, e.g. oci://ghcr.io/org/charts
+type OCISource struct {
+	Registry string
+}
+
+// GetChart pulls a chart version from the registry, using the credentials of helm registry login
+func (s *OCISource) GetChart(ctx context.Context, chartName, version string) (*ChartInfo, error) {
+	chartRef := strings.TrimSuffix(s.Registry, "/") + "/" + chartName
+	info, err := tryPullChart(ctx, chartRef, version, "", newSettings())
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull %s: %w", chartRef, err)
+	}
+	return info, nil
+}
+
+// DirSource reads charts from a local directory. The directory is either a chart itself, or
+// holds chart directories and packaged .tgz charts, e.g. the charts/ of an umbrella chart
+type DirSource struct {
+	Path string
+}
+
+// GetChart loads the chart in the directory with a matching name and version
+func (s *DirSource) GetChart(ctx context.Context, chartName, version string) (*ChartInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	candidates := []string{s.Path}
+	if _, err := os.Stat(filepath.Join(s.Path, chartutil.ChartfileName)); err != nil {
+		entries, err := os.ReadDir(s.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chart directory: %w", err)
+		}
+		candidates = candidates[:0]
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasSuffix(entry.Name(), ".tgz") {
+				candidates = append(candidates, filepath.Join(s.Path, entry.Name()))
+			}
+		}
+	}
+
+	for _, path := range candidates {
+		loaded, err := loader.Load(path)
+		if err != nil {
+			// Not every directory next to a chart is one
+			continue
+		}
+		if loaded.Name() == chartName && loaded.Metadata.Version == version {
+			return newChartInfo(loaded)
+		}
+	}
+	return nil, fmt.Errorf("chart %s version %s not found in %s", chartName, version, s.Path)
+}
+
+// MemorySource serves charts held in memory, for tests and callers that already have the charts
+type MemorySource struct {
+	mu     sync.RWMutex
+	charts map[string]*ChartInfo
+}
+
+// NewMemorySource returns an empty in-memory chart source
+func NewMemorySource() *MemorySource {
+	return &MemorySource{charts: make(map[string]*ChartInfo)}
+}
+
+// Add makes a chart available under its name and version
+func (s *MemorySource) Add(c *chart.Chart) error {
+	info, err := newChartInfo(c)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.charts[chartKey(info.Name, info.Version)] = info
+	return nil
+}
+
+// AddValues makes a chart with only a values.yaml available
+func (s *MemorySource) AddValues(chartName, version, valuesYAML string) error {
+	return s.Add(&chart.Chart{
+		Metadata: &chart.Metadata{Name: chartName, Version: version, APIVersion: chart.APIVersionV2},
+		Raw:      []*chart.File{{Name: chartutil.ValuesfileName, Data: []byte(valuesYAML)}},
+	})
+}
+
+// GetChart returns a previously added chart
+func (s *MemorySource) GetChart(ctx context.Context, chartName, version string) (*ChartInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	info, ok := s.charts[chartKey(chartName, version)]
+	if !ok {
+		return nil, fmt.Errorf("chart %s version %s not found", chartName, version)
+	}
+	return info, nil
+}
+
+// CachedSource remembers the charts fetched from another source. Published chart versions don't
+// change, so cached charts never expire. Concurrent requests for the same chart share one fetch,
+// which runs apart from any one request so that a canceled caller doesn't fail the others
+type CachedSource struct {
+	source  ChartSource
+	timeout time.Duration
+	mu      sync.Mutex
+	charts  map[string]*cachedChart
+}
+
+// cachedChart is a chart that has been or is being fetched; done is closed once it is fetched
+type cachedChart struct {
+	done chan struct{}
+	info *ChartInfo
+	err  error
+}
+
+// NewCachedSource returns a source that caches the charts fetched from source. Each fetch is
+// aborted after timeout; a timeout of 0 means no limit
+func NewCachedSource(source ChartSource, timeout time.Duration) *CachedSource {
+	return &CachedSource{source: source, timeout: timeout, charts: make(map[string]*cachedChart)}
+}
+
+// GetChart returns a cached chart, fetching it first if it isn't cached yet. It stops waiting
+// when ctx is done, leaving the fetch running for the other callers. Failed fetches are not
+// cached, the next request tries again
+func (s *CachedSource) GetChart(ctx context.Context, chartName, version string) (*ChartInfo, error) {
+	key := chartKey(chartName, version)
+
+	s.mu.Lock()
+	entry, cached := s.charts[key]
+	if !cached {
+		entry = &cachedChart{done: make(chan struct{})}
+		s.charts[key] = entry
+		go s.fetch(context.WithoutCancel(ctx), key, entry, chartName, version)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-entry.done:
+		return entry.info, entry.err
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+// fetch fetches a chart into entry and closes its done channel
+func (s *CachedSource) fetch(ctx context.Context, key string, entry *cachedChart, chartName, version string) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, s.timeout, fmt.Errorf("fetching chart %s %s timed out after %s", chartName, version, s.timeout))
+		defer cancel()
+	}
+
+	entry.info, entry.err = s.source.GetChart(ctx, chartName, version)
+	if entry.err != nil {
+		s.mu.Lock()
+		delete(s.charts, key)
+		s.mu.Unlock()
+	}
+	close(entry.done)
+}
+
+// chartKey identifies a chart version in a MemorySource or CachedSource
+func chartKey(chartName, version string) string {
+	return chartName + "@" + version
+}
@@ -0,0 +1,237 @@
+package helm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+func TestNewChartSource(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		repository string
+		want       ChartSource
+	}{
+		{"https://charts.example.com", &RepoSource{URL: "https://charts.example.com"}},
+		{"oci://ghcr.io/org/charts", &OCISource{Registry: "oci://ghcr.io/org/charts"}},
+		{"file://../charts", &DirSource{Path: "../charts"}},
+		{dir, &DirSource{Path: dir}},
+		{filepath.Join(dir, "missing"), &RepoSource{URL: filepath.Join(dir, "missing")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repository, func(t *testing.T) {
+			got := NewChartSource(tt.repository)
+			switch want := tt.want.(type) {
+			case *RepoSource:
+				if s, ok := got.(*RepoSource); !ok || *s != *want {
+					t.Errorf("NewChartSource() = %#v, want %#v", got, want)
+				}
+			case *OCISource:
+				if s, ok := got.(*OCISource); !ok || *s != *want {
+					t.Errorf("NewChartSource() = %#v, want %#v", got, want)
+				}
+			case *DirSource:
+				if s, ok := got.(*DirSource); !ok || *s != *want {
+					t.Errorf("NewChartSource() = %#v, want %#v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDirSource(t *testing.T) {
+	dir := t.TempDir()
+
+	v1 := testChart("app", "# Number of replicas\nreplicaCount: 1\n")
+	if err := chartutil.SaveDir(v1, dir); err != nil {
+		t.Fatalf("failed to save chart: %v", err)
+	}
+	v2 := testChart("app", "replicaCount: 2\n")
+	v2.Metadata.Version = "2.0.0"
+	if _, err := chartutil.Save(v2, dir); err != nil {
+		t.Fatalf("failed to package chart: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "not-a-chart"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+
+	source := &DirSource{Path: dir}
+	ctx := context.Background()
+
+	info, err := source.GetChart(ctx, "app", "1.0.0")
+	if err != nil {
+		t.Fatalf("GetChart() error = %v", err)
+	}
+	if info.Values != "# Number of replicas\nreplicaCount: 1\n\n" || info.Defaults["replicaCount"] != 1 {
+		t.Errorf("unexpected chart directory contents: %q %v", info.Values, info.Defaults)
+	}
+
+	info, err = source.GetChart(ctx, "app", "2.0.0")
+	if err != nil {
+		t.Fatalf("GetChart() error = %v", err)
+	}
+	if info.Defaults["replicaCount"] != 2 {
+		t.Errorf("expected the packaged chart, got %v", info.Defaults)
+	}
+
+	if _, err := source.GetChart(ctx, "app", "3.0.0"); err == nil {
+		t.Error("expected error for a version not in the directory")
+	}
+
+	// A chart directory itself is a source of that one chart
+	info, err = (&DirSource{Path: filepath.Join(dir, "app")}).GetChart(ctx, "app", "1.0.0")
+	if err != nil {
+		t.Fatalf("GetChart() error = %v", err)
+	}
+	if info.Version != "1.0.0" {
+		t.Errorf("expected version 1.0.0, got %s", info.Version)
+	}
+}
+
+func TestMemorySource(t *testing.T) {
+	source := NewMemorySource()
+	if err := source.AddValues("app", "1.0.0", "replicaCount: 1\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	db := testChart("db", "port: 5432\n")
+	db.Schema = []byte(`{"type": "object"}`)
+	if err := source.Add(db); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := source.AddValues("broken", "1.0.0", "key: [unclosed\n"); err == nil {
+		t.Error("expected error for invalid values")
+	}
+
+	ctx := context.Background()
+	info, err := source.GetChart(ctx, "app", "1.0.0")
+	if err != nil {
+		t.Fatalf("GetChart() error = %v", err)
+	}
+	if info.Defaults["replicaCount"] != 1 {
+		t.Errorf("unexpected defaults %v", info.Defaults)
+	}
+	if info, err := source.GetChart(ctx, "db", "1.0.0"); err != nil || string(info.Schema) != `{"type": "object"}` {
+		t.Errorf("expected the chart's schema to be kept, got %v", err)
+	}
+	if _, err := source.GetChart(ctx, "app", "2.0.0"); err == nil {
+		t.Error("expected error for a missing version")
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := source.GetChart(canceled, "app", "1.0.0"); err == nil {
+		t.Error("expected error for a canceled context")
+	}
+}
+
+// countingSource counts the charts fetched from the source it wraps
+type countingSource struct {
+	ChartSource
+	mu      sync.Mutex
+	fetches int
+}
+
+func (s *countingSource) GetChart(ctx context.Context, chartName, version string) (*ChartInfo, error) {
+	s.mu.Lock()
+	s.fetches++
+	s.mu.Unlock()
+	return s.ChartSource.GetChart(ctx, chartName, version)
+}
+
+func TestCachedSource(t *testing.T) {
+	memory := NewMemorySource()
+	if err := memory.AddValues("app", "1.0.0", "replicaCount: 1\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	counting := &countingSource{ChartSource: memory}
+	source := NewCachedSource(counting, 0)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := source.GetChart(ctx, "app", "1.0.0"); err != nil {
+				t.Errorf("GetChart() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if counting.fetches != 1 {
+		t.Errorf("expected the chart to be fetched once, got %d fetches", counting.fetches)
+	}
+
+	// Failures are retried on the next request
+	for i := 0; i < 2; i++ {
+		if _, err := source.GetChart(ctx, "app", "2.0.0"); err == nil {
+			t.Error("expected error for a missing version")
+		}
+	}
+	if counting.fetches != 3 {
+		t.Errorf("expected failed fetches not to be cached, got %d fetches", counting.fetches)
+	}
+}
+
+func TestCachedSource_CanceledCaller(t *testing.T) {
+	memory := NewMemorySource()
+	if err := memory.AddValues("app", "1.0.0", "replicaCount: 1\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	release := make(chan struct{})
+	slow := chartSourceFunc(func(ctx context.Context, chartName, version string) (*ChartInfo, error) {
+		select {
+		case <-release:
+			return memory.GetChart(ctx, chartName, version)
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		}
+	})
+	source := NewCachedSource(slow, time.Minute)
+
+	short, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := source.GetChart(short, "app", "1.0.0"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the first caller to time out, got %v", err)
+	}
+
+	// The fetch started for the first caller keeps running for the second one
+	result := make(chan error, 1)
+	go func() {
+		_, err := source.GetChart(context.Background(), "app", "1.0.0")
+		result <- err
+	}()
+	close(release)
+	if err := <-result; err != nil {
+		t.Errorf("expected the second caller to get the chart, got %v", err)
+	}
+}
+
+func TestCachedSource_Timeout(t *testing.T) {
+	blocking := chartSourceFunc(func(ctx context.Context, chartName, version string) (*ChartInfo, error) {
+		<-ctx.Done()
+		return nil, context.Cause(ctx)
+	})
+	source := NewCachedSource(blocking, 20*time.Millisecond)
+
+	if _, err := source.GetChart(context.Background(), "app", "1.0.0"); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected the fetch to time out, got %v", err)
+	}
+}
+
+// chartSourceFunc adapts a function to a ChartSource
+type chartSourceFunc func(ctx context.Context, chartName, version string) (*ChartInfo, error)
+
+func (f chartSourceFunc) GetChart(ctx context.Context, chartName, version string) (*ChartInfo, error) {
+	return f(ctx, chartName, version)
+}
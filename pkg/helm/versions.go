@@ -0,0 +1,116 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// LatestVersion is the version name that stands for the newest stable version of a chart
+const LatestVersion = "latest"
+
+// ListVersions downloads a repository's index and returns the versions of a chart,
+// newest first. Versions that are not valid semver are left out
+func ListVersions(ctx context.Context, repoURL, chartName string) ([]*semver.Version, error) {
+	settings := newSettings()
+
+	chartRepo, err := repo.NewChartRepository(&repo.Entry{Name: repoNameForURL(repoURL), URL: repoURL}, getter.All(settings))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chart repository: %w", err)
+	}
+	chartRepo.CachePath = settings.RepositoryCache
+
+	indexPath, err := runWithContext(ctx, chartRepo.DownloadIndexFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download repository index: %w", err)
+	}
+
+	index, err := repo.LoadIndexFile(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load repository index: %w", err)
+	}
+
+	entries, ok := index.Entries[chartName]
+	if !ok || len(entries) == 0 {
+		return nil, fmt.Errorf("chart %s not found in repository %s", chartName, repoURL)
+	}
+
+	versions := make([]*semver.Version, 0, len(entries))
+	for _, entry := range entries {
+		version, err := semver.NewVersion(entry.Version)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(semver.Collection(versions)))
+
+	return versions, nil
+}
+
+// ResolveVersion returns version unchanged, or the newest stable version of the chart
+// when version is "latest"
+func ResolveVersion(ctx context.Context, repoURL, chartName, version string) (string, error) {
+	if version != LatestVersion {
+		return version, nil
+	}
+
+	versions, err := ListVersions(ctx, repoURL, chartName)
+	if err != nil {
+		return "", err
+	}
+	for _, v := range versions {
+		if v.Prerelease() == "" {
+			return v.Original(), nil
+		}
+	}
+	return "", fmt.Errorf("no stable version of chart %s found in repository %s", chartName, repoURL)
+}
+
+// NewerVersions holds the newest stable versions of a chart above a current version.
+// A field is empty when there is no newer version of that kind
+type NewerVersions struct {
+	Patch string // Newest version with the same major and minor version
+	Minor string // Newest version with the same major version and a higher minor version
+	Major string // Newest version with a higher major version
+}
+
+// Outdated reports whether any newer version is available
+func (n *NewerVersions) Outdated() bool {
+	return n.Patch != "" || n.Minor != "" || n.Major != ""
+}
+
+// FindNewer returns the newest stable patch, minor and major versions above current.
+// versions must be sorted newest first, as returned by ListVersions
+func FindNewer(versions []*semver.Version, current string) (*NewerVersions, error) {
+	currentVersion, err := semver.NewVersion(current)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chart version %s: %w", current, err)
+	}
+
+	newer := &NewerVersions{}
+	for _, v := range versions {
+		if v.Prerelease() != "" || !v.GreaterThan(currentVersion) {
+			continue
+		}
+		switch {
+		case v.Major() != currentVersion.Major():
+			if newer.Major == "" {
+				newer.Major = v.Original()
+			}
+		case v.Minor() != currentVersion.Minor():
+			if newer.Minor == "" {
+				newer.Minor = v.Original()
+			}
+		default:
+			if newer.Patch == "" {
+				newer.Patch = v.Original()
+			}
+		}
+	}
+	return newer, nil
+}
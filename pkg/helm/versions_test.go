@@ -0,0 +1,121 @@
+package helm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+const testIndex = `apiVersion: v1
+entries:
+  app:
+  - name: app
+    version: 1.2.0
+  - name: app
+    version: 2.0.0-rc.1
+  - name: app
+    version: 1.10.1
+  - name: app
+    version: not-semver
+generated: "2024-01-01T00:00:00Z"
+`
+
+// indexServer serves a chart repository index and points Helm's cache at a temp directory
+func indexServer(t *testing.T) string {
+	t.Helper()
+	t.Setenv("HELM_REPOSITORY_CACHE", t.TempDir())
+	t.Setenv("HELM_REPOSITORY_CONFIG", t.TempDir()+"/repositories.yaml")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(testIndex))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestListVersions(t *testing.T) {
+	repoURL := indexServer(t)
+
+	versions, err := ListVersions(context.Background(), repoURL, "app")
+	if err != nil {
+		t.Fatalf("ListVersions() error = %v", err)
+	}
+
+	expected := []string{"2.0.0-rc.1", "1.10.1", "1.2.0"}
+	if len(versions) != len(expected) {
+		t.Fatalf("expected %d versions, got %v", len(expected), versions)
+	}
+	for i, want := range expected {
+		if versions[i].Original() != want {
+			t.Errorf("versions[%d] = %s, want %s", i, versions[i].Original(), want)
+		}
+	}
+
+	if _, err := ListVersions(context.Background(), repoURL, "missing"); err == nil {
+		t.Error("expected error for a chart that is not in the index")
+	}
+}
+
+func TestResolveVersion(t *testing.T) {
+	repoURL := indexServer(t)
+
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{"1.2.0", "1.2.0"},
+		{LatestVersion, "1.10.1"},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolveVersion(context.Background(), repoURL, "app", tt.version)
+		if err != nil {
+			t.Fatalf("ResolveVersion(%q) error = %v", tt.version, err)
+		}
+		if got != tt.expected {
+			t.Errorf("ResolveVersion(%q) = %s, want %s", tt.version, got, tt.expected)
+		}
+	}
+}
+
+func TestFindNewer(t *testing.T) {
+	var versions []*semver.Version
+	for _, v := range []string{"3.1.0", "3.0.0", "2.5.0-rc.1", "2.4.1", "2.4.0", "2.3.2", "2.3.1", "2.3.0"} {
+		versions = append(versions, semver.MustParse(v))
+	}
+
+	tests := []struct {
+		current  string
+		expected NewerVersions
+	}{
+		{"2.3.0", NewerVersions{Patch: "2.3.2", Minor: "2.4.1", Major: "3.1.0"}},
+		{"2.4.1", NewerVersions{Major: "3.1.0"}},
+		{"3.1.0", NewerVersions{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.current, func(t *testing.T) {
+			got, err := FindNewer(versions, tt.current)
+			if err != nil {
+				t.Fatalf("FindNewer() error = %v", err)
+			}
+			if *got != tt.expected {
+				t.Errorf("FindNewer() = %+v, want %+v", *got, tt.expected)
+			}
+			if got.Outdated() != (tt.expected != NewerVersions{}) {
+				t.Errorf("Outdated() = %v", got.Outdated())
+			}
+		})
+	}
+
+	if _, err := FindNewer(versions, "not-semver"); err == nil {
+		t.Error("expected error for an invalid current version")
+	}
+}
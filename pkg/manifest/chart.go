@@ -0,0 +1,157 @@
+package manifest
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// ChartFile is the name of the file holding a chart's metadata and dependencies
+const ChartFile = "Chart.yaml"
+
+// Chart is a chart whose Chart.yaml pins subcharts in its dependencies
+type Chart struct {
+	Path         string // Path to Chart.yaml
+	Name         string
+	Version      string
+	ValuesFile   string // values.yaml next to Chart.yaml, empty when the chart has none
+	Dependencies []*Dependency
+
+	file *File
+}
+
+// Dependency is a subchart declared in Chart.yaml
+type Dependency struct {
+	Name       string
+	Alias      string
+	Repository string // As written in Chart.yaml: a URL, a file:// path or a repository name
+	Version    string
+
+	chart       *Chart
+	versionNode *yaml.Node
+}
+
+// Key returns the top-level values key holding the subchart's overrides: its alias, or its name
+func (d *Dependency) Key() string {
+	if d.Alias != "" {
+		return d.Alias
+	}
+	return d.Name
+}
+
+// ParseChart reads the dependencies of a chart from its Chart.yaml
+func ParseChart(path string) (*Chart, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(content, doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	chart := &Chart{
+		Path: path,
+		file: &File{Path: path, indent: values.DetectIndent(string(content)), docs: []*yaml.Node{doc}},
+	}
+	if len(doc.Content) == 0 {
+		return chart, nil
+	}
+	root := doc.Content[0]
+	chart.Name = scalar(lookup(root, "name"))
+	chart.Version = scalar(lookup(root, "version"))
+
+	for _, node := range sequence(lookup(root, "dependencies")) {
+		chart.Dependencies = append(chart.Dependencies, &Dependency{
+			Name:        scalar(lookup(node, "name")),
+			Alias:       scalar(lookup(node, "alias")),
+			Repository:  scalar(lookup(node, "repository")),
+			Version:     scalar(lookup(node, "version")),
+			chart:       chart,
+			versionNode: lookup(node, "version"),
+		})
+	}
+
+	valuesFile := filepath.Join(filepath.Dir(path), "values.yaml")
+	if _, err := os.Stat(valuesFile); err == nil {
+		chart.ValuesFile = valuesFile
+	}
+
+	return chart, nil
+}
+
+// Dependency returns the dependency with the given alias, or with the given chart name when
+// no dependency has that alias. A chart name used by several aliased dependencies is ambiguous
+func (c *Chart) Dependency(name string) (*Dependency, error) {
+	var matches []*Dependency
+	for _, dependency := range c.Dependencies {
+		if dependency.Alias == name {
+			return dependency, nil
+		}
+		if dependency.Name == name {
+			matches = append(matches, dependency)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("dependency %s not found in %s", name, c.Path)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("chart %s is a dependency of %s more than once, select one by its alias", name, c.Path)
+	}
+}
+
+// Changed reports whether a dependency version in Chart.yaml was updated
+func (c *Chart) Changed() bool {
+	return c.file.Changed()
+}
+
+// Bytes encodes Chart.yaml with its updated dependency versions
+func (c *Chart) Bytes() ([]byte, error) {
+	return c.file.Bytes()
+}
+
+// SetVersion changes the version the dependency is pinned to in Chart.yaml
+func (d *Dependency) SetVersion(version string) error {
+	if d.versionNode == nil {
+		return fmt.Errorf("dependency %s does not pin a version", d.Key())
+	}
+	d.versionNode.Value = version
+	d.versionNode.Tag = "!!str"
+	d.Version = version
+	d.chart.file.changed = true
+	return nil
+}
+
+// ScanCharts walks a directory and returns every chart whose Chart.yaml declares dependencies.
+// Files that can't be parsed are skipped
+func ScanCharts(root string) ([]*Chart, error) {
+	var charts []*Chart
+	err := walkYAML(root, func(path string) {
+		if filepath.Base(path) != ChartFile {
+			return
+		}
+		chart, err := ParseChart(path)
+		if err != nil {
+			slog.Debug("skipping chart", "path", path, "error", err)
+			return
+		}
+		if len(chart.Dependencies) > 0 {
+			charts = append(charts, chart)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("scanned charts", "root", root, "charts", len(charts))
+	return charts, nil
+}
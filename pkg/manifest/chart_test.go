@@ -0,0 +1,122 @@
+package manifest
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const umbrellaChart = `apiVersion: v2
+name: platform
+version: 1.0.0
+dependencies:
+  - name: postgresql
+    version: 12.1.0
+    repository: https://charts.bitnami.com/bitnami
+    alias: db
+  - name: common
+    version: 0.1.0
+    repository: file://../common
+`
+
+func TestScanCharts(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"platform/Chart.yaml":  umbrellaChart,
+		"platform/values.yaml": "db:\n  auth:\n    username: app\n",
+		"common/Chart.yaml":    "apiVersion: v2\nname: common\nversion: 0.1.0\n",
+		"apps/release.yaml":    fluxRelease,
+	})
+
+	charts, err := ScanCharts(root)
+	if err != nil {
+		t.Fatalf("ScanCharts() error = %v", err)
+	}
+	if len(charts) != 1 {
+		t.Fatalf("expected only the chart with dependencies, got %d", len(charts))
+	}
+
+	chart := charts[0]
+	if chart.Name != "platform" || chart.ValuesFile != filepath.Join(root, "platform", "values.yaml") {
+		t.Errorf("unexpected chart %+v", chart)
+	}
+	if len(chart.Dependencies) != 2 {
+		t.Fatalf("expected 2 dependencies, got %d", len(chart.Dependencies))
+	}
+
+	tests := []struct {
+		dependency *Dependency
+		key        string
+		repository string
+		version    string
+	}{
+		{chart.Dependencies[0], "db", "https://charts.bitnami.com/bitnami", "12.1.0"},
+		{chart.Dependencies[1], "common", "file://../common", "0.1.0"},
+	}
+	for _, tt := range tests {
+		if tt.dependency.Key() != tt.key || tt.dependency.Repository != tt.repository || tt.dependency.Version != tt.version {
+			t.Errorf("unexpected dependency %+v, want key %s", tt.dependency, tt.key)
+		}
+	}
+}
+
+func TestChart_Dependency(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"Chart.yaml": umbrellaChart + `  - name: postgresql
+    version: 12.1.0
+    repository: https://charts.bitnami.com/bitnami
+    alias: analytics
+`,
+	})
+
+	chart, err := ParseChart(filepath.Join(root, "Chart.yaml"))
+	if err != nil {
+		t.Fatalf("ParseChart() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		wantKey string
+		wantErr bool
+	}{
+		{"db", "db", false},
+		{"analytics", "analytics", false},
+		{"common", "common", false},
+		{"postgresql", "", true},
+		{"redis", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dependency, err := chart.Dependency(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Dependency() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && dependency.Key() != tt.wantKey {
+				t.Errorf("Dependency() key = %s, want %s", dependency.Key(), tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestDependency_SetVersion(t *testing.T) {
+	root := writeTree(t, map[string]string{"Chart.yaml": umbrellaChart})
+
+	chart, err := ParseChart(filepath.Join(root, "Chart.yaml"))
+	if err != nil {
+		t.Fatalf("ParseChart() error = %v", err)
+	}
+	if chart.Changed() {
+		t.Error("expected a parsed chart to be unchanged")
+	}
+	if err := chart.Dependencies[0].SetVersion("16.0.0"); err != nil {
+		t.Fatalf("SetVersion() error = %v", err)
+	}
+
+	out, err := chart.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+	expected := strings.Replace(umbrellaChart, "version: 12.1.0", "version: 16.0.0", 1)
+	if !chart.Changed() || string(out) != expected {
+		t.Errorf("expected only the dependency version to change, got:\n%s", out)
+	}
+}
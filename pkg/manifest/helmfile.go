@@ -0,0 +1,249 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// DefaultEnvironment is the helmfile environment used when none is selected
+const DefaultEnvironment = "default"
+
+// Helmfile is a parsed helmfile.yaml. Only the template-free subset is understood: plain
+// values, plus references to the environment name, release name and namespace, and
+// environment values. Anything else in a template is reported as skipped
+type Helmfile struct {
+	Path        string
+	Environment string
+	Releases    []*HelmfileRelease
+
+	file *File
+}
+
+// HelmfileRelease is a release declared in a helmfile
+type HelmfileRelease struct {
+	Name        string
+	Namespace   string
+	Chart       string // Chart name without the repository prefix
+	Repository  string // Repository URL, empty when the chart is not from a known repository
+	Version     string
+	ValuesFiles []string // Values files relative to the working directory, in the order Helm applies them
+	Skipped     []string // Values entries that could not be used, with the reason
+
+	helmfile    *Helmfile
+	versionNode *yaml.Node
+}
+
+// templateExpr matches a single template action such as {{ .Environment.Name }}
+var templateExpr = regexp.MustCompile(`{{-?\s*([^{}]*?)\s*-?}}`)
+
+// ParseHelmfile reads a helmfile and resolves its releases for an environment
+func ParseHelmfile(path, environment string) (*Helmfile, error) {
+	if environment == "" {
+		environment = DefaultEnvironment
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read helmfile: %w", err)
+	}
+
+	helmfile := &Helmfile{
+		Path:        path,
+		Environment: environment,
+		file:        &File{Path: path, indent: values.DetectIndent(string(content))},
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		doc := &yaml.Node{}
+		if err := decoder.Decode(doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse helmfile (templated helmfiles are not supported): %w", err)
+		}
+		helmfile.file.docs = append(helmfile.file.docs, doc)
+	}
+
+	dir := filepath.Dir(path)
+	repositories := make(map[string]string)
+	envValues := make(values.Values)
+	envFound := environment == DefaultEnvironment
+
+	// Helmfile parts separated by --- are layered, so collect repositories and environments first
+	for _, doc := range helmfile.file.docs {
+		if len(doc.Content) == 0 {
+			continue
+		}
+		root := doc.Content[0]
+
+		if repos := lookup(root, "repositories"); repos != nil && repos.Kind == yaml.SequenceNode {
+			for _, repo := range repos.Content {
+				url := scalar(lookup(repo, "url"))
+				if scalar(lookup(repo, "oci")) == "true" && !strings.HasPrefix(url, "oci://") {
+					url = "oci://" + url
+				}
+				repositories[scalar(lookup(repo, "name"))] = url
+			}
+		}
+
+		if env := lookup(root, "environments", environment); env != nil {
+			envFound = true
+			for _, entry := range sequence(lookup(env, "values")) {
+				layer, err := environmentValues(entry, dir)
+				if err != nil {
+					return nil, err
+				}
+				envValues, _ = values.Coalesce([]values.Layer{{Values: envValues}, {Values: layer}})
+			}
+		}
+	}
+	if !envFound {
+		return nil, fmt.Errorf("environment %s is not defined in %s", environment, path)
+	}
+
+	for _, doc := range helmfile.file.docs {
+		if len(doc.Content) == 0 {
+			continue
+		}
+		for _, node := range sequence(lookup(doc.Content[0], "releases")) {
+			release := &HelmfileRelease{
+				Name:        scalar(lookup(node, "name")),
+				Namespace:   scalar(lookup(node, "namespace")),
+				Version:     scalar(lookup(node, "version")),
+				helmfile:    helmfile,
+				versionNode: lookup(node, "version"),
+			}
+
+			vars := map[string]string{
+				".Environment.Name":  environment,
+				".Release.Name":      release.Name,
+				".Release.Namespace": release.Namespace,
+			}
+
+			// Charts are referenced as <repository>/<chart>; local paths have no repository
+			chart := scalar(lookup(node, "chart"))
+			if repo, name, ok := strings.Cut(chart, "/"); ok && !strings.HasPrefix(chart, ".") && !strings.HasPrefix(chart, "/") {
+				release.Chart = name
+				release.Repository = repositories[repo]
+			} else {
+				release.Chart = chart
+			}
+
+			for _, entry := range sequence(lookup(node, "values")) {
+				if entry.Kind != yaml.ScalarNode {
+					release.Skipped = append(release.Skipped, "inline values (only values files are upgraded)")
+					continue
+				}
+				valuesFile, err := render(entry.Value, vars, envValues)
+				if err != nil {
+					release.Skipped = append(release.Skipped, fmt.Sprintf("%s (%v)", entry.Value, err))
+					continue
+				}
+				if !filepath.IsAbs(valuesFile) {
+					valuesFile = filepath.Join(dir, valuesFile)
+				}
+				release.ValuesFiles = append(release.ValuesFiles, valuesFile)
+			}
+
+			helmfile.Releases = append(helmfile.Releases, release)
+		}
+	}
+
+	slog.Debug("parsed helmfile",
+		"path", path,
+		"environment", environment,
+		"releases", len(helmfile.Releases),
+		"repositories", len(repositories),
+	)
+	return helmfile, nil
+}
+
+// Changed reports whether a release version in the helmfile was updated
+func (h *Helmfile) Changed() bool {
+	return h.file.Changed()
+}
+
+// Bytes encodes the helmfile with its updated release versions
+func (h *Helmfile) Bytes() ([]byte, error) {
+	return h.file.Bytes()
+}
+
+// SetVersion changes the chart version of the release in the helmfile
+func (r *HelmfileRelease) SetVersion(version string) error {
+	if r.versionNode == nil {
+		return fmt.Errorf("release %s does not pin a chart version", r.Name)
+	}
+	r.versionNode.Value = version
+	r.versionNode.Tag = "!!str"
+	r.Version = version
+	r.helmfile.file.changed = true
+	return nil
+}
+
+// environmentValues reads one entry of an environment's values: a file relative to the
+// helmfile, or an inline map
+func environmentValues(entry *yaml.Node, dir string) (values.Values, error) {
+	if entry.Kind == yaml.MappingNode {
+		var inline map[string]interface{}
+		if err := entry.Decode(&inline); err != nil {
+			return nil, fmt.Errorf("failed to read environment values: %w", err)
+		}
+		return values.FromMap(inline)
+	}
+
+	path := entry.Value
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	parsed, err := values.ParseFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read environment values: %w", err)
+	}
+	return parsed, nil
+}
+
+// render resolves the template actions in s that only reference variables or environment
+// values. Any other template action is an error
+func render(s string, vars map[string]string, envValues values.Values) (string, error) {
+	var unresolved []string
+	rendered := templateExpr.ReplaceAllStringFunc(s, func(action string) string {
+		expr := templateExpr.FindStringSubmatch(action)[1]
+		if value, ok := vars[expr]; ok {
+			return value
+		}
+		for _, prefix := range []string{".Values.", ".StateValues.", ".Environment.Values."} {
+			if path, ok := strings.CutPrefix(expr, prefix); ok {
+				if value, exists := envValues[strings.ReplaceAll(path, ".", "::")]; exists {
+					return fmt.Sprint(value)
+				}
+			}
+		}
+		unresolved = append(unresolved, action)
+		return action
+	})
+
+	if len(unresolved) > 0 {
+		return "", fmt.Errorf("unsupported template %s", strings.Join(unresolved, ", "))
+	}
+	return rendered, nil
+}
+
+// sequence returns the items of a sequence node, or nothing for any other node
+func sequence(node *yaml.Node) []*yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return node.Content
+}
@@ -0,0 +1,115 @@
+package manifest
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testHelmfile = `repositories:
+  - name: bitnami
+    url: https://charts.bitnami.com/bitnami
+
+environments:
+  default:
+    values:
+      - region: eu
+  prod:
+    values:
+      - env/prod.yaml
+
+---
+releases:
+  - name: db
+    namespace: data
+    chart: bitnami/postgresql
+    version: 12.1.0 # keep in sync with staging
+    values:
+      - values/db.yaml
+      - "values/db-{{ .Environment.Name }}.yaml"
+      - "values/{{ .Values.region }}/{{ .Release.Name }}.yaml"
+      - primary:
+          resources: {}
+      - "values/{{ requiredEnv \"TEAM\" }}.yaml"
+  - name: local
+    chart: ./charts/local
+`
+
+func TestParseHelmfile(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"helmfile.yaml": testHelmfile,
+		"env/prod.yaml": "region: us\n",
+	})
+	path := filepath.Join(root, "helmfile.yaml")
+
+	tests := []struct {
+		environment string
+		valuesFiles []string
+	}{
+		{"", []string{"values/db.yaml", "values/db-default.yaml", "values/eu/db.yaml"}},
+		{"prod", []string{"values/db.yaml", "values/db-prod.yaml", "values/us/db.yaml"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("environment "+tt.environment, func(t *testing.T) {
+			helmfile, err := ParseHelmfile(path, tt.environment)
+			if err != nil {
+				t.Fatalf("ParseHelmfile() error = %v", err)
+			}
+			if len(helmfile.Releases) != 2 {
+				t.Fatalf("expected 2 releases, got %d", len(helmfile.Releases))
+			}
+
+			db := helmfile.Releases[0]
+			if db.Chart != "postgresql" || db.Repository != "https://charts.bitnami.com/bitnami" || db.Version != "12.1.0" || db.Namespace != "data" {
+				t.Errorf("unexpected release %+v", db)
+			}
+			if len(db.ValuesFiles) != len(tt.valuesFiles) {
+				t.Fatalf("expected values files %v, got %v", tt.valuesFiles, db.ValuesFiles)
+			}
+			for i, want := range tt.valuesFiles {
+				if db.ValuesFiles[i] != filepath.Join(root, want) {
+					t.Errorf("values file %d = %s, want %s", i, db.ValuesFiles[i], want)
+				}
+			}
+			if len(db.Skipped) != 2 || !strings.Contains(db.Skipped[1], "unsupported template") {
+				t.Errorf("expected inline values and the requiredEnv template to be skipped, got %v", db.Skipped)
+			}
+
+			local := helmfile.Releases[1]
+			if local.Repository != "" || local.Chart != "./charts/local" {
+				t.Errorf("expected a local chart without repository, got %+v", local)
+			}
+		})
+	}
+
+	if _, err := ParseHelmfile(path, "staging"); err == nil {
+		t.Error("expected error for an undefined environment")
+	}
+}
+
+func TestHelmfileRelease_SetVersion(t *testing.T) {
+	root := writeTree(t, map[string]string{"helmfile.yaml": testHelmfile})
+
+	helmfile, err := ParseHelmfile(filepath.Join(root, "helmfile.yaml"), "")
+	if err != nil {
+		t.Fatalf("ParseHelmfile() error = %v", err)
+	}
+	if err := helmfile.Releases[0].SetVersion("16.0.0"); err != nil {
+		t.Fatalf("SetVersion() error = %v", err)
+	}
+	if err := helmfile.Releases[1].SetVersion("1.0.0"); err == nil {
+		t.Error("expected error for a release without a version")
+	}
+
+	if !helmfile.Changed() {
+		t.Error("expected the helmfile to be changed")
+	}
+	out, err := helmfile.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+	if !strings.Contains(string(out), "version: 16.0.0 # keep in sync with staging") {
+		t.Errorf("expected the version to be updated in place, got:\n%s", out)
+	}
+}
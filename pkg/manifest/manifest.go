@@ -0,0 +1,394 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// Kinds of GitOps resources that declare Helm releases
+const (
+	KindHelmRelease = "HelmRelease" // Flux helm-controller
+	KindApplication = "Application" // Argo CD
+)
+
+// Release is a Helm release declared by a GitOps resource, with its values inline
+type Release struct {
+	File       string
+	Kind       string
+	Name       string
+	Namespace  string
+	Chart      string
+	Repository string // Chart repository URL, empty when it could not be resolved
+	Version    string // Chart version, empty when the resource doesn't pin one
+	Values     values.Values
+
+	file        *File
+	sourceRef   string // Namespace and name of the Flux HelmRepository
+	versionNode *yaml.Node
+	valuesNode  *yaml.Node // Map of inline values, or a string holding them (Argo CD helm.values)
+}
+
+// File is a manifest file that declares one or more releases
+type File struct {
+	Path     string
+	Releases []*Release
+
+	docs    []*yaml.Node
+	indent  int
+	changed bool
+}
+
+// Changed reports whether a release in the file was updated
+func (f *File) Changed() bool {
+	return f.changed
+}
+
+// Bytes encodes the file with its updated releases. Comments and key order are kept
+func (f *File) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(f.indent)
+	for _, doc := range f.docs {
+		if err := encoder.Encode(doc); err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", f.Path, err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", f.Path, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ValuesYAML returns the inline values as a YAML document
+func (r *Release) ValuesYAML() (string, error) {
+	if r.valuesNode == nil {
+		return "", nil
+	}
+	if r.valuesNode.Kind == yaml.ScalarNode {
+		return r.valuesNode.Value, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(r.valuesNode); err != nil {
+		return "", fmt.Errorf("failed to encode values of %s: %w", r.Name, err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("failed to encode values of %s: %w", r.Name, err)
+	}
+	return buf.String(), nil
+}
+
+// SetValues replaces the inline values with a YAML document
+func (r *Release) SetValues(content string) error {
+	if r.valuesNode == nil {
+		return fmt.Errorf("release %s has no inline values", r.Name)
+	}
+
+	if r.valuesNode.Kind == yaml.ScalarNode {
+		r.valuesNode.Value = content
+		r.valuesNode.Style = yaml.LiteralStyle
+		r.file.changed = true
+		return nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return fmt.Errorf("failed to parse values of %s: %w", r.Name, err)
+	}
+	replacement := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(doc.Content) > 0 {
+		replacement = doc.Content[0]
+	}
+
+	// Keep the comments around the values key, and a comment block ending the content, such as
+	// the removed keys block, which the parser attaches to the document
+	replacement.HeadComment = r.valuesNode.HeadComment
+	replacement.LineComment = r.valuesNode.LineComment
+	replacement.FootComment = joinComments(replacement.FootComment, doc.FootComment)
+	if replacement.FootComment == "" {
+		replacement.FootComment = r.valuesNode.FootComment
+	}
+	*r.valuesNode = *replacement
+	r.file.changed = true
+	return nil
+}
+
+// SetVersion changes the chart version the resource deploys
+func (r *Release) SetVersion(version string) error {
+	if r.versionNode == nil {
+		return fmt.Errorf("release %s does not pin a chart version", r.Name)
+	}
+	r.versionNode.Value = version
+	r.versionNode.Tag = "!!str"
+	r.Version = version
+	r.file.changed = true
+	return nil
+}
+
+// Scan walks a directory, or reads a single file, and returns every manifest file that
+// declares Flux HelmReleases or Argo CD Applications deploying a chart from a Helm repository.
+// Files that are not valid YAML are skipped
+func Scan(root string) ([]*File, error) {
+	var (
+		files        []*File
+		repositories = make(map[string]string)
+	)
+
+	err := walkYAML(root, func(path string) {
+		file, err := parseFile(path, repositories)
+		if err != nil {
+			slog.Debug("skipping file", "path", path, "error", err)
+			return
+		}
+		if len(file.Releases) > 0 {
+			files = append(files, file)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// HelmRepositories can be declared anywhere in the tree, so resolve them last
+	for _, file := range files {
+		for _, release := range file.Releases {
+			if release.sourceRef != "" {
+				release.Repository = repositories[release.sourceRef]
+			}
+		}
+	}
+
+	slog.Debug("scanned manifests", "root", root, "files", len(files), "repositories", len(repositories))
+	return files, nil
+}
+
+// walkYAML calls fn for every YAML file under root, skipping hidden directories such as .git
+func walkYAML(root string, fn func(path string)) error {
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+			fn(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+	return nil
+}
+
+// parseFile reads every document of a manifest file, collecting releases and recording
+// Flux HelmRepository URLs by namespace and name
+func parseFile(path string, repositories map[string]string) (*File, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{Path: path, indent: values.DetectIndent(string(content))}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		doc := &yaml.Node{}
+		if err := decoder.Decode(doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		file.docs = append(file.docs, doc)
+
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		resource := doc.Content[0]
+
+		apiVersion := scalar(lookup(resource, "apiVersion"))
+		switch kind := scalar(lookup(resource, "kind")); {
+		case kind == KindHelmRelease && strings.HasPrefix(apiVersion, "helm.toolkit.fluxcd.io/"):
+			if release := parseHelmRelease(resource); release != nil {
+				file.add(release)
+			}
+		case kind == KindApplication && strings.HasPrefix(apiVersion, "argoproj.io/"):
+			for _, release := range parseApplication(resource) {
+				file.add(release)
+			}
+		case kind == "HelmRepository" && strings.HasPrefix(apiVersion, "source.toolkit.fluxcd.io/"):
+			name, namespace := metadata(resource)
+			url := scalar(lookup(resource, "spec", "url"))
+			if scalar(lookup(resource, "spec", "type")) == "oci" && !strings.HasPrefix(url, "oci://") {
+				url = "oci://" + url
+			}
+			repositories[namespace+"/"+name] = url
+		}
+	}
+
+	return file, nil
+}
+
+// add records a release declared in the file
+func (f *File) add(release *Release) {
+	release.File = f.Path
+	release.file = f
+	f.Releases = append(f.Releases, release)
+}
+
+// parseHelmRelease reads a Flux HelmRelease. Releases that reference an OCIRepository
+// through spec.chartRef instead of a chart template are skipped
+func parseHelmRelease(resource *yaml.Node) *Release {
+	chartSpec := lookup(resource, "spec", "chart", "spec")
+	if chartSpec == nil {
+		return nil
+	}
+
+	name, namespace := metadata(resource)
+	release := &Release{
+		Kind:        KindHelmRelease,
+		Name:        name,
+		Namespace:   namespace,
+		Chart:       scalar(lookup(chartSpec, "chart")),
+		versionNode: lookup(chartSpec, "version"),
+		valuesNode:  lookup(resource, "spec", "values"),
+	}
+	release.Version = scalar(release.versionNode)
+
+	// The HelmRepository is resolved once the whole tree is scanned
+	if kind := scalar(lookup(chartSpec, "sourceRef", "kind")); kind != "HelmRepository" {
+		slog.Debug("skipping HelmRelease without a HelmRepository source", "name", name, "sourceKind", kind)
+		return nil
+	}
+	sourceNamespace := scalar(lookup(chartSpec, "sourceRef", "namespace"))
+	if sourceNamespace == "" {
+		sourceNamespace = namespace
+	}
+	release.sourceRef = sourceNamespace + "/" + scalar(lookup(chartSpec, "sourceRef", "name"))
+
+	release.Values = parseValues(release)
+	return release
+}
+
+// parseApplication reads the Helm chart sources of an Argo CD Application, from spec.source
+// or every entry of spec.sources. Sources that point at a git path instead of a chart are skipped
+func parseApplication(resource *yaml.Node) []*Release {
+	var sources []*yaml.Node
+	if source := lookup(resource, "spec", "source"); source != nil {
+		sources = append(sources, source)
+	}
+	if list := lookup(resource, "spec", "sources"); list != nil && list.Kind == yaml.SequenceNode {
+		sources = append(sources, list.Content...)
+	}
+
+	name, namespace := metadata(resource)
+	if destination := scalar(lookup(resource, "spec", "destination", "namespace")); destination != "" {
+		namespace = destination
+	}
+
+	var releases []*Release
+	for _, source := range sources {
+		chart := scalar(lookup(source, "chart"))
+		if chart == "" {
+			continue
+		}
+
+		repository := scalar(lookup(source, "repoURL"))
+		if !strings.Contains(repository, "://") {
+			// Argo CD writes OCI registries without a scheme
+			repository = "oci://" + repository
+		}
+
+		release := &Release{
+			Kind:        KindApplication,
+			Name:        name,
+			Namespace:   namespace,
+			Chart:       chart,
+			Repository:  repository,
+			versionNode: lookup(source, "targetRevision"),
+		}
+		release.Version = scalar(release.versionNode)
+
+		// valuesObject takes precedence over the values string, as it does in Argo CD
+		release.valuesNode = lookup(source, "helm", "valuesObject")
+		if release.valuesNode == nil {
+			release.valuesNode = lookup(source, "helm", "values")
+		} else if lookup(source, "helm", "values") != nil {
+			slog.Warn("Application sets both helm.values and helm.valuesObject, only valuesObject is upgraded", "name", name)
+		}
+
+		release.Values = parseValues(release)
+		releases = append(releases, release)
+	}
+	return releases
+}
+
+// parseValues flattens the inline values of a release. Values that can't be parsed are
+// treated as empty
+func parseValues(release *Release) values.Values {
+	content, err := release.ValuesYAML()
+	if err == nil {
+		var parsed values.Values
+		if parsed, err = values.ParseYAML(content); err == nil {
+			return parsed
+		}
+	}
+	slog.Warn("failed to parse inline values", "kind", release.Kind, "name", release.Name, "error", err)
+	return values.Values{}
+}
+
+// metadata returns the name and namespace of a resource
+func metadata(resource *yaml.Node) (string, string) {
+	return scalar(lookup(resource, "metadata", "name")), scalar(lookup(resource, "metadata", "namespace"))
+}
+
+// lookup follows keys through nested maps and returns the value node, or nil
+func lookup(node *yaml.Node, keys ...string) *yaml.Node {
+	for _, key := range keys {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+				break
+			}
+		}
+		node = next
+	}
+	return node
+}
+
+// scalar returns the value of a scalar node, or "" for anything else
+func scalar(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
+
+// joinComments joins two comment blocks with a blank line, skipping empty ones
+func joinComments(first, second string) string {
+	if first == "" || second == "" {
+		return first + second
+	}
+	return first + "\n\n" + second
+}
@@ -0,0 +1,211 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const fluxRelease = `# Database for the apps
+apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: db
+  namespace: data
+spec:
+  chart:
+    spec:
+      chart: postgresql
+      version: "12.1.0" # pinned
+      sourceRef:
+        kind: HelmRepository
+        name: bitnami
+        namespace: flux-system
+  values:
+    # Bigger disk for prod
+    primary:
+      persistence:
+        size: 50Gi
+`
+
+const fluxRepository = `apiVersion: source.toolkit.fluxcd.io/v1
+kind: HelmRepository
+metadata:
+  name: bitnami
+  namespace: flux-system
+spec:
+  url: https://charts.bitnami.com/bitnami
+`
+
+const argoApplications = `apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: grafana
+  namespace: argocd
+spec:
+  destination:
+    namespace: monitoring
+  source:
+    repoURL: https://grafana.github.io/helm-charts
+    chart: grafana
+    targetRevision: 8.0.0
+    helm:
+      valuesObject:
+        replicas: 2
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: redis
+  namespace: argocd
+spec:
+  sources:
+  - repoURL: https://github.com/example/config.git
+    path: redis
+  - repoURL: registry-1.docker.io/bitnamicharts
+    chart: redis
+    targetRevision: 19.0.0
+    helm:
+      values: |
+        auth:
+          enabled: false
+`
+
+// writeTree writes files below a temp directory and returns its path
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	return root
+}
+
+func TestScan(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"apps/db/release.yaml":      fluxRelease,
+		"infra/sources/bitnami.yml": fluxRepository,
+		"apps/argo.yaml":            argoApplications,
+		"apps/configmap.yaml":       "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: x\n",
+		"apps/broken.yaml":          "{not: [valid",
+		".git/release.yaml":         fluxRelease,
+		"README.md":                 "# not yaml",
+	})
+
+	files, err := Scan(root)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	releases := make(map[string]*Release)
+	for _, file := range files {
+		for _, release := range file.Releases {
+			releases[release.Name] = release
+		}
+	}
+	if len(releases) != 3 {
+		t.Fatalf("expected 3 releases, got %d: %v", len(releases), releases)
+	}
+
+	tests := []struct {
+		name       string
+		kind       string
+		namespace  string
+		chart      string
+		repository string
+		version    string
+		valuesKey  string
+		value      interface{}
+	}{
+		{"db", KindHelmRelease, "data", "postgresql", "https://charts.bitnami.com/bitnami", "12.1.0", "primary::persistence::size", "50Gi"},
+		{"grafana", KindApplication, "monitoring", "grafana", "https://grafana.github.io/helm-charts", "8.0.0", "replicas", 2},
+		{"redis", KindApplication, "argocd", "redis", "oci://registry-1.docker.io/bitnamicharts", "19.0.0", "auth::enabled", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := releases[tt.name]
+			if release == nil {
+				t.Fatalf("release %s not found", tt.name)
+			}
+			if release.Kind != tt.kind || release.Namespace != tt.namespace || release.Chart != tt.chart {
+				t.Errorf("unexpected release %+v", release)
+			}
+			if release.Repository != tt.repository {
+				t.Errorf("repository = %q, want %q", release.Repository, tt.repository)
+			}
+			if release.Version != tt.version {
+				t.Errorf("version = %q, want %q", release.Version, tt.version)
+			}
+			if release.Values[tt.valuesKey] != tt.value {
+				t.Errorf("values[%s] = %v, want %v", tt.valuesKey, release.Values[tt.valuesKey], tt.value)
+			}
+		})
+	}
+}
+
+func TestRelease_Update(t *testing.T) {
+	root := writeTree(t, map[string]string{"release.yaml": fluxRelease + "---\n" + argoApplications})
+
+	files, err := Scan(root)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Scan() = %v, %v", files, err)
+	}
+	file := files[0]
+	if file.Changed() {
+		t.Error("expected an unchanged file before updating")
+	}
+
+	db, redis := file.Releases[0], file.Releases[2]
+	if err := db.SetVersion("16.0.0"); err != nil {
+		t.Fatalf("SetVersion() error = %v", err)
+	}
+	content, err := db.ValuesYAML()
+	if err != nil {
+		t.Fatalf("ValuesYAML() error = %v", err)
+	}
+	if err := db.SetValues(strings.Replace(content, "50Gi", "100Gi", 1)); err != nil {
+		t.Fatalf("SetValues() error = %v", err)
+	}
+	if err := redis.SetValues("auth:\n  enabled: true\n"); err != nil {
+		t.Fatalf("SetValues() error = %v", err)
+	}
+
+	if !file.Changed() {
+		t.Error("expected the file to be changed")
+	}
+	out, err := file.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"# Database for the apps",
+		`version: "16.0.0" # pinned`,
+		"    # Bigger disk for prod\n    primary:\n      persistence:\n        size: 100Gi",
+		"values: |\n",
+		"enabled: true",
+		"---\n",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestRelease_SetVersionWithoutPin(t *testing.T) {
+	release := &Release{Name: "app", file: &File{}}
+	if err := release.SetVersion("1.0.0"); err == nil {
+		t.Error("expected error for a release without a pinned version")
+	}
+	if err := release.SetValues("a: 1\n"); err == nil {
+		t.Error("expected error for a release without inline values")
+	}
+}
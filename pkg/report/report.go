@@ -0,0 +1,342 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+
+	"github.com/itsvictorfy/hvu/pkg/service"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// Input contains the upgrade details rendered into a report
+type Input struct {
+	Chart       string
+	Repository  string
+	FromVersion string
+	ToVersion   string
+	Output      *service.UpgradeOutput
+}
+
+// changelogHeading matches changelog section headings such as "## 16.0.0 (2024-06-24)" or "## [v1.2.3]"
+var changelogHeading = regexp.MustCompile(`^#{1,3}\s+\[?v?(\d+\.\d+\.\d+[0-9A-Za-z.+-]*)\]?`)
+
+// WriteFile renders the markdown report and writes it to path
+func WriteFile(path string, input *Input) error {
+	if err := os.WriteFile(path, []byte(Markdown(input)), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// Markdown renders a markdown report of an upgrade, suitable for pull request descriptions
+func Markdown(input *Input) string {
+	var b strings.Builder
+	output := input.Output
+	classification := output.Classification
+
+	fmt.Fprintf(&b, "# Helm values upgrade: %s %s → %s\n\n", input.Chart, input.FromVersion, input.ToVersion)
+
+	b.WriteString("| | |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Chart | `%s` |\n", input.Chart)
+	if input.Repository != "" {
+		fmt.Fprintf(&b, "| Repository | %s |\n", input.Repository)
+	}
+	fmt.Fprintf(&b, "| From | `%s` |\n", input.FromVersion)
+	fmt.Fprintf(&b, "| To | `%s` |\n", input.ToVersion)
+	b.WriteString("\n")
+
+	b.WriteString("## Summary\n\n")
+	fmt.Fprintf(&b, "- %d customizations preserved\n", classification.Customized)
+	fmt.Fprintf(&b, "- %d defaults updated to new version\n", len(output.UpdatedDefaults))
+	if classification.Removed > 0 {
+		fmt.Fprintf(&b, "- %d keys removed in target chart\n", classification.Removed)
+	}
+	if classification.Unknown > 0 {
+		fmt.Fprintf(&b, "- %d unknown keys kept (review recommended)\n", classification.Unknown)
+	}
+	if len(output.NoOpDeletions) > 0 {
+		fmt.Fprintf(&b, "- %d null deletions dropped, the keys no longer exist\n", len(output.NoOpDeletions))
+	}
+	if len(output.Conflicts) > 0 {
+		fmt.Fprintf(&b, "- %d customizations whose chart default also changed\n", len(output.Conflicts))
+	}
+	if classification.Ignored > 0 {
+		fmt.Fprintf(&b, "- %d keys ignored by policy\n", classification.Ignored)
+	}
+	if len(output.SchemaViolations) > 0 {
+		fmt.Fprintf(&b, "- %d schema violations in upgraded values\n", len(output.SchemaViolations))
+	}
+	if len(output.CustomImageTags) > 0 {
+		fmt.Fprintf(&b, "- %d custom image tags %s\n", len(output.CustomImageTags), imageDecision(output.ImageTagsUpgraded))
+	}
+	if len(output.SecretMigrations) > 0 {
+		fmt.Fprintf(&b, "- %d hardcoded credentials can move to an existing Secret\n", len(output.SecretMigrations))
+	}
+	b.WriteString("\n")
+
+	if classification.Customized > 0 {
+		b.WriteString("## Preserved customizations\n\n")
+		if len(output.Layers) > 0 {
+			// Name the values file that set each key when several are layered
+			b.WriteString("| Key | Value | Old default | File |\n|-----|-------|-------------|------|\n")
+		} else {
+			b.WriteString("| Key | Value | Old default |\n|-----|-------|-------------|\n")
+		}
+		for _, entry := range classification.Entries {
+			if entry.Classification != values.Customized {
+				continue
+			}
+			if len(output.Layers) > 0 {
+				fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", keyCell(entry.Path), valueCell(entry.UserValue), valueCell(entry.DefaultValue), codeCell(entry.Source))
+			} else {
+				fmt.Fprintf(&b, "| %s | %s | %s |\n", keyCell(entry.Path), valueCell(entry.UserValue), valueCell(entry.DefaultValue))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	if len(output.Conflicts) > 0 {
+		b.WriteString("## Conflicts\n\n")
+		b.WriteString("These customizations were preserved, but the chart default changed as well.\n\n")
+		b.WriteString("| Key | Value | Old default | New default |\n|-----|-------|-------------|-------------|\n")
+		for _, conflict := range output.Conflicts {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n",
+				keyCell(conflict.Path),
+				valueCell(conflict.UserValue),
+				valueCell(conflict.OldDefault),
+				valueCell(conflict.NewDefault),
+			)
+		}
+		b.WriteString("\n")
+	}
+
+	if !output.Policy.Empty() {
+		b.WriteString("## Policy\n\n")
+		b.WriteString("| Key | Action | Value | Old default | New default |\n|-----|--------|-------|-------------|-------------|\n")
+		for _, change := range output.Policy.Pinned {
+			fmt.Fprintf(&b, "| %s | pinned | %s | %s | %s |\n", keyCell(change.Path), valueCell(change.OldValue), valueCell(change.OldValue), valueCell(change.NewValue))
+		}
+		for _, change := range output.Policy.ForcedUpdates {
+			fmt.Fprintf(&b, "| %s | updated | %s | | %s |\n", keyCell(change.Path), valueCell(change.OldValue), valueCell(change.NewValue))
+		}
+		for _, change := range output.Policy.ReviewRequired {
+			fmt.Fprintf(&b, "| %s | review required | | %s | %s |\n", keyCell(change.Path), valueCell(change.OldValue), valueCell(change.NewValue))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(output.UpdatedDefaults) > 0 {
+		b.WriteString("## Updated defaults\n\n")
+		b.WriteString("| Key | Old default | New default |\n|-----|-------------|-------------|\n")
+		for _, change := range output.UpdatedDefaults {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", keyCell(change.Path), valueCell(change.OldValue), valueCell(change.NewValue))
+		}
+		b.WriteString("\n")
+	}
+
+	if classification.Removed > 0 {
+		b.WriteString("## Removed keys\n\n")
+		b.WriteString("These keys no longer exist in the target chart.\n\n")
+		b.WriteString("| Key | Value | Old default |\n|-----|-------|-------------|\n")
+		for _, entry := range classification.Entries {
+			if entry.Classification == values.RemovedInTarget {
+				fmt.Fprintf(&b, "| %s | %s | %s |\n", keyCell(entry.Path), valueCell(entry.UserValue), valueCell(entry.DefaultValue))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	if len(output.RemovedOverrides) > 0 {
+		b.WriteString("## Removed --set overrides\n\n")
+		b.WriteString("These `--set` keys no longer exist in the target chart; update the deploy scripts that pass them.\n\n")
+		b.WriteString("| Key | Value | Likely new key |\n|-----|-------|----------------|\n")
+		for _, override := range output.RemovedOverrides {
+			renamedTo := make([]string, len(override.RenamedTo))
+			for i, candidate := range override.RenamedTo {
+				renamedTo[i] = keyCell(candidate)
+			}
+			if len(renamedTo) == 0 {
+				renamedTo = []string{"_none_"}
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", keyCell(override.Path), valueCell(override.Value), strings.Join(renamedTo, ", "))
+		}
+		b.WriteString("\n")
+	}
+
+	if classification.Unknown > 0 {
+		b.WriteString("## Unknown keys\n\n")
+		b.WriteString("These keys are not in the chart defaults and were kept as-is.\n\n")
+		b.WriteString("| Key | Value |\n|-----|-------|\n")
+		for _, entry := range classification.Entries {
+			if entry.Classification == values.Unknown {
+				fmt.Fprintf(&b, "| %s | %s |\n", keyCell(entry.Path), valueCell(entry.UserValue))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	if classification.Deletions > 0 {
+		noOps := make(map[string]bool, len(output.NoOpDeletions))
+		for _, path := range output.NoOpDeletions {
+			noOps[path] = true
+		}
+
+		b.WriteString("## Deletions\n\n")
+		b.WriteString("These keys are set to null to delete the chart default.\n\n")
+		b.WriteString("| Key | Result |\n|-----|--------|\n")
+		for _, entry := range classification.Entries {
+			if entry.Classification != values.Deletion {
+				continue
+			}
+			result := "kept"
+			if noOps[entry.Path] {
+				result = "dropped, no longer in the target chart"
+			}
+			fmt.Fprintf(&b, "| %s | %s |\n", keyCell(entry.Path), result)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(output.CustomImageTags) > 0 {
+		b.WriteString("## Image tags\n\n")
+		b.WriteString("| Key | Current | Old default | New default | Decision |\n|-----|---------|-------------|-------------|----------|\n")
+		for _, change := range output.CustomImageTags {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n",
+				keyCell(change.Path),
+				valueCell(change.UserTag),
+				valueCell(change.OldDefault),
+				valueCell(change.NewDefault),
+				imageDecision(output.ImageTagsUpgraded),
+			)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(output.SecretMigrations) > 0 {
+		b.WriteString("## Recommended secret migrations\n\n")
+		b.WriteString("The target chart can read these credentials from an existing Secret. Move them into a Secret and set the new key instead of keeping them in the values file.\n\n")
+		b.WriteString("| Key | New key |\n|-----|---------|\n")
+		for _, migration := range output.SecretMigrations {
+			fmt.Fprintf(&b, "| %s | %s |\n", keyCell(migration.Path), keyCell(migration.SecretKey))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(output.SchemaViolations) > 0 {
+		b.WriteString("## Schema violations\n\n")
+		for _, violation := range output.SchemaViolations {
+			fmt.Fprintf(&b, "- %s\n", strings.ReplaceAll(escapeCell(violation), "`", "\\`"))
+		}
+		b.WriteString("\n")
+	}
+
+	if entries := changelogBetween(output.Changelog, input.FromVersion, input.ToVersion); entries != "" {
+		b.WriteString("## Changelog\n\n")
+		b.WriteString(entries)
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// imageDecision describes what happened to custom image tags
+func imageDecision(upgraded bool) string {
+	if upgraded {
+		return "upgraded to new defaults"
+	}
+	return "preserved"
+}
+
+// keyCell formats a path for a markdown table cell
+func keyCell(path string) string {
+	return codeCell(values.PathToDisplayFormat(path))
+}
+
+// valueCell formats a value for a markdown table cell
+func valueCell(v interface{}) string {
+	if v == nil {
+		return "_none_"
+	}
+	return codeCell(values.FormatValue(v))
+}
+
+// codeCell formats s as inline code for a markdown table cell. The code span is delimited by
+// more backticks than s contains in a row, so backticks in s are shown as they are
+func codeCell(s string) string {
+	s = escapeCell(s)
+
+	longest, run := 0, 0
+	for _, c := range s {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		// A space keeps a backtick at either end from joining the fence; markdown strips it
+		return fence + " " + s + " " + fence
+	}
+	return fence + s + fence
+}
+
+// escapeCell escapes the characters that would break a markdown table row. Line breaks can't
+// be escaped and become spaces
+func escapeCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	s = strings.ReplaceAll(s, "\n", " ")
+	return s
+}
+
+// changelogBetween extracts the changelog sections for versions newer than from, up to and including to.
+// Headings are demoted one level so they nest under the report's Changelog section
+func changelogBetween(changelog, from, to string) string {
+	if changelog == "" {
+		return ""
+	}
+
+	fromVersion, err := semver.NewVersion(from)
+	if err != nil {
+		return ""
+	}
+	toVersion, err := semver.NewVersion(to)
+	if err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	include := false
+
+	scanner := bufio.NewScanner(strings.NewReader(changelog))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if match := changelogHeading.FindStringSubmatch(line); match != nil {
+			version, err := semver.NewVersion(match[1])
+			include = err == nil && version.GreaterThan(fromVersion) && !version.GreaterThan(toVersion)
+		}
+
+		if !include {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			line = "#" + line
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+
+	entries := strings.TrimSpace(b.String())
+	if entries == "" {
+		return ""
+	}
+	return entries + "\n"
+}
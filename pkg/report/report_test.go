@@ -0,0 +1,280 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itsvictorfy/hvu/pkg/service"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+func testInput() *Input {
+	return &Input{
+		Chart:       "postgresql",
+		Repository:  "https://charts.bitnami.com/bitnami",
+		FromVersion: "12.1.0",
+		ToVersion:   "16.0.0",
+		Output: &service.UpgradeOutput{
+			Classification: &values.ClassificationResult{
+				Entries: []values.ClassifiedValue{
+					{Path: "auth::database", UserValue: "app", DefaultValue: "", Classification: values.Customized},
+					{Path: "image::tag", UserValue: "15.1.0", DefaultValue: "15.1.0", Classification: values.CopiedDefault},
+					{Path: "legacy::flag", UserValue: true, Classification: values.Unknown},
+					{Path: "primary::oldSetting", UserValue: "on", DefaultValue: "off", Classification: values.RemovedInTarget},
+				},
+				Customized:    1,
+				CopiedDefault: 1,
+				Unknown:       1,
+				Removed:       1,
+				Total:         4,
+			},
+			UpdatedDefaults: []values.ValueChange{
+				{Path: "image::tag", OldValue: "15.1.0", NewValue: "16.2.0"},
+			},
+			Conflicts: []values.Conflict{
+				{Path: "primary::replicaCount", UserValue: 3, OldDefault: 1, NewDefault: 2},
+			},
+			SchemaViolations: []string{"at '/auth/database': got number, want string"},
+			Policy: &values.PolicyReport{
+				Pinned:         []values.ValueChange{{Path: "persistence::size", OldValue: "8Gi", NewValue: "10Gi"}},
+				ReviewRequired: []values.ValueChange{{Path: "resources::limits::cpu", OldValue: "100m", NewValue: "200m"}},
+			},
+			CustomImageTags: []values.ImageChange{
+				{Path: "metrics::image::tag", UserTag: "0.10.0", OldDefault: "0.11.0", NewDefault: "0.15.0", IsCustomized: true},
+			},
+		},
+	}
+}
+
+func TestMarkdown_Sections(t *testing.T) {
+	md := Markdown(testInput())
+
+	expected := []string{
+		"# Helm values upgrade: postgresql 12.1.0 → 16.0.0",
+		"| Repository | https://charts.bitnami.com/bitnami |",
+		"## Preserved customizations",
+		"| `auth.database` | `app` | `` |",
+		"## Updated defaults",
+		"| `image.tag` | `15.1.0` | `16.2.0` |",
+		"## Removed keys",
+		"| `primary.oldSetting` | `on` | `off` |",
+		"## Unknown keys",
+		"| `legacy.flag` | `true` |",
+		"## Conflicts",
+		"| `primary.replicaCount` | `3` | `1` | `2` |",
+		"## Policy",
+		"| `persistence.size` | pinned | `8Gi` | `8Gi` | `10Gi` |",
+		"| `resources.limits.cpu` | review required | | `100m` | `200m` |",
+		"## Schema violations",
+		"- at '/auth/database': got number, want string",
+		"## Image tags",
+		"| `metrics.image.tag` | `0.10.0` | `0.11.0` | `0.15.0` | preserved |",
+	}
+
+	for _, want := range expected {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected report to contain %q\n%s", want, md)
+		}
+	}
+
+	if strings.Contains(md, "## Changelog") {
+		t.Error("expected no changelog section when chart ships no changelog")
+	}
+}
+
+func TestMarkdown_OmitsEmptySections(t *testing.T) {
+	input := testInput()
+	input.Output.Classification = &values.ClassificationResult{}
+	input.Output.UpdatedDefaults = nil
+	input.Output.CustomImageTags = nil
+	input.Output.Conflicts = nil
+	input.Output.SchemaViolations = nil
+
+	md := Markdown(input)
+
+	for _, section := range []string{"## Preserved customizations", "## Conflicts", "## Updated defaults", "## Removed keys", "## Unknown keys", "## Image tags", "## Schema violations"} {
+		if strings.Contains(md, section) {
+			t.Errorf("expected %q to be omitted", section)
+		}
+	}
+	if !strings.Contains(md, "## Summary") {
+		t.Error("expected summary section")
+	}
+}
+
+func TestMarkdown_LayeredSources(t *testing.T) {
+	input := testInput()
+	input.Output.Classification.Entries[0].Source = "prod.yaml"
+	input.Output.Layers = []service.LayerOutput{{ValuesFile: "base.yaml"}, {ValuesFile: "prod.yaml"}}
+
+	md := Markdown(input)
+
+	if !strings.Contains(md, "| `auth.database` | `app` | `` | `prod.yaml` |") {
+		t.Errorf("expected customization attributed to prod.yaml, got:\n%s", md)
+	}
+}
+
+func TestMarkdown_RemovedOverrides(t *testing.T) {
+	input := testInput()
+	input.Output.RemovedOverrides = []service.RemovedOverride{
+		{Path: "postgresqlPassword", Value: "secret", RenamedTo: []string{"auth::postgresPassword"}},
+		{Path: "legacy", Value: true},
+	}
+
+	md := Markdown(input)
+
+	for _, want := range []string{
+		"## Removed --set overrides",
+		"| `postgresqlPassword` | `secret` | `auth.postgresPassword` |",
+		"| `legacy` | `true` | _none_ |",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected report to contain %q, got:\n%s", want, md)
+		}
+	}
+}
+
+func TestMarkdown_SecretMigrations(t *testing.T) {
+	input := testInput()
+	input.Output.SecretMigrations = []values.SecretMigration{
+		{Path: "auth::postgresPassword", SecretKey: "auth::existingSecret"},
+	}
+
+	md := Markdown(input)
+
+	for _, want := range []string{
+		"- 1 hardcoded credentials can move to an existing Secret",
+		"## Recommended secret migrations",
+		"| `auth.postgresPassword` | `auth.existingSecret` |",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected report to contain %q, got:\n%s", want, md)
+		}
+	}
+	if strings.Contains(Markdown(testInput()), "## Recommended secret migrations") {
+		t.Error("expected no secret migrations section without migrations")
+	}
+}
+
+func TestMarkdown_Deletions(t *testing.T) {
+	input := testInput()
+	classification := input.Output.Classification
+	classification.Entries = append(classification.Entries,
+		values.ClassifiedValue{Path: "podLabels::team", Classification: values.Deletion},
+		values.ClassifiedValue{Path: "legacy", Classification: values.Deletion},
+	)
+	classification.Deletions = 2
+	input.Output.NoOpDeletions = []string{"legacy"}
+
+	md := Markdown(input)
+
+	for _, want := range []string{
+		"- 1 null deletions dropped, the keys no longer exist",
+		"## Deletions",
+		"| `podLabels.team` | kept |",
+		"| `legacy` | dropped, no longer in the target chart |",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected report to contain %q, got:\n%s", want, md)
+		}
+	}
+}
+
+func TestMarkdown_EscapesTableCells(t *testing.T) {
+	input := testInput()
+	input.Output.Classification.Entries[0].UserValue = "a|b\nc"
+
+	md := Markdown(input)
+
+	if !strings.Contains(md, "`a\\|b c`") {
+		t.Errorf("expected escaped cell value, got:\n%s", md)
+	}
+}
+
+func TestCodeCell(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"app", "`app`"},
+		{"a|b", "`a\\|b`"},
+		{"echo `date`", "`` echo `date` ``"},
+		{"a`b", "``a`b``"},
+		{"`quoted`", "`` `quoted` ``"},
+		{"a``b", "```a``b```"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := codeCell(tt.in); got != tt.want {
+				t.Errorf("codeCell(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangelogBetween(t *testing.T) {
+	changelog := `# Changelog
+
+## 16.0.1 (2024-07-01)
+
+* Too new ([#3](https://github.com/example/charts/pull/3))
+
+## 16.0.0 (2024-06-24)
+
+* Major bump ([#2](https://github.com/example/charts/pull/2))
+
+## 13.0.0 (2023-10-01)
+
+* Intermediate release
+
+## 12.1.0 (2023-01-01)
+
+* Current release
+`
+
+	entries := changelogBetween(changelog, "12.1.0", "16.0.0")
+
+	if !strings.Contains(entries, "### 16.0.0 (2024-06-24)") {
+		t.Errorf("expected target version entry with demoted heading, got:\n%s", entries)
+	}
+	if !strings.Contains(entries, "[#2](https://github.com/example/charts/pull/2)") {
+		t.Error("expected changelog links to be kept")
+	}
+	if !strings.Contains(entries, "### 13.0.0") {
+		t.Error("expected intermediate version entry")
+	}
+	if strings.Contains(entries, "16.0.1") {
+		t.Error("expected versions newer than target to be excluded")
+	}
+	if strings.Contains(entries, "Current release") {
+		t.Error("expected source version entry to be excluded")
+	}
+}
+
+func TestChangelogBetween_Unparseable(t *testing.T) {
+	if got := changelogBetween("just some notes", "1.0.0", "2.0.0"); got != "" {
+		t.Errorf("expected empty result, got %q", got)
+	}
+	if got := changelogBetween("## 2.0.0\n* change", "latest", "2.0.0"); got != "" {
+		t.Errorf("expected empty result for invalid version, got %q", got)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.md")
+
+	if err := WriteFile(path, testInput()); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	if !strings.HasPrefix(string(content), "# Helm values upgrade") {
+		t.Errorf("unexpected report content:\n%s", content)
+	}
+}
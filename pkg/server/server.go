@@ -0,0 +1,428 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itsvictorfy/hvu"
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// maxValuesSize limits the size of a posted values file
+const maxValuesSize = 10 << 20
+
+// Server serves classify, diff and upgrade as JSON endpoints. Charts are cached in memory
+// and shared across requests for the life of the server
+type Server struct {
+	timeout   time.Duration
+	redactor  *values.Redactor                         // Masks sensitive values in responses, except upgraded values
+	newSource func(repository string) helm.ChartSource // Creates the source a repository's charts are fetched from
+
+	mu      sync.Mutex
+	sources map[string]*helm.CachedSource // Cached chart source of each repository
+}
+
+// New returns a server that aborts each request after timeout and masks sensitive values with
+// redactor. A timeout of 0 means no limit, and a nil redactor masks nothing
+func New(timeout time.Duration, redactor *values.Redactor) *Server {
+	return &Server{
+		timeout:   timeout,
+		redactor:  redactor,
+		newSource: helm.NewChartSource,
+		sources:   make(map[string]*helm.CachedSource),
+	}
+}
+
+// Handler returns the HTTP handler of the server's endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("POST /v1/classify", s.handle(s.classify))
+	mux.HandleFunc("GET /v1/diff", s.handle(s.diff))
+	mux.HandleFunc("POST /v1/upgrade", s.handle(s.upgrade))
+	return mux
+}
+
+// requestError is an error caused by the request itself, reported as 400 Bad Request
+type requestError struct {
+	err error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+// badRequest returns a requestError with a formatted message
+func badRequest(format string, args ...interface{}) error {
+	return &requestError{err: fmt.Errorf(format, args...)}
+}
+
+// handle adapts an endpoint to an http.HandlerFunc, applying the request timeout and
+// writing its result or error as JSON
+func (s *Server) handle(endpoint func(ctx context.Context, r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := r.Context()
+		if s.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeoutCause(ctx, s.timeout, fmt.Errorf("request timed out after %s", s.timeout))
+			defer cancel()
+		}
+
+		result, err := endpoint(ctx, r)
+		status := http.StatusOK
+		if err != nil {
+			status = errorStatus(ctx, err)
+			result = map[string]string{"error": err.Error()}
+		}
+		writeJSON(w, status, result)
+
+		slog.Info("handled request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"chart", r.URL.Query().Get("chart"),
+			"status", status,
+			"duration", time.Since(start),
+		)
+	}
+}
+
+// errorStatus returns the HTTP status an endpoint error is reported with
+func errorStatus(ctx context.Context, err error) int {
+	var reqErr *requestError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &reqErr):
+		return http.StatusBadRequest
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		slog.Debug("failed to write response", "error", err)
+	}
+}
+
+// client returns a client that fetches charts from the cached source of the request's repository.
+// Only remote repositories are accepted, a server must not read local directories for its callers
+func (s *Server) client(r *http.Request) (*hvu.Client, error) {
+	repository := r.URL.Query().Get("repo")
+	if !strings.HasPrefix(repository, "https://") && !strings.HasPrefix(repository, "http://") && !strings.HasPrefix(repository, "oci://") {
+		return nil, badRequest("repo must be an http(s):// chart repository or oci:// registry, got %q", repository)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	source, ok := s.sources[repository]
+	if !ok {
+		source = helm.NewCachedSource(s.newSource(repository), s.timeout)
+		s.sources[repository] = source
+	}
+	return hvu.NewClient(hvu.WithChartSource(source)), nil
+}
+
+// params returns the query parameters of the request, failing when a required one is missing
+func params(r *http.Request, names ...string) (map[string]string, error) {
+	query := r.URL.Query()
+	result := make(map[string]string, len(names))
+	for _, name := range names {
+		value := query.Get(name)
+		if value == "" {
+			return nil, badRequest("missing query parameter %q", name)
+		}
+		result[name] = value
+	}
+	return result, nil
+}
+
+// boolParam parses an optional boolean query parameter
+func boolParam(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, badRequest("invalid query parameter %q: %v", name, err)
+	}
+	return parsed, nil
+}
+
+// readValues reads the values file posted in the request body
+func readValues(r *http.Request) ([]byte, error) {
+	content, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxValuesSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values: %w", err)
+	}
+	return content, nil
+}
+
+// change is the JSON form of a value that differs between two chart versions
+type change struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+func changes(from []values.ValueChange) []change {
+	result := make([]change, 0, len(from))
+	for _, c := range from {
+		result = append(result, change{Path: values.PathToDisplayFormat(c.Path), Old: c.OldValue, New: c.NewValue})
+	}
+	return result
+}
+
+// summary is the JSON form of the counts of a classification
+type summary struct {
+	Customized    int `json:"customized"`
+	CopiedDefault int `json:"copiedDefault"`
+	Unknown       int `json:"unknown"`
+	Removed       int `json:"removed"`
+	Deletions     int `json:"deletions"`
+	Total         int `json:"total"`
+}
+
+// entry is the JSON form of a classified value
+type entry struct {
+	Path           string      `json:"path"`
+	Classification string      `json:"classification"`
+	Value          interface{} `json:"value"`
+	Default        interface{} `json:"default,omitempty"`
+}
+
+func classification(result *values.ClassificationResult) (summary, []entry) {
+	entries := make([]entry, 0, len(result.Entries))
+	for _, e := range result.Entries {
+		entries = append(entries, entry{
+			Path:           values.PathToDisplayFormat(e.Path),
+			Classification: string(e.Classification),
+			Value:          e.UserValue,
+			Default:        e.DefaultValue,
+		})
+	}
+	return summary{
+		Customized:    result.Customized,
+		CopiedDefault: result.CopiedDefault,
+		Unknown:       result.Unknown,
+		Removed:       result.Removed,
+		Deletions:     result.Deletions,
+		Total:         result.Total,
+	}, entries
+}
+
+type classifyResponse struct {
+	Chart   string  `json:"chart"`
+	Version string  `json:"version"`
+	Summary summary `json:"summary"`
+	Entries []entry `json:"entries"`
+}
+
+// classify handles POST /v1/classify?chart=&repo=&version= with a values file as the body
+func (s *Server) classify(ctx context.Context, r *http.Request) (interface{}, error) {
+	p, err := params(r, "chart", "version")
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.client(r)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readValues(r)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.Classify(ctx, &hvu.ClassifyRequest{
+		Chart:      p["chart"],
+		Repository: r.URL.Query().Get("repo"),
+		Version:    p["version"],
+		Values:     [][]byte{content},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response := &classifyResponse{Chart: p["chart"], Version: p["version"]}
+	response.Summary, response.Entries = classification(s.redactor.Result(result.Classification))
+	return response, nil
+}
+
+type diffResponse struct {
+	Chart   string   `json:"chart"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Added   []change `json:"added"`
+	Removed []change `json:"removed"`
+	Changed []change `json:"changed"`
+}
+
+// diff handles GET /v1/diff?chart=&repo=&from=&to=
+func (s *Server) diff(ctx context.Context, r *http.Request) (interface{}, error) {
+	p, err := params(r, "chart", "from", "to")
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.client(r)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.Diff(ctx, &hvu.DiffRequest{
+		Chart:       p["chart"],
+		Repository:  r.URL.Query().Get("repo"),
+		FromVersion: p["from"],
+		ToVersion:   p["to"],
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &diffResponse{
+		Chart:   p["chart"],
+		From:    p["from"],
+		To:      p["to"],
+		Added:   changes(s.redactor.Changes(result.Added)),
+		Removed: changes(s.redactor.Changes(result.Removed)),
+		Changed: changes(s.redactor.Changes(result.Changed)),
+	}, nil
+}
+
+// conflict is the JSON form of a customized key whose default also changed
+type conflict struct {
+	Path       string      `json:"path"`
+	Value      interface{} `json:"value"`
+	OldDefault interface{} `json:"oldDefault"`
+	NewDefault interface{} `json:"newDefault"`
+}
+
+// imageTag is the JSON form of a custom image tag
+type imageTag struct {
+	Path       string `json:"path"`
+	Tag        string `json:"tag"`
+	OldDefault string `json:"oldDefault"`
+	NewDefault string `json:"newDefault"`
+}
+
+// secretMigration is the JSON form of a hardcoded credential that can move to an existing Secret
+type secretMigration struct {
+	Path      string `json:"path"`
+	SecretKey string `json:"secretKey"`
+}
+
+type upgradeResponse struct {
+	Chart             string            `json:"chart"`
+	From              string            `json:"from"`
+	To                string            `json:"to"`
+	Values            string            `json:"values"`
+	Summary           summary           `json:"summary"`
+	UpdatedDefaults   []change          `json:"updatedDefaults"`
+	Conflicts         []conflict        `json:"conflicts"`
+	CustomImageTags   []imageTag        `json:"customImageTags"`
+	ImageTagsUpgraded bool              `json:"imageTagsUpgraded"`
+	SchemaViolations  []string          `json:"schemaViolations"`
+	SecretMigrations  []secretMigration `json:"secretMigrations"`
+}
+
+// upgrade handles POST /v1/upgrade?chart=&repo=&from=&to= with a values file as the body.
+// The upgrade-images, removed-keys and preserve-comments parameters match the CLI flags
+func (s *Server) upgrade(ctx context.Context, r *http.Request) (interface{}, error) {
+	p, err := params(r, "chart", "from", "to")
+	if err != nil {
+		return nil, err
+	}
+	upgradeImages, err := boolParam(r, "upgrade-images")
+	if err != nil {
+		return nil, err
+	}
+	preserveComments, err := boolParam(r, "preserve-comments")
+	if err != nil {
+		return nil, err
+	}
+	removedKeys, err := values.ParseRemovedKeyAction(r.URL.Query().Get("removed-keys"))
+	if err != nil {
+		return nil, &requestError{err: err}
+	}
+	client, err := s.client(r)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readValues(r)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.Upgrade(ctx, &hvu.UpgradeRequest{
+		Chart:            p["chart"],
+		Repository:       r.URL.Query().Get("repo"),
+		FromVersion:      p["from"],
+		ToVersion:        p["to"],
+		Values:           [][]byte{content},
+		UpgradeImages:    upgradeImages,
+		RemovedKeys:      removedKeys,
+		PreserveComments: preserveComments,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response := &upgradeResponse{
+		Chart:             p["chart"],
+		From:              p["from"],
+		To:                p["to"],
+		Values:            string(result.Values[0]),
+		UpdatedDefaults:   changes(s.redactor.Changes(result.UpdatedDefaults)),
+		Conflicts:         make([]conflict, 0, len(result.Conflicts)),
+		CustomImageTags:   make([]imageTag, 0, len(result.CustomImageTags)),
+		ImageTagsUpgraded: result.ImageTagsUpgraded,
+		SchemaViolations:  append([]string{}, result.SchemaViolations...),
+		SecretMigrations:  make([]secretMigration, 0, len(result.SecretMigrations)),
+	}
+	response.Summary, _ = classification(result.Classification)
+	for _, c := range s.redactor.Conflicts(result.Conflicts) {
+		response.Conflicts = append(response.Conflicts, conflict{
+			Path:       values.PathToDisplayFormat(c.Path),
+			Value:      c.UserValue,
+			OldDefault: c.OldDefault,
+			NewDefault: c.NewDefault,
+		})
+	}
+	for _, image := range result.CustomImageTags {
+		response.CustomImageTags = append(response.CustomImageTags, imageTag{
+			Path:       values.PathToDisplayFormat(image.Path),
+			Tag:        image.UserTag,
+			OldDefault: image.OldDefault,
+			NewDefault: image.NewDefault,
+		})
+	}
+	for _, migration := range result.SecretMigrations {
+		response.SecretMigrations = append(response.SecretMigrations, secretMigration{
+			Path:      values.PathToDisplayFormat(migration.Path),
+			SecretKey: values.PathToDisplayFormat(migration.SecretKey),
+		})
+	}
+	return response, nil
+}
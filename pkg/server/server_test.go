@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// testServer serves two versions of an app chart from memory and counts the charts fetched
+func testServer(t *testing.T, timeout time.Duration, source helm.ChartSource) (*httptest.Server, *int) {
+	t.Helper()
+
+	var (
+		mu      sync.Mutex
+		fetches int
+	)
+	redactor, err := values.NewRedactor(nil)
+	if err != nil {
+		t.Fatalf("NewRedactor() error = %v", err)
+	}
+	srv := New(timeout, redactor)
+	srv.newSource = func(repository string) helm.ChartSource {
+		return chartSourceFunc(func(ctx context.Context, chartName, version string) (*helm.ChartInfo, error) {
+			mu.Lock()
+			fetches++
+			mu.Unlock()
+			return source.GetChart(ctx, chartName, version)
+		})
+	}
+	server := httptest.NewServer(srv.Handler())
+	t.Cleanup(server.Close)
+	return server, &fetches
+}
+
+// chartSourceFunc adapts a function to a helm.ChartSource
+type chartSourceFunc func(ctx context.Context, chartName, version string) (*helm.ChartInfo, error)
+
+func (f chartSourceFunc) GetChart(ctx context.Context, chartName, version string) (*helm.ChartInfo, error) {
+	return f(ctx, chartName, version)
+}
+
+func memorySource(t *testing.T) *helm.MemorySource {
+	t.Helper()
+	source := helm.NewMemorySource()
+	if err := source.AddValues("app", "1.0.0", "replicaCount: 1\nimage:\n  tag: \"1.0\"\nlegacy: true\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	if err := source.AddValues("app", "2.0.0", "replicaCount: 1\nimage:\n  tag: \"2.0\"\nmetrics:\n  enabled: false\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	return source
+}
+
+// request sends a request and decodes the JSON response into v
+func request(t *testing.T, method, url, body string, v interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestServer_Classify(t *testing.T) {
+	server, fetches := testServer(t, 0, memorySource(t))
+	url := server.URL + "/v1/classify?chart=app&repo=https://charts.example.com&version=1.0.0"
+
+	for i := 0; i < 2; i++ {
+		var response classifyResponse
+		if status := request(t, http.MethodPost, url, "replicaCount: 3\nimage:\n  tag: \"1.0\"\n", &response); status != http.StatusOK {
+			t.Fatalf("expected 200, got %d", status)
+		}
+		if response.Summary.Customized != 1 || response.Summary.CopiedDefault != 1 || len(response.Entries) != 2 {
+			t.Errorf("unexpected classification %+v", response)
+		}
+	}
+
+	if *fetches != 1 {
+		t.Errorf("expected the chart to be fetched once across requests, got %d fetches", *fetches)
+	}
+}
+
+func TestServer_Diff(t *testing.T) {
+	server, _ := testServer(t, 0, memorySource(t))
+
+	var response diffResponse
+	status := request(t, http.MethodGet, server.URL+"/v1/diff?chart=app&repo=oci://ghcr.io/org&from=1.0.0&to=2.0.0", "", &response)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	if len(response.Added) != 1 || response.Added[0].Path != "metrics.enabled" || len(response.Removed) != 1 || len(response.Changed) != 1 {
+		t.Errorf("unexpected diff %+v", response)
+	}
+}
+
+func TestServer_Upgrade(t *testing.T) {
+	server, _ := testServer(t, 0, memorySource(t))
+
+	var response upgradeResponse
+	url := server.URL + "/v1/upgrade?chart=app&repo=https://charts.example.com&from=1.0.0&to=2.0.0&upgrade-images=true"
+	if status := request(t, http.MethodPost, url, "replicaCount: 3\nimage:\n  tag: \"1.0\"\n", &response); status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	if !strings.Contains(response.Values, "replicaCount: 3") || !strings.Contains(response.Values, "tag: \"2.0\"") {
+		t.Errorf("unexpected upgraded values:\n%s", response.Values)
+	}
+	if response.Summary.Customized != 1 {
+		t.Errorf("unexpected summary %+v", response.Summary)
+	}
+}
+
+func TestServer_RedactsSensitiveValues(t *testing.T) {
+	server, _ := testServer(t, 0, memorySource(t))
+	body := "replicaCount: 3\nauth:\n  password: hunter2\n"
+
+	var classified classifyResponse
+	url := server.URL + "/v1/classify?chart=app&repo=https://charts.example.com&version=1.0.0"
+	if status := request(t, http.MethodPost, url, body, &classified); status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	for _, e := range classified.Entries {
+		if e.Path == "auth.password" && e.Value != values.RedactedValue {
+			t.Errorf("expected auth.password to be redacted, got %v", e.Value)
+		}
+		if e.Path == "replicaCount" && e.Value != float64(3) {
+			t.Errorf("expected replicaCount to be shown, got %v", e.Value)
+		}
+	}
+
+	var upgraded upgradeResponse
+	url = server.URL + "/v1/upgrade?chart=app&repo=https://charts.example.com&from=1.0.0&to=2.0.0"
+	if status := request(t, http.MethodPost, url, body, &upgraded); status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	if !strings.Contains(upgraded.Values, "password: hunter2") {
+		t.Errorf("expected upgraded values to keep the password, got:\n%s", upgraded.Values)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	blocking := chartSourceFunc(func(ctx context.Context, chartName, version string) (*helm.ChartInfo, error) {
+		<-ctx.Done()
+		return nil, context.Cause(ctx)
+	})
+
+	tests := []struct {
+		name       string
+		source     helm.ChartSource
+		method     string
+		query      string
+		body       string
+		wantStatus int
+	}{
+		{"missing parameter", memorySource(t), http.MethodPost, "/v1/classify?chart=app&repo=https://charts.example.com", "a: 1\n", http.StatusBadRequest},
+		{"local repository", memorySource(t), http.MethodPost, "/v1/classify?chart=app&repo=/etc&version=1.0.0", "a: 1\n", http.StatusBadRequest},
+		{"invalid removed keys", memorySource(t), http.MethodPost, "/v1/upgrade?chart=app&repo=https://charts.example.com&from=1.0.0&to=2.0.0&removed-keys=maybe", "a: 1\n", http.StatusBadRequest},
+		{"invalid values", memorySource(t), http.MethodPost, "/v1/classify?chart=app&repo=https://charts.example.com&version=1.0.0", "a: [unclosed\n", http.StatusUnprocessableEntity},
+		{"missing chart version", memorySource(t), http.MethodGet, "/v1/diff?chart=app&repo=https://charts.example.com&from=1.0.0&to=3.0.0", "", http.StatusUnprocessableEntity},
+		{"timeout", blocking, http.MethodGet, "/v1/diff?chart=app&repo=https://charts.example.com&from=1.0.0&to=2.0.0", "", http.StatusGatewayTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := testServer(t, 50*time.Millisecond, tt.source)
+
+			var response map[string]string
+			if status := request(t, tt.method, server.URL+tt.query, tt.body, &response); status != tt.wantStatus {
+				t.Errorf("expected %d, got %d: %v", tt.wantStatus, status, response)
+			}
+			if response["error"] == "" {
+				t.Error("expected an error message")
+			}
+		})
+	}
+}
+
+func TestServer_Timeout(t *testing.T) {
+	memory := memorySource(t)
+	slow := chartSourceFunc(func(ctx context.Context, chartName, version string) (*helm.ChartInfo, error) {
+		select {
+		case <-time.After(100 * time.Millisecond):
+			return memory.GetChart(ctx, chartName, version)
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		}
+	})
+	server, _ := testServer(t, 2*time.Second, slow)
+	url := server.URL + "/v1/diff?chart=app&repo=https://charts.example.com&from=1.0.0&to=2.0.0"
+
+	// A client that gives up must not fail the other requests sharing its chart fetches
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected the impatient request to be aborted")
+	}
+
+	var diff map[string]interface{}
+	if status := request(t, http.MethodGet, url, "", &diff); status != http.StatusOK {
+		t.Errorf("expected 200 for a request without a deadline, got %d: %v", status, diff)
+	}
+
+	// The server's own timeout still aborts requests whose chart never arrives
+	blocking := chartSourceFunc(func(ctx context.Context, chartName, version string) (*helm.ChartInfo, error) {
+		<-ctx.Done()
+		return nil, context.Cause(ctx)
+	})
+	server, _ = testServer(t, 50*time.Millisecond, blocking)
+	var response map[string]string
+	status := request(t, http.MethodGet, server.URL+"/v1/diff?chart=app&repo=https://charts.example.com&from=1.0.0&to=2.0.0", "", &response)
+	if status != http.StatusGatewayTimeout || !strings.Contains(response["error"], "timed out after 50ms") {
+		t.Errorf("expected 504 with the request timeout, got %d: %v", status, response)
+	}
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// CheckInput contains input parameters for check
+type CheckInput struct {
+	Chart       string
+	Repository  string
+	Source      helm.ChartSource // Where charts are fetched from (default: chosen from Repository)
+	FromVersion string
+	ToVersion   string         // Defaults to FromVersion when empty
+	ValuesFiles []string       // Values files layered in order, "-" for stdin
+	Values      []values.Layer // Already read values files, used instead of ValuesFiles
+	SetValues   helm.SetValues // --set style overrides applied after ValuesFiles
+	Stdin       io.Reader      // Source for a values file of "-" (default: os.Stdin)
+	Policy      *values.Policy // Policy rules for keys that must not be upgraded as usual
+}
+
+// CheckOutput contains the results of check
+type CheckOutput struct {
+	Classification   *values.ClassificationResult
+	Conflicts        []values.Conflict
+	SchemaViolations []string
+	Policy           *values.PolicyReport
+	UpgradedYAML     string
+	UpToDate         bool // Whether the values file already matches the upgraded output
+}
+
+// Passed reports whether the values file passed every check
+func (o *CheckOutput) Passed() bool {
+	return o.Classification.Unknown == 0 &&
+		o.Classification.Removed == 0 &&
+		len(o.Conflicts) == 0 &&
+		len(o.SchemaViolations) == 0 &&
+		(o.Policy == nil || len(o.Policy.ReviewRequired) == 0) &&
+		o.UpToDate
+}
+
+// Redacted returns a copy of the output with the sensitive values of its report masked
+func (o *CheckOutput) Redacted(r *values.Redactor) *CheckOutput {
+	redacted := *o
+	redacted.Classification = r.Result(o.Classification)
+	redacted.Conflicts = r.Conflicts(o.Conflicts)
+	redacted.Policy = r.PolicyReport(o.Policy)
+	return &redacted
+}
+
+// Check runs the upgrade logic without writing anything and reports whether the
+// values file is up to date with the target chart version
+func Check(ctx context.Context, input *CheckInput) (*CheckOutput, error) {
+	toVersion := input.ToVersion
+	if toVersion == "" {
+		toVersion = input.FromVersion
+	}
+
+	slog.Debug("starting check",
+		"chart", input.Chart,
+		"repository", input.Repository,
+		"fromVersion", input.FromVersion,
+		"toVersion", toVersion,
+		"valuesFiles", input.ValuesFiles,
+	)
+
+	// Validate values files exist
+	if input.Values == nil {
+		if err := validateValuesFiles(input.ValuesFiles); err != nil {
+			return nil, err
+		}
+	}
+
+	plan, err := planUpgrade(ctx, &planInput{
+		Chart:       input.Chart,
+		Repository:  input.Repository,
+		Source:      input.Source,
+		FromVersion: input.FromVersion,
+		ToVersion:   toVersion,
+		ValuesFiles: input.ValuesFiles,
+		Layers:      input.Values,
+		Stdin:       input.Stdin,
+		SetValues:   input.SetValues,
+		Policy:      input.Policy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	upgradedYAML, err := plan.Upgraded.ToYAMLWithComments(plan.NewComments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate YAML: %w", err)
+	}
+
+	// Only the keys the user's files set count: the full upgraded output also holds every chart
+	// default. Compare parsed content rather than text so formatting and comments don't count as drift
+	upToDate, err := userValuesUpToDate(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &CheckOutput{
+		Classification:   plan.Classification,
+		Conflicts:        values.DetectConflicts(plan.Classification, plan.NewDefaults),
+		SchemaViolations: plan.validateSchema(plan.Upgraded),
+		Policy:           values.NewPolicyReport(plan.Classification, plan.NewDefaults),
+		UpgradedYAML:     upgradedYAML,
+		UpToDate:         upToDate,
+	}
+
+	slog.Debug("check complete",
+		"unknown", output.Classification.Unknown,
+		"removed", output.Classification.Removed,
+		"conflicts", len(output.Conflicts),
+		"schemaViolations", len(output.SchemaViolations),
+		"upToDate", output.UpToDate,
+	)
+
+	return output, nil
+}
+
+// userValuesUpToDate reports whether upgrading the user's keys leaves them unchanged
+func userValuesUpToDate(plan *upgradePlan) (bool, error) {
+	upgradedYAML, err := values.MergeLayer(plan.UserValues, plan.OldDefaults, plan.NewDefaults, plan.Policy).ToYAML()
+	if err != nil {
+		return false, fmt.Errorf("failed to generate YAML: %w", err)
+	}
+	upgraded, err := values.ParseYAML(upgradedYAML)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse upgraded values: %w", err)
+	}
+	return values.ValuesEqual(upgraded, plan.UserValues), nil
+}
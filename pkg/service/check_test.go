@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+func TestCheck_MissingValuesFile(t *testing.T) {
+	input := &CheckInput{
+		Chart:       "test-chart",
+		Repository:  "https://example.com/charts",
+		FromVersion: "1.0.0",
+		ValuesFiles: []string{"/nonexistent/path/values.yaml"},
+	}
+
+	_, err := Check(context.Background(), input)
+
+	if err == nil {
+		t.Error("expected error for missing values file")
+	}
+}
+
+func TestCheckOutput_Passed(t *testing.T) {
+	tests := []struct {
+		name   string
+		output *CheckOutput
+		want   bool
+	}{
+		{
+			name:   "clean",
+			output: &CheckOutput{Classification: &values.ClassificationResult{}, UpToDate: true},
+			want:   true,
+		},
+		{
+			name:   "unknown keys",
+			output: &CheckOutput{Classification: &values.ClassificationResult{Unknown: 1}, UpToDate: true},
+			want:   false,
+		},
+		{
+			name:   "removed keys",
+			output: &CheckOutput{Classification: &values.ClassificationResult{Removed: 1}, UpToDate: true},
+			want:   false,
+		},
+		{
+			name: "conflicts",
+			output: &CheckOutput{
+				Classification: &values.ClassificationResult{},
+				Conflicts:      []values.Conflict{{Path: "replicaCount"}},
+				UpToDate:       true,
+			},
+			want: false,
+		},
+		{
+			name: "schema violations",
+			output: &CheckOutput{
+				Classification:   &values.ClassificationResult{},
+				SchemaViolations: []string{"at '/replicaCount': got string, want integer"},
+				UpToDate:         true,
+			},
+			want: false,
+		},
+		{
+			name:   "output differs",
+			output: &CheckOutput{Classification: &values.ClassificationResult{}},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.output.Passed(); got != tt.want {
+				t.Errorf("Passed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck_ChartSource(t *testing.T) {
+	source := helm.NewMemorySource()
+	if err := source.AddValues("app", "1.0.0", "replicaCount: 1\nimage:\n  tag: \"1.0\"\nresources:\n  cpu: 100m\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	if err := source.AddValues("app", "2.0.0", "replicaCount: 1\nimage:\n  tag: \"2.0\"\nresources:\n  cpu: 200m\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		values       string
+		toVersion    string
+		policy       *values.Policy
+		wantUpToDate bool
+		wantReview   int
+		wantPassed   bool
+	}{
+		{
+			name:         "small file on its own version",
+			values:       "replicaCount: 3\n",
+			wantUpToDate: true,
+			wantPassed:   true,
+		},
+		{
+			name:         "copied default on its own version",
+			values:       "replicaCount: 3\nimage:\n  tag: \"1.0\"\n",
+			wantUpToDate: true,
+			wantPassed:   true,
+		},
+		{
+			name:         "customization against a newer version",
+			values:       "replicaCount: 3\n",
+			toVersion:    "2.0.0",
+			wantUpToDate: true,
+			wantPassed:   true,
+		},
+		{
+			name:      "copied default that moves",
+			values:    "replicaCount: 3\nimage:\n  tag: \"1.0\"\n",
+			toVersion: "2.0.0",
+		},
+		{
+			name:       "review required",
+			values:     "resources:\n  cpu: 500m\n",
+			toVersion:  "2.0.0",
+			policy:     &values.Policy{Rules: []values.PolicyRule{{Path: "resources.cpu", Action: values.PolicyRequireReview}}},
+			wantReview: 1,
+			// The customization is kept, so only the review fails the check
+			wantUpToDate: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userValues, err := values.ParseYAML(tt.values)
+			if err != nil {
+				t.Fatalf("ParseYAML() error = %v", err)
+			}
+
+			output, err := Check(context.Background(), &CheckInput{
+				Chart:       "app",
+				Source:      source,
+				FromVersion: "1.0.0",
+				ToVersion:   tt.toVersion,
+				Values:      []values.Layer{{Source: "values.yaml", Values: userValues, Content: tt.values}},
+				Policy:      tt.policy,
+			})
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+
+			if output.UpToDate != tt.wantUpToDate {
+				t.Errorf("UpToDate = %v, want %v", output.UpToDate, tt.wantUpToDate)
+			}
+			if output.Policy == nil || len(output.Policy.ReviewRequired) != tt.wantReview {
+				t.Errorf("expected %d keys requiring review, got %+v", tt.wantReview, output.Policy)
+			}
+			if len(output.Conflicts) != 0 {
+				t.Errorf("expected no conflicts, got %+v", output.Conflicts)
+			}
+			if output.Passed() != tt.wantPassed {
+				t.Errorf("Passed() = %v, want %v", output.Passed(), tt.wantPassed)
+			}
+		})
+	}
+}
@@ -3,8 +3,8 @@ package service
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
-	"os"
 
 	"github.com/itsvictorfy/hvu/pkg/helm"
 	"github.com/itsvictorfy/hvu/pkg/values"
@@ -12,10 +12,15 @@ import (
 
 // ClassifyInput contains input parameters for classification
 type ClassifyInput struct {
-	Chart      string
-	Repository string
-	Version    string
-	ValuesFile string
+	Chart       string
+	Repository  string
+	Source      helm.ChartSource // Where charts are fetched from (default: chosen from Repository)
+	Version     string
+	ValuesFiles []string       // Values files layered in order like repeated helm -f flags, "-" for stdin
+	Values      []values.Layer // Already read values files, used instead of ValuesFiles
+	SetValues   helm.SetValues // --set style overrides applied after ValuesFiles
+	Stdin       io.Reader      // Source for a values file of "-" (default: os.Stdin)
+	Policy      *values.Policy // Policy rules; ignored keys are left out of the result
 }
 
 // ClassifyOutput contains the results of classification
@@ -25,33 +30,39 @@ type ClassifyOutput struct {
 	UserCount     int
 }
 
+// Redacted returns a copy of the output with its sensitive values masked
+func (o *ClassifyOutput) Redacted(r *values.Redactor) *ClassifyOutput {
+	redacted := *o
+	redacted.Result = r.Result(o.Result)
+	return &redacted
+}
+
 // Classify runs the classification logic
-func Classify(input *ClassifyInput) (*ClassifyOutput, error) {
+func Classify(ctx context.Context, input *ClassifyInput) (*ClassifyOutput, error) {
 	slog.Debug("starting classification",
 		"chart", input.Chart,
 		"repository", input.Repository,
 		"version", input.Version,
-		"valuesFile", input.ValuesFile,
+		"valuesFiles", input.ValuesFiles,
 	)
 
-	// Validate values file exists
-	if _, err := os.Stat(input.ValuesFile); os.IsNotExist(err) {
-		return nil, fmt.Errorf("values file not found: %s", input.ValuesFile)
+	// Validate values files exist
+	if input.Values == nil {
+		if err := validateValuesFiles(input.ValuesFiles); err != nil {
+			return nil, err
+		}
 	}
 
 	// Fetch chart defaults
 	slog.Debug("fetching default values", "chart", input.Chart, "version", input.Version)
 
-	defaultsYAML, err := helm.GetValuesFileByVersion(input.Repository, input.Chart, input.Version)
+	chartInfo, err := chartSource(input.Source, input.Repository).GetChart(ctx, input.Chart, input.Version)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch chart defaults: %w", err)
 	}
 
-	// Parse default values
-	defaultValues, err := values.ParseYAML(defaultsYAML)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse chart defaults: %w", err)
-	}
+	// Flatten default values, including the defaults of any subcharts
+	defaultValues := values.Flatten(chartInfo.Defaults)
 
 	slog.Debug("parsed default values", "count", len(defaultValues))
 
@@ -71,17 +82,20 @@ func Classify(input *ClassifyInput) (*ClassifyOutput, error) {
 		}
 	}
 
-	// Parse user values
-	userValues, err := values.ParseFile(input.ValuesFile)
+	// Parse and coalesce user values
+	read, err := userValuesFor(input.ValuesFiles, input.Values, input.SetValues, input.Stdin)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse user values: %w", err)
+		return nil, err
 	}
+	userValues := read.Combined
 
-	slog.Debug("parsed user values", "count", len(userValues))
+	slog.Debug("parsed user values", "count", len(userValues), "layers", len(read.Files))
 	slog.Debug("starting classification process")
 
 	// Classify values
 	result := values.Classify(userValues, defaultValues)
+	values.AttributeSources(result, read.Sources)
+	values.ApplyPolicy(result, input.Policy)
 
 	slog.Debug("classification complete",
 		"customized", result.Customized,
@@ -1,20 +1,23 @@
 package service
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
 )
 
 func TestClassify_MissingValuesFile(t *testing.T) {
 	input := &ClassifyInput{
-		Chart:      "test-chart",
-		Repository: "https://example.com/charts",
-		Version:    "1.0.0",
-		ValuesFile: "/nonexistent/path/values.yaml",
+		Chart:       "test-chart",
+		Repository:  "https://example.com/charts",
+		Version:     "1.0.0",
+		ValuesFiles: []string{"/nonexistent/path/values.yaml"},
 	}
 
-	_, err := Classify(input)
+	_, err := Classify(context.Background(), input)
 
 	if err == nil {
 		t.Error("expected error for missing values file")
@@ -37,10 +40,10 @@ func TestClassify_InputValidation(t *testing.T) {
 		{
 			name: "valid input structure",
 			input: &ClassifyInput{
-				Chart:      "test-chart",
-				Repository: "https://charts.example.com",
-				Version:    "1.0.0",
-				ValuesFile: valuesFile,
+				Chart:       "test-chart",
+				Repository:  "https://charts.example.com",
+				Version:     "1.0.0",
+				ValuesFiles: []string{valuesFile},
 			},
 			// Will fail on network, but validates input structure
 			wantError: true,
@@ -48,10 +51,10 @@ func TestClassify_InputValidation(t *testing.T) {
 		{
 			name: "missing values file",
 			input: &ClassifyInput{
-				Chart:      "test-chart",
-				Repository: "https://charts.example.com",
-				Version:    "1.0.0",
-				ValuesFile: "/nonexistent/values.yaml",
+				Chart:       "test-chart",
+				Repository:  "https://charts.example.com",
+				Version:     "1.0.0",
+				ValuesFiles: []string{"/nonexistent/values.yaml"},
 			},
 			wantError: true,
 		},
@@ -59,7 +62,7 @@ func TestClassify_InputValidation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := Classify(tt.input)
+			_, err := Classify(context.Background(), tt.input)
 			if (err != nil) != tt.wantError {
 				t.Errorf("Classify() error = %v, wantError %v", err, tt.wantError)
 			}
@@ -69,10 +72,10 @@ func TestClassify_InputValidation(t *testing.T) {
 
 func TestClassifyInput_Fields(t *testing.T) {
 	input := &ClassifyInput{
-		Chart:      "grafana",
-		Repository: "https://grafana.github.io/helm-charts",
-		Version:    "8.0.0",
-		ValuesFile: "/path/to/values.yaml",
+		Chart:       "grafana",
+		Repository:  "https://grafana.github.io/helm-charts",
+		Version:     "8.0.0",
+		ValuesFiles: []string{"/path/to/values.yaml"},
 	}
 
 	if input.Chart != "grafana" {
@@ -84,8 +87,8 @@ func TestClassifyInput_Fields(t *testing.T) {
 	if input.Version != "8.0.0" {
 		t.Errorf("expected version=8.0.0, got %s", input.Version)
 	}
-	if input.ValuesFile != "/path/to/values.yaml" {
-		t.Errorf("expected valuesFile path, got %s", input.ValuesFile)
+	if len(input.ValuesFiles) != 1 || input.ValuesFiles[0] != "/path/to/values.yaml" {
+		t.Errorf("expected valuesFiles path, got %v", input.ValuesFiles)
 	}
 }
 
@@ -103,3 +106,33 @@ func TestClassifyOutput_Fields(t *testing.T) {
 		t.Errorf("expected userCount=50, got %d", output.UserCount)
 	}
 }
+
+func TestClassify_ChartSource(t *testing.T) {
+	source := helm.NewMemorySource()
+	if err := source.AddValues("app", "1.0.0", "replicaCount: 1\nimage:\n  tag: \"1.0\"\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+
+	valuesFile := filepath.Join(t.TempDir(), "values.yaml")
+	if err := os.WriteFile(valuesFile, []byte("replicaCount: 3\nimage:\n  tag: \"1.0\"\nextra: true\n"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	output, err := Classify(context.Background(), &ClassifyInput{
+		Chart:       "app",
+		Source:      source,
+		Version:     "1.0.0",
+		ValuesFiles: []string{valuesFile},
+	})
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+
+	result := output.Result
+	if result.Customized != 1 || result.CopiedDefault != 1 || result.Unknown != 1 {
+		t.Errorf("unexpected classification %+v", result)
+	}
+	if output.DefaultsCount != 2 || output.UserCount != 3 {
+		t.Errorf("expected 2 defaults and 3 user values, got %d and %d", output.DefaultsCount, output.UserCount)
+	}
+}
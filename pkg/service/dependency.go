@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/manifest"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// DependencyInput contains input parameters for dependency
+type DependencyInput struct {
+	ChartPath     string                  // Umbrella chart directory, or its Chart.yaml
+	Dependency    string                  // Alias or chart name of the dependency to upgrade
+	ToVersion     string                  // Target version of the dependency, or "latest"
+	DryRun        bool                    // Upgrade without writing Chart.yaml or values.yaml
+	Backup        bool                    // Keep a .bak copy of each file before overwriting it
+	UpgradeImages bool                    // Upgrade custom image tags that match the old subchart default
+	RemovedKeys   values.RemovedKeyAction // How to write keys removed in the target subchart
+	Policy        *values.Policy          // Policy rules, matched against paths in the umbrella values file
+	RepoAliases   func(string) string     // URL of a repository name, such as from the config, or ""
+}
+
+// DependencyOutput contains the results of dependency
+type DependencyOutput struct {
+	ChartFile  string // Chart.yaml holding the dependency
+	ValuesFile string // Umbrella values.yaml, empty when the chart has none
+	Key        string // Values key holding the subchart's overrides
+	Chart      string
+	Repository string
+	ToVersion  string
+	Upgrade    *UpgradeOutput // Upgrade of the subtree under Key; UpgradedYAML is the whole values file
+}
+
+// Dependency bumps a subchart version in an umbrella chart's Chart.yaml and upgrades the
+// overrides under the subchart's key in values.yaml. The rest of values.yaml is left untouched
+func Dependency(ctx context.Context, input *DependencyInput) (*DependencyOutput, error) {
+	slog.Debug("starting dependency upgrade",
+		"chartPath", input.ChartPath,
+		"dependency", input.Dependency,
+		"toVersion", input.ToVersion,
+		"dryRun", input.DryRun,
+	)
+
+	chartFile := input.ChartPath
+	if info, err := os.Stat(chartFile); err == nil && info.IsDir() {
+		chartFile = filepath.Join(chartFile, manifest.ChartFile)
+	}
+	chart, err := manifest.ParseChart(chartFile)
+	if err != nil {
+		return nil, err
+	}
+	dependency, err := chart.Dependency(input.Dependency)
+	if err != nil {
+		return nil, err
+	}
+
+	repository, err := dependencyRepoURL(dependency, input.RepoAliases)
+	if err != nil {
+		return nil, err
+	}
+	if err := unsupportedSource(repository, dependency.Version); err != nil {
+		return nil, err
+	}
+
+	toVersion, err := helm.ResolveVersion(ctx, repository, dependency.Name, input.ToVersion)
+	if err != nil {
+		return nil, err
+	}
+	if toVersion == dependency.Version {
+		return nil, fmt.Errorf("dependency %s is already at version %s", dependency.Key(), toVersion)
+	}
+
+	output := &DependencyOutput{
+		ChartFile:  chartFile,
+		ValuesFile: chart.ValuesFile,
+		Key:        dependency.Key(),
+		Chart:      dependency.Name,
+		Repository: repository,
+		ToVersion:  toVersion,
+	}
+
+	var content string
+	if chart.ValuesFile != "" {
+		if content, err = readValuesContent(chart.ValuesFile, nil); err != nil {
+			return nil, err
+		}
+	}
+	oldChart, newChart, err := fetchCharts(ctx, &planInput{
+		Chart:       dependency.Name,
+		Repository:  repository,
+		FromVersion: dependency.Version,
+		ToVersion:   toVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+	upgrade, err := upgradeSubtree(content, dependency.Key(), values.Flatten(oldChart.Defaults), values.Flatten(newChart.Defaults), input)
+	if err != nil {
+		return nil, err
+	}
+	upgrade.FromVersion = dependency.Version
+	upgrade.Changelog = newChart.Changelog
+	output.Upgrade = upgrade
+
+	if err := dependency.SetVersion(toVersion); err != nil {
+		return nil, err
+	}
+
+	if input.DryRun {
+		slog.Debug("dry run - no files written")
+		return output, nil
+	}
+
+	chartContent, err := chart.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeDependencyFile(chartFile, chartContent, input.Backup); err != nil {
+		return nil, err
+	}
+	if chart.ValuesFile != "" {
+		if err := writeDependencyFile(chart.ValuesFile, []byte(upgrade.UpgradedYAML), input.Backup); err != nil {
+			return nil, err
+		}
+		upgrade.OutputPath = chart.ValuesFile
+	}
+
+	slog.Debug("dependency upgrade complete", "chart", chartFile, "values", chart.ValuesFile)
+	return output, nil
+}
+
+// dependencyRepoURL returns the URL of a dependency's chart repository. Chart.yaml may name a
+// repository instead, as @name, alias:name or a bare name, which is resolved like --repo
+func dependencyRepoURL(dependency *manifest.Dependency, aliases func(string) string) (string, error) {
+	repository := dependency.Repository
+	if strings.HasPrefix(repository, "file://") {
+		return "", fmt.Errorf("dependency %s is not from a chart repository URL: %q", dependency.Key(), repository)
+	}
+	if strings.Contains(repository, "://") {
+		return repository, nil
+	}
+
+	name := strings.TrimPrefix(repository, "@")
+	name = strings.TrimPrefix(name, "alias:")
+	if name == "" || strings.ContainsAny(name, "/\\:") {
+		return "", fmt.Errorf("dependency %s is not from a chart repository URL: %q", dependency.Key(), repository)
+	}
+	url := helm.ResolveRepoName(name, aliases)
+	if url == "" {
+		return "", fmt.Errorf("dependency %s uses unknown repository %q: not a repository name from the config or Helm's repositories.yaml", dependency.Key(), name)
+	}
+	slog.Debug("resolved dependency repository", "dependency", dependency.Key(), "name", name, "url", url)
+	return url, nil
+}
+
+// upgradeSubtree upgrades the values under key in an umbrella values file against the old and
+// new subchart defaults. The subtree is treated like an overlay values file, since Helm applies
+// the subchart defaults anyway, and the file is patched so nothing outside the subtree changes
+func upgradeSubtree(content, key string, oldSubchart, newSubchart values.Values, input *DependencyInput) (*UpgradeOutput, error) {
+	// Work with paths as they appear in the umbrella values file
+	oldDefaults := oldSubchart.Nest(key)
+	newDefaults := newSubchart.Nest(key)
+
+	fileValues, err := values.ParseYAML(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse umbrella values: %w", err)
+	}
+	userValues := fileValues.Subtree(key).Nest(key)
+
+	classification := values.Classify(userValues, oldDefaults)
+	values.MarkRemovedInTarget(classification, oldDefaults, newDefaults)
+	values.ApplyPolicy(classification, input.Policy)
+
+	upgraded := values.MergeLayer(userValues, oldDefaults, newDefaults, input.Policy)
+	removedKeysComment, err := applyRemovedKeyAction(upgraded, classification, input.RemovedKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	customImageTags := values.DetectCustomImageTags(userValues, oldDefaults, newDefaults)
+	if input.UpgradeImages && len(customImageTags) > 0 {
+		upgraded = values.ApplyImageUpgrades(upgraded, customImageTags)
+	}
+
+	// Replace the subtree and keep every other key of the file as it is
+	target := make(values.Values, len(fileValues))
+	for path, value := range fileValues {
+		if _, inSubtree := userValues[path]; !inSubtree {
+			target[path] = value
+		}
+	}
+	for path, value := range upgraded {
+		target[path] = value
+	}
+
+	upgradedYAML := content
+	if content != "" {
+		if upgradedYAML, err = values.PatchYAML(content, target, nil); err != nil {
+			return nil, fmt.Errorf("failed to upgrade umbrella values: %w", err)
+		}
+	}
+
+	return &UpgradeOutput{
+		Classification:     classification,
+		UpgradedYAML:       upgradedYAML + removedKeysComment,
+		OldDefaultsCount:   len(oldDefaults),
+		NewDefaultsCount:   len(newDefaults),
+		UserValuesCount:    len(userValues),
+		CustomImageTags:    customImageTags,
+		ImageTagsUpgraded:  input.UpgradeImages && len(customImageTags) > 0,
+		UpdatedDefaults:    values.UpdatedDefaults(classification, newDefaults),
+		Conflicts:          values.DetectConflicts(classification, newDefaults),
+		RemovedKeysComment: removedKeysComment,
+		NoOpDeletions:      values.NoOpDeletions(classification, newDefaults),
+		Policy:             values.NewPolicyReport(classification, newDefaults),
+		SecretMigrations:   values.DetectSecretMigrations(userValues, oldDefaults, newDefaults),
+	}, nil
+}
+
+// writeDependencyFile overwrites a file of the umbrella chart, keeping a backup when asked
+func writeDependencyFile(path string, content []byte, backup bool) error {
+	if backup {
+		if err := backupFile(path); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(path, content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
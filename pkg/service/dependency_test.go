@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+const umbrellaValues = `# Shared settings
+global:
+  storageClass: fast
+
+db:
+  image:
+    tag: "1.0" # chart default
+  auth:
+    username: app
+
+cache:
+  image:
+    tag: "1.0"
+`
+
+func TestUpgradeSubtree(t *testing.T) {
+	oldDefaults := values.Values{"image::tag": "1.0", "auth::username": "", "replicaCount": 1}
+	newDefaults := values.Values{"image::tag": "2.0", "replicaCount": 1, "metrics::enabled": false}
+
+	tests := []struct {
+		name        string
+		removedKeys values.RemovedKeyAction
+		want        []string
+		notWant     []string
+	}{
+		{
+			name:        "keep removed keys",
+			removedKeys: values.RemovedKeep,
+			want:        []string{"# Shared settings", "storageClass: fast", "tag: \"2.0\" # chart default", "username: app", "cache:\n  image:\n    tag: \"1.0\""},
+			notWant:     []string{"metrics", "replicaCount"},
+		},
+		{
+			name:        "drop removed keys",
+			removedKeys: values.RemovedDrop,
+			want:        []string{"tag: \"2.0\" # chart default", "cache:\n  image:\n    tag: \"1.0\""},
+			notWant:     []string{"username", "auth"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := upgradeSubtree(umbrellaValues, "db", oldDefaults, newDefaults, &DependencyInput{RemovedKeys: tt.removedKeys})
+			if err != nil {
+				t.Fatalf("upgradeSubtree() error = %v", err)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(output.UpgradedYAML, want) {
+					t.Errorf("expected upgraded values to contain %q, got:\n%s", want, output.UpgradedYAML)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(output.UpgradedYAML, notWant) {
+					t.Errorf("expected upgraded values not to contain %q, got:\n%s", notWant, output.UpgradedYAML)
+				}
+			}
+
+			classification := output.Classification
+			if classification.CopiedDefault != 1 || classification.Removed != 1 {
+				t.Errorf("expected one copied default and one removed key, got %+v", classification)
+			}
+			for _, entry := range classification.Entries {
+				if !strings.HasPrefix(entry.Path, "db::") {
+					t.Errorf("expected paths as they appear in the umbrella values, got %s", entry.Path)
+				}
+			}
+		})
+	}
+}
+
+func TestDependency_Unsupported(t *testing.T) {
+	dir := t.TempDir()
+	chart := `apiVersion: v2
+name: platform
+version: 0.1.0
+dependencies:
+  - name: common
+    version: 0.1.0
+    repository: file://../common
+  - name: app
+    version: 1.0.0
+    repository: "@stable"
+  - name: cache
+    version: 1.0.0
+    repository: alias:internal
+  - name: web
+    version: 1.0.0
+    repository: unknown
+  - name: registry
+    version: 1.0.0
+    repository: oci://ghcr.io/org
+  - name: ranged
+    version: ~1.0.0
+    repository: https://charts.example.com
+`
+	if err := os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte(chart), 0644); err != nil {
+		t.Fatalf("failed to write Chart.yaml: %v", err)
+	}
+	repoFile := filepath.Join(t.TempDir(), "repositories.yaml")
+	repos := `apiVersion: ""
+generated: "0001-01-01T00:00:00Z"
+repositories:
+  - name: stable
+    url: oci://ghcr.io/stable
+`
+	if err := os.WriteFile(repoFile, []byte(repos), 0644); err != nil {
+		t.Fatalf("failed to write repositories file: %v", err)
+	}
+	t.Setenv("HELM_REPOSITORY_CONFIG", repoFile)
+	aliases := map[string]string{"internal": "oci://registry.example.com/charts"}
+
+	// Repository names resolve to OCI registries, which fail before any download
+	tests := []struct {
+		dependency string
+		wantErr    string
+	}{
+		{"common", "not from a chart repository URL"},
+		{"app", "OCI"},
+		{"cache", "OCI"},
+		{"web", "unknown repository"},
+		{"registry", "OCI"},
+		{"ranged", "range"},
+		{"missing", "not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dependency, func(t *testing.T) {
+			_, err := Dependency(context.Background(), &DependencyInput{
+				ChartPath:   dir,
+				Dependency:  tt.dependency,
+				ToVersion:   "2.0.0",
+				RepoAliases: func(name string) string { return aliases[name] },
+			})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
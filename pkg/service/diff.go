@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// DiffInput contains input parameters for diff
+type DiffInput struct {
+	Chart       string
+	Repository  string
+	Source      helm.ChartSource // Where charts are fetched from (default: chosen from Repository)
+	FromVersion string
+	ToVersion   string
+}
+
+// DiffOutput contains how a chart's defaults changed between two versions
+type DiffOutput struct {
+	Diff      *values.DefaultsDiff
+	Changelog string // Changelog shipped with the target chart, if any
+}
+
+// Diff compares the default values of two versions of a chart
+func Diff(ctx context.Context, input *DiffInput) (*DiffOutput, error) {
+	slog.Debug("starting diff",
+		"chart", input.Chart,
+		"repository", input.Repository,
+		"fromVersion", input.FromVersion,
+		"toVersion", input.ToVersion,
+	)
+
+	if input.FromVersion == "" || input.ToVersion == "" {
+		return nil, fmt.Errorf("source and target versions are required")
+	}
+
+	oldChart, newChart, err := fetchCharts(ctx, &planInput{
+		Chart:       input.Chart,
+		Repository:  input.Repository,
+		Source:      input.Source,
+		FromVersion: input.FromVersion,
+		ToVersion:   input.ToVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	diff := values.DiffDefaults(values.Flatten(oldChart.Defaults), values.Flatten(newChart.Defaults))
+	slog.Debug("diff complete",
+		"added", len(diff.Added),
+		"removed", len(diff.Removed),
+		"changed", len(diff.Changed),
+	)
+
+	return &DiffOutput{Diff: diff, Changelog: newChart.Changelog}, nil
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+)
+
+func TestDiff(t *testing.T) {
+	source := helm.NewMemorySource()
+	if err := source.AddValues("app", "1.0.0", "replicaCount: 1\nimage:\n  tag: \"1.0\"\nlegacy: true\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	if err := source.AddValues("app", "2.0.0", "replicaCount: 1\nimage:\n  tag: \"2.0\"\nmetrics:\n  enabled: false\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+
+	output, err := Diff(context.Background(), &DiffInput{Chart: "app", Source: source, FromVersion: "1.0.0", ToVersion: "2.0.0"})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+
+	diff := output.Diff
+	if len(diff.Added) != 1 || diff.Added[0].Path != "metrics::enabled" {
+		t.Errorf("unexpected added keys %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Path != "legacy" {
+		t.Errorf("unexpected removed keys %+v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Path != "image::tag" {
+		t.Errorf("unexpected changed keys %+v", diff.Changed)
+	}
+
+	if _, err := Diff(context.Background(), &DiffInput{Chart: "app", Source: source, FromVersion: "1.0.0"}); err == nil {
+		t.Error("expected error without a target version")
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/itsvictorfy/hvu/pkg/git"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// gitRecord describes how an upgrade is recorded in the git repository holding the values files
+type gitRecord struct {
+	Commit    bool     // Commit the upgraded files
+	PatchFile string   // Write the changes to this patch file and restore the files instead
+	Files     []string // Values files, upgraded in place
+}
+
+// enabled reports whether the upgrade is recorded in git
+func (g *gitRecord) enabled() bool {
+	return g.Commit || g.PatchFile != ""
+}
+
+// open finds the repository holding the values files and checks that they have no uncommitted
+// changes, which would otherwise end up in the commit or patch
+func (g *gitRecord) open() (*git.Repo, error) {
+	if g.Commit && g.PatchFile != "" {
+		return nil, fmt.Errorf("a git commit and a patch file cannot be used together")
+	}
+	if len(g.Files) == 0 {
+		return nil, fmt.Errorf("git mode requires a values file")
+	}
+	for _, path := range g.Files {
+		if path == StdioPath {
+			return nil, fmt.Errorf("git mode requires a values file, not stdin")
+		}
+	}
+
+	repo, err := git.Open(g.Files[0])
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := g.paths()
+	if err != nil {
+		return nil, err
+	}
+	changed, err := repo.Changed(paths...)
+	if err != nil {
+		return nil, err
+	}
+	if len(changed) > 0 {
+		return nil, fmt.Errorf("values files have uncommitted changes, commit or stash them first: %s", strings.Join(changed, ", "))
+	}
+
+	slog.Debug("opened git repository", "dir", repo.Dir)
+	return repo, nil
+}
+
+// paths returns the absolute paths of the values files
+func (g *gitRecord) paths() ([]string, error) {
+	paths := make([]string, len(g.Files))
+	for i, path := range g.Files {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve path %s: %w", path, err)
+		}
+		paths[i] = abs
+	}
+	return paths, nil
+}
+
+// record commits the upgraded values files, or writes their changes to the patch file and
+// restores them. Nothing is recorded when the upgrade left the files unchanged
+func (g *gitRecord) record(repo *git.Repo, message string, output *UpgradeOutput) (err error) {
+	paths, err := g.paths()
+	if err != nil {
+		return err
+	}
+
+	// In patch mode the values files are restored however recording ends
+	if g.PatchFile != "" {
+		defer func() {
+			if restoreErr := repo.Restore(paths...); restoreErr != nil && err == nil {
+				err = restoreErr
+			}
+		}()
+	}
+
+	changed, err := repo.Changed(paths...)
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		slog.Info("upgrade left the values files unchanged, nothing to record in git")
+		return nil
+	}
+
+	if g.PatchFile == "" {
+		output.Commit, err = repo.Commit(message, paths...)
+		if err != nil {
+			return err
+		}
+		slog.Debug("committed upgrade", "commit", output.Commit)
+		return nil
+	}
+
+	diff, err := repo.Diff(paths...)
+	if err != nil {
+		return err
+	}
+
+	// git apply skips the message in front of the diff, so reviewers get the summary too
+	if err := writeFileAtomic(g.PatchFile, []byte(message+"\n"+diff)); err != nil {
+		return fmt.Errorf("failed to write patch: %w", err)
+	}
+
+	output.PatchFile = g.PatchFile
+	slog.Debug("wrote upgrade patch", "path", g.PatchFile)
+	return nil
+}
+
+// commitMessage summarizes an upgrade for its commit message or patch header
+func commitMessage(chart, fromVersion, toVersion string, output *UpgradeOutput) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Upgrade %s values from %s to %s\n\n", chart, fromVersion, toVersion)
+
+	fmt.Fprintf(&b, "- Preserved %d customized keys\n", output.Classification.Customized)
+	fmt.Fprintf(&b, "- Updated %d copied defaults to the new chart defaults\n", len(output.UpdatedDefaults))
+	for _, change := range output.UpdatedDefaults {
+		fmt.Fprintf(&b, "  - %s: %s -> %s\n", values.PathToDisplayFormat(change.Path), values.FormatValue(change.OldValue), values.FormatValue(change.NewValue))
+	}
+	if output.ImageTagsUpgraded && len(output.CustomImageTags) > 0 {
+		fmt.Fprintf(&b, "- Upgraded %d custom image tags\n", len(output.CustomImageTags))
+	}
+	if output.Classification.Removed > 0 {
+		fmt.Fprintf(&b, "- %d keys were removed in the target chart\n", output.Classification.Removed)
+	}
+	if len(output.Conflicts) > 0 {
+		fmt.Fprintf(&b, "- %d customized keys whose chart default also changed:\n", len(output.Conflicts))
+		for _, conflict := range output.Conflicts {
+			fmt.Fprintf(&b, "  - %s\n", values.PathToDisplayFormat(conflict.Path))
+		}
+	}
+	if len(output.SchemaViolations) > 0 {
+		fmt.Fprintf(&b, "- %d schema violations in the upgraded values\n", len(output.SchemaViolations))
+	}
+	if len(output.SecretMigrations) > 0 {
+		fmt.Fprintf(&b, "- %d hardcoded credentials can move to an existing Secret:\n", len(output.SecretMigrations))
+		for _, migration := range output.SecretMigrations {
+			fmt.Fprintf(&b, "  - %s -> %s\n", values.PathToDisplayFormat(migration.Path), values.PathToDisplayFormat(migration.SecretKey))
+		}
+	}
+
+	return b.String()
+}
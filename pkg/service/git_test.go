@@ -0,0 +1,184 @@
+package service
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itsvictorfy/hvu/pkg/git"
+	"github.com/itsvictorfy/hvu/pkg/git/gittest"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+func TestGitRecord_Commit(t *testing.T) {
+	_, valuesFile := gittest.InitRepo(t)
+	record := &gitRecord{Commit: true, Files: []string{valuesFile}}
+
+	repo, err := record.open()
+	if err != nil {
+		t.Fatalf("open() error = %v", err)
+	}
+
+	output := &UpgradeOutput{}
+	if err := os.WriteFile(valuesFile, []byte("replicaCount: 3\n"), 0644); err != nil {
+		t.Fatalf("failed to write values file: %v", err)
+	}
+	if err := record.record(repo, "Upgrade app values from 1.0.0 to 2.0.0\n", output); err != nil {
+		t.Fatalf("record() error = %v", err)
+	}
+
+	if output.Commit == "" {
+		t.Fatal("expected a commit hash")
+	}
+	subject := gittest.Output(t, repo.Dir, "log", "-1", "--format=%s", output.Commit)
+	if subject != "Upgrade app values from 1.0.0 to 2.0.0\n" {
+		t.Errorf("unexpected commit subject %q", subject)
+	}
+	if status := gittest.Output(t, repo.Dir, "status", "--porcelain"); status != "" {
+		t.Errorf("expected a clean tree after committing, got %q", status)
+	}
+}
+
+func TestGitRecord_PatchWriteFails(t *testing.T) {
+	_, valuesFile := gittest.InitRepo(t)
+	patchFile := filepath.Join(t.TempDir(), "missing", "upgrade.diff")
+	record := &gitRecord{PatchFile: patchFile, Files: []string{valuesFile}}
+
+	repo, err := record.open()
+	if err != nil {
+		t.Fatalf("open() error = %v", err)
+	}
+
+	output := &UpgradeOutput{}
+	if err := os.WriteFile(valuesFile, []byte("replicaCount: 3\n"), 0644); err != nil {
+		t.Fatalf("failed to write values file: %v", err)
+	}
+	if err := record.record(repo, "Upgrade app values\n", output); err == nil {
+		t.Fatal("expected error for an unwritable patch file")
+	}
+
+	content, _ := os.ReadFile(valuesFile)
+	if string(content) != "replicaCount: 1\n" {
+		t.Errorf("expected values file to be restored, got %q", content)
+	}
+	if output.PatchFile != "" {
+		t.Errorf("expected no patch file in output, got %q", output.PatchFile)
+	}
+}
+
+func TestGitRecord_Patch(t *testing.T) {
+	_, valuesFile := gittest.InitRepo(t)
+	patchFile := filepath.Join(t.TempDir(), "upgrade.diff")
+	record := &gitRecord{PatchFile: patchFile, Files: []string{valuesFile}}
+
+	repo, err := record.open()
+	if err != nil {
+		t.Fatalf("open() error = %v", err)
+	}
+
+	output := &UpgradeOutput{}
+	if err := os.WriteFile(valuesFile, []byte("replicaCount: 3\n"), 0644); err != nil {
+		t.Fatalf("failed to write values file: %v", err)
+	}
+	if err := record.record(repo, "Upgrade app values\n", output); err != nil {
+		t.Fatalf("record() error = %v", err)
+	}
+
+	patch, err := os.ReadFile(patchFile)
+	if err != nil {
+		t.Fatalf("failed to read patch: %v", err)
+	}
+	if !strings.HasPrefix(string(patch), "Upgrade app values\n") || !strings.Contains(string(patch), "+replicaCount: 3") {
+		t.Errorf("unexpected patch:\n%s", patch)
+	}
+	if output.PatchFile != patchFile {
+		t.Errorf("expected patch file in output, got %q", output.PatchFile)
+	}
+
+	// The working tree is left untouched and the patch applies to it
+	content, _ := os.ReadFile(valuesFile)
+	if string(content) != "replicaCount: 1\n" {
+		t.Errorf("expected values file to be restored, got %q", content)
+	}
+	cmd := exec.Command("git", "apply", "--check", patchFile)
+	cmd.Dir = repo.Dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("patch does not apply: %v: %s", err, out)
+	}
+}
+
+func TestGitRecord_Open(t *testing.T) {
+	_, valuesFile := gittest.InitRepo(t)
+
+	if err := os.WriteFile(valuesFile, []byte("replicaCount: 2\n"), 0644); err != nil {
+		t.Fatalf("failed to write values file: %v", err)
+	}
+	if _, err := (&gitRecord{Commit: true, Files: []string{valuesFile}}).open(); err == nil {
+		t.Error("expected error for a values file with uncommitted changes")
+	}
+
+	if _, err := (&gitRecord{Commit: true, PatchFile: "out.diff", Files: []string{valuesFile}}).open(); err == nil {
+		t.Error("expected error when committing and writing a patch")
+	}
+	if _, err := (&gitRecord{Commit: true, Files: []string{StdioPath}}).open(); err == nil {
+		t.Error("expected error for stdin")
+	}
+}
+
+func TestGitRecord_Unchanged(t *testing.T) {
+	_, valuesFile := gittest.InitRepo(t)
+	record := &gitRecord{Commit: true, Files: []string{valuesFile}}
+
+	repo, err := git.Open(valuesFile)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	output := &UpgradeOutput{}
+	if err := record.record(repo, "Upgrade\n", output); err != nil {
+		t.Fatalf("record() error = %v", err)
+	}
+	if output.Commit != "" {
+		t.Errorf("expected no commit for unchanged files, got %s", output.Commit)
+	}
+}
+
+func TestCommitMessage(t *testing.T) {
+	output := &UpgradeOutput{
+		Classification:  &values.ClassificationResult{Customized: 4, Removed: 1},
+		UpdatedDefaults: []values.ValueChange{{Path: "image::tag", OldValue: "1.0.0", NewValue: "2.0.0"}},
+		Conflicts:       []values.Conflict{{Path: "resources::limits::cpu"}},
+	}
+
+	message := commitMessage("postgresql", "12.1.0", "16.0.0", output)
+
+	for _, want := range []string{
+		"Upgrade postgresql values from 12.1.0 to 16.0.0\n\n",
+		"- Preserved 4 customized keys",
+		"- Updated 1 copied defaults to the new chart defaults\n  - image.tag: 1.0.0 -> 2.0.0",
+		"- 1 keys were removed in the target chart",
+		"  - resources.limits.cpu",
+	} {
+		if !strings.Contains(message, want) {
+			t.Errorf("expected message to contain %q, got:\n%s", want, message)
+		}
+	}
+}
+
+func TestCommitMessage_Redacted(t *testing.T) {
+	redactor, err := values.NewRedactor(nil)
+	if err != nil {
+		t.Fatalf("NewRedactor() error = %v", err)
+	}
+	output := &UpgradeOutput{
+		Classification:  &values.ClassificationResult{},
+		UpdatedDefaults: []values.ValueChange{{Path: "auth::password", OldValue: "changeme", NewValue: "changeme2"}},
+	}
+
+	message := commitMessage("postgresql", "12.1.0", "16.0.0", output.Redacted(redactor))
+
+	if strings.Contains(message, "changeme") || !strings.Contains(message, "auth.password: <redacted> -> <redacted>") {
+		t.Errorf("expected the password to be redacted, got:\n%s", message)
+	}
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/manifest"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// HelmfileInput contains input parameters for helmfile
+type HelmfileInput struct {
+	Path             string                  // Path to helmfile.yaml
+	Environment      string                  // Helmfile environment (default: "default")
+	Release          string                  // Only handle this release (default: all)
+	Chart            string                  // Only handle releases of this chart (default: all)
+	ToVersion        string                  // Upgrade to this version, or "latest"
+	DryRun           bool                    // Upgrade without writing values files or the helmfile
+	Backup           bool                    // Keep a .bak copy of each file before overwriting it
+	UpgradeImages    bool                    // Upgrade custom image tags that match the old chart default
+	RemovedKeys      values.RemovedKeyAction // How to write user keys removed in the target chart
+	Policy           *values.Policy          // Policy rules for keys that must not be upgraded as usual
+	PreserveComments bool                    // Patch values files instead of regenerating them
+}
+
+// HelmfileOutput contains the results of helmfile
+type HelmfileOutput struct {
+	Environment string
+	Releases    []HelmfileResult
+	Changed     bool // Whether the helmfile was rewritten, or would be in a dry run
+}
+
+// HelmfileResult holds the outcome for one release of a helmfile
+type HelmfileResult struct {
+	Name           string
+	Namespace      string
+	Chart          string
+	Repository     string
+	FromVersion    string
+	ToVersion      string
+	ValuesFiles    []string // Values files upgraded in place
+	Skipped        []string // Values entries left untouched, with the reason
+	Classification *values.ClassificationResult
+	Upgraded       bool  // Whether the values files and version were upgraded
+	Err            error // Why the release could not be handled; other releases still are
+}
+
+// Helmfile upgrades the values files of the releases in a helmfile to a new chart version and
+// bumps each release's version in the helmfile
+func Helmfile(ctx context.Context, input *HelmfileInput) (*HelmfileOutput, error) {
+	slog.Debug("starting helmfile upgrade",
+		"path", input.Path,
+		"environment", input.Environment,
+		"release", input.Release,
+		"chart", input.Chart,
+		"toVersion", input.ToVersion,
+		"dryRun", input.DryRun,
+	)
+
+	if input.ToVersion == "" {
+		return nil, fmt.Errorf("target version is required")
+	}
+
+	helmfile, err := manifest.ParseHelmfile(input.Path, input.Environment)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &HelmfileOutput{Environment: helmfile.Environment}
+	for _, release := range helmfile.Releases {
+		if input.Release != "" && release.Name != input.Release {
+			continue
+		}
+		if input.Chart != "" && release.Chart != input.Chart {
+			continue
+		}
+
+		result := upgradeHelmfileRelease(ctx, release, input)
+		if result.Err != nil {
+			slog.Warn("failed to upgrade release", "name", release.Name, "error", result.Err)
+		}
+		output.Releases = append(output.Releases, result)
+	}
+
+	if !helmfile.Changed() {
+		return output, nil
+	}
+	output.Changed = true
+	if input.DryRun {
+		return output, nil
+	}
+
+	content, err := helmfile.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if input.Backup {
+		if err := backupFile(input.Path); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeFileAtomic(input.Path, content); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", input.Path, err)
+	}
+	slog.Debug("rewrote helmfile", "path", input.Path)
+
+	return output, nil
+}
+
+// upgradeHelmfileRelease upgrades the values files of one release in place and bumps its
+// version. Helmfile runs non-interactively, so custom image tags are only upgraded when asked
+func upgradeHelmfileRelease(ctx context.Context, release *manifest.HelmfileRelease, input *HelmfileInput) HelmfileResult {
+	result := HelmfileResult{
+		Name:        release.Name,
+		Namespace:   release.Namespace,
+		Chart:       release.Chart,
+		Repository:  release.Repository,
+		FromVersion: release.Version,
+		ValuesFiles: release.ValuesFiles,
+		Skipped:     release.Skipped,
+	}
+
+	if release.Repository == "" {
+		result.Err = fmt.Errorf("chart is not from a repository declared in the helmfile")
+		return result
+	}
+	if err := unsupportedSource(release.Repository, release.Version); err != nil {
+		result.Err = err
+		return result
+	}
+
+	toVersion, err := helm.ResolveVersion(ctx, release.Repository, release.Chart, input.ToVersion)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if toVersion == release.Version {
+		return result
+	}
+	result.ToVersion = toVersion
+
+	if len(release.ValuesFiles) > 0 {
+		upgraded, err := Upgrade(ctx, &UpgradeInput{
+			Chart:            release.Chart,
+			Repository:       release.Repository,
+			FromVersion:      release.Version,
+			ToVersion:        toVersion,
+			ValuesFiles:      release.ValuesFiles,
+			InPlace:          true,
+			Backup:           input.Backup,
+			DryRun:           input.DryRun,
+			UpgradeImages:    input.UpgradeImages,
+			RemovedKeys:      input.RemovedKeys,
+			Policy:           input.Policy,
+			PreserveComments: input.PreserveComments,
+		})
+		if err != nil {
+			result.Err = err
+			return result
+		}
+
+		// Without --upgrade-images, custom image tags are kept as they are
+		if upgraded.PromptForImageTags && !input.DryRun {
+			if _, err := FinalizeUpgrade(&FinalizeUpgradeInput{
+				OriginalOutput: upgraded,
+				Chart:          release.Chart,
+				ToVersion:      toVersion,
+				ValuesFiles:    release.ValuesFiles,
+				InPlace:        true,
+				Backup:         input.Backup,
+			}); err != nil {
+				result.Err = err
+				return result
+			}
+		}
+		result.Classification = upgraded.Classification
+	}
+
+	if err := release.SetVersion(toVersion); err != nil {
+		result.Err = err
+		return result
+	}
+	result.Upgraded = true
+	return result
+}
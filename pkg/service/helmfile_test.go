@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itsvictorfy/hvu/pkg/manifest"
+)
+
+func TestUpgradeHelmfileRelease_Unsupported(t *testing.T) {
+	tests := []struct {
+		name    string
+		release *manifest.HelmfileRelease
+		wantErr string
+	}{
+		{"local chart", &manifest.HelmfileRelease{Chart: "./charts/app", Version: "1.0.0"}, "not from a repository"},
+		{"oci", &manifest.HelmfileRelease{Chart: "app", Version: "1.0.0", Repository: "oci://ghcr.io/org"}, "OCI"},
+		{"unpinned", &manifest.HelmfileRelease{Chart: "app", Repository: "https://charts.example.com"}, "not pinned"},
+		{"range", &manifest.HelmfileRelease{Chart: "app", Version: "~1.0.0", Repository: "https://charts.example.com"}, "range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := upgradeHelmfileRelease(context.Background(), tt.release, &HelmfileInput{ToVersion: "2.0.0"})
+			if result.Err == nil || !strings.Contains(result.Err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, result.Err)
+			}
+			if result.Upgraded {
+				t.Error("expected the release not to be upgraded")
+			}
+		})
+	}
+}
+
+func TestHelmfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "helmfile.yaml")
+	content := `releases:
+  - name: app
+    chart: ./charts/app
+    version: 1.0.0
+  - name: web
+    chart: ./charts/web
+    version: 1.0.0
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write helmfile: %v", err)
+	}
+
+	if _, err := Helmfile(context.Background(), &HelmfileInput{Path: path}); err == nil {
+		t.Error("expected error without a target version")
+	}
+
+	output, err := Helmfile(context.Background(), &HelmfileInput{Path: path, Release: "web", ToVersion: "2.0.0"})
+	if err != nil {
+		t.Fatalf("Helmfile() error = %v", err)
+	}
+	if output.Environment != manifest.DefaultEnvironment {
+		t.Errorf("expected the default environment, got %s", output.Environment)
+	}
+	if len(output.Releases) != 1 || output.Releases[0].Name != "web" || output.Releases[0].Err == nil {
+		t.Errorf("expected only web to be handled and reported, got %+v", output.Releases)
+	}
+	if output.Changed {
+		t.Error("expected the helmfile not to change when no release was upgraded")
+	}
+
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read helmfile: %v", err)
+	}
+	if string(written) != content {
+		t.Errorf("expected the helmfile to be untouched, got:\n%s", written)
+	}
+}
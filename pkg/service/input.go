@@ -0,0 +1,191 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+
+	"helm.sh/helm/v3/pkg/action"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// StdioPath is the file path that stands for standard input (values) or standard output (results)
+const StdioPath = "-"
+
+// validateValuesFile checks that a values file exists. Standard input always does
+func validateValuesFile(path string) error {
+	if path == StdioPath {
+		return nil
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return fmt.Errorf("values file not found: %s", path)
+	}
+	return nil
+}
+
+// readValuesFile parses a values file, reading from stdin when the path is "-"
+func readValuesFile(path string, stdin io.Reader) (values.Values, error) {
+	content, err := readValuesContent(path, stdin)
+	if err != nil {
+		return nil, err
+	}
+	return values.ParseYAML(content)
+}
+
+// readValuesContent reads the raw content of a values file, or of stdin when the path is "-"
+func readValuesContent(path string, stdin io.Reader) (string, error) {
+	if path != StdioPath {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file %s: %w", path, err)
+		}
+		return string(content), nil
+	}
+
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+	content, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read values from stdin: %w", err)
+	}
+	return string(content), nil
+}
+
+// validateValuesFiles checks that at least one values file was given, that every file exists
+// and that stdin is used at most once
+func validateValuesFiles(paths []string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("at least one values file is required")
+	}
+
+	stdinCount := 0
+	for _, path := range paths {
+		if path == StdioPath {
+			stdinCount++
+		}
+		if err := validateValuesFile(path); err != nil {
+			return err
+		}
+	}
+	if stdinCount > 1 {
+		return fmt.Errorf("stdin can only be used for one values file")
+	}
+	return nil
+}
+
+// readValuesLayers parses each values file in the order given
+func readValuesLayers(paths []string, stdin io.Reader) ([]values.Layer, error) {
+	layers := make([]values.Layer, 0, len(paths))
+	for _, path := range paths {
+		content, err := readValuesContent(path, stdin)
+		if err != nil {
+			return nil, err
+		}
+		layerValues, err := values.ParseYAML(content)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, values.Layer{Source: path, Values: layerValues, Content: content})
+	}
+	return layers, nil
+}
+
+// userValueLayers holds user values read from layered values files and --set overrides
+type userValueLayers struct {
+	Files     []values.Layer
+	Overrides values.Values // nil when no --set overrides were given
+	Combined  values.Values
+	Sources   map[string]string // Layer that set each combined key
+}
+
+// readUserValues reads the values files in order, applies --set overrides last like Helm does
+// and coalesces the result
+func readUserValues(paths []string, set helm.SetValues, stdin io.Reader) (*userValueLayers, error) {
+	files, err := readValuesLayers(paths, stdin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse user values: %w", err)
+	}
+	return coalesceUserValues(files, set)
+}
+
+// coalesceUserValues applies --set overrides on top of already read values files and
+// coalesces the result
+func coalesceUserValues(files []values.Layer, set helm.SetValues) (*userValueLayers, error) {
+	result := &userValueLayers{Files: files}
+	layers := files
+	if !set.Empty() {
+		setLayer, err := readSetValues(set)
+		if err != nil {
+			return nil, err
+		}
+		result.Overrides = setLayer.Values
+		layers = append(slices.Clip(files), setLayer)
+	}
+
+	result.Combined, result.Sources = values.Coalesce(layers)
+	return result, nil
+}
+
+// userValuesFor coalesces already read values files when there are any, and reads the
+// values files at paths otherwise
+func userValuesFor(paths []string, files []values.Layer, set helm.SetValues, stdin io.Reader) (*userValueLayers, error) {
+	if files != nil {
+		return coalesceUserValues(files, set)
+	}
+	return readUserValues(paths, set, stdin)
+}
+
+// SetValuesSource is the source recorded for keys set by --set style overrides
+const SetValuesSource = "--set"
+
+// readSetValues parses --set style overrides into a layer applied on top of the values files
+func readSetValues(set helm.SetValues) (values.Layer, error) {
+	parsed, err := set.Parse()
+	if err != nil {
+		return values.Layer{}, err
+	}
+
+	overrides, err := values.FromMap(parsed)
+	if err != nil {
+		return values.Layer{}, fmt.Errorf("failed to parse --set values: %w", err)
+	}
+
+	slog.Debug("parsed --set overrides", "count", len(overrides))
+	return values.Layer{Source: SetValuesSource, Values: overrides}, nil
+}
+
+// readReleaseValues loads the user-supplied values of a deployed release from cfg, or from the
+// Helm configuration of the current kubeconfig when cfg is nil
+func readReleaseValues(cfg *action.Configuration, name, namespace string) (*helm.ReleaseValues, values.Values, error) {
+	slog.Debug("loading release values", "release", name, "namespace", namespace)
+
+	if cfg == nil {
+		var err error
+		if cfg, err = helm.NewActionConfig(namespace); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	rel, err := helm.GetReleaseValues(cfg, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userValues, err := values.FromMap(rel.Values)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse release values: %w", err)
+	}
+
+	slog.Debug("loaded release values",
+		"chart", rel.Chart,
+		"chartVersion", rel.ChartVersion,
+		"count", len(userValues),
+	)
+
+	return rel, userValues, nil
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+)
+
+func TestValidateValuesFile(t *testing.T) {
+	if err := validateValuesFile(StdioPath); err != nil {
+		t.Errorf("expected stdin to be valid, got %v", err)
+	}
+	if err := validateValuesFile("/nonexistent/values.yaml"); err == nil {
+		t.Error("expected error for missing values file")
+	}
+}
+
+func TestReadValuesFile_Stdin(t *testing.T) {
+	stdin := strings.NewReader("image:\n  tag: 1.0.0\nreplicaCount: 2\n")
+
+	userValues, err := readValuesFile(StdioPath, stdin)
+	if err != nil {
+		t.Fatalf("readValuesFile() error = %v", err)
+	}
+
+	if userValues["image::tag"] != "1.0.0" {
+		t.Errorf("expected image::tag=1.0.0, got %v", userValues["image::tag"])
+	}
+	if userValues["replicaCount"] != 2 {
+		t.Errorf("expected replicaCount=2, got %v", userValues["replicaCount"])
+	}
+}
+
+func TestReadValuesFile_StdinInvalidYAML(t *testing.T) {
+	if _, err := readValuesFile(StdioPath, strings.NewReader("{invalid: yaml: content")); err == nil {
+		t.Error("expected error for invalid YAML on stdin")
+	}
+}
+
+func TestReadUserValues_SetOverrides(t *testing.T) {
+	stdin := strings.NewReader("replicaCount: 1\nimage:\n  tag: 1.0.0\n")
+	set := helm.SetValues{Values: []string{"replicaCount=3"}, StringValues: []string{"build=0123"}}
+
+	read, err := readUserValues([]string{StdioPath}, set, stdin)
+	if err != nil {
+		t.Fatalf("readUserValues() error = %v", err)
+	}
+
+	if read.Combined["replicaCount"] != 3 {
+		t.Errorf("expected --set to override the values file, got %v (%T)", read.Combined["replicaCount"], read.Combined["replicaCount"])
+	}
+	if read.Sources["replicaCount"] != SetValuesSource {
+		t.Errorf("expected replicaCount attributed to --set, got %q", read.Sources["replicaCount"])
+	}
+	if read.Sources["image::tag"] != StdioPath {
+		t.Errorf("expected image::tag attributed to stdin, got %q", read.Sources["image::tag"])
+	}
+	if read.Combined["build"] != "0123" {
+		t.Errorf("expected --set-string value to stay a string, got %v", read.Combined["build"])
+	}
+	if len(read.Files) != 1 || len(read.Overrides) != 2 {
+		t.Errorf("expected 1 file layer and 2 overrides, got %d and %d", len(read.Files), len(read.Overrides))
+	}
+}
+
+func TestReadUserValues_NoOverrides(t *testing.T) {
+	read, err := readUserValues([]string{StdioPath}, helm.SetValues{}, strings.NewReader("a: 1\n"))
+	if err != nil {
+		t.Fatalf("readUserValues() error = %v", err)
+	}
+	if read.Overrides != nil {
+		t.Errorf("expected no overrides, got %v", read.Overrides)
+	}
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// layeredPlan builds an upgrade plan for a base and a prod values file without fetching charts
+func layeredPlan() *upgradePlan {
+	oldDefaults := values.Values{"replicaCount": 1, "image::tag": "1.0.0", "service::type": "ClusterIP"}
+	newDefaults := values.Values{"replicaCount": 1, "image::tag": "2.0.0", "service::type": "ClusterIP", "metrics::enabled": false}
+	layers := []values.Layer{
+		{Source: "base.yaml", Values: values.Values{"replicaCount": 1, "image::tag": "1.0.0", "service::type": "NodePort"}},
+		{Source: "prod.yaml", Values: values.Values{"replicaCount": 3, "image::tag": "1.5.0"}},
+	}
+
+	userValues, sources := values.Coalesce(layers)
+	classification := values.Classify(userValues, oldDefaults)
+	values.AttributeSources(classification, sources)
+
+	return &upgradePlan{
+		OldDefaults:    oldDefaults,
+		NewDefaults:    newDefaults,
+		UserValues:     userValues,
+		Layers:         layers,
+		Classification: classification,
+		Upgraded:       values.Merge(userValues, oldDefaults, newDefaults, nil),
+	}
+}
+
+func TestUpgradeLayers(t *testing.T) {
+	plan := layeredPlan()
+
+	layers, err := upgradeLayers(plan, values.RemovedKeep, nil, false)
+	if err != nil {
+		t.Fatalf("upgradeLayers() error = %v", err)
+	}
+	if len(layers) != 2 {
+		t.Fatalf("expected 2 layers, got %d", len(layers))
+	}
+
+	base, err := values.ParseYAML(layers[0].UpgradedYAML)
+	if err != nil {
+		t.Fatalf("failed to parse base layer: %v", err)
+	}
+	if base["image::tag"] != "2.0.0" {
+		t.Errorf("expected copied default in base to move to 2.0.0, got %v", base["image::tag"])
+	}
+	if base["service::type"] != "NodePort" {
+		t.Errorf("expected base customization to be kept, got %v", base["service::type"])
+	}
+	if base["metrics::enabled"] != false {
+		t.Error("expected new chart defaults to be added to the base layer")
+	}
+
+	prod, err := values.ParseYAML(layers[1].UpgradedYAML)
+	if err != nil {
+		t.Fatalf("failed to parse prod layer: %v", err)
+	}
+	expected := values.Values{"replicaCount": 3, "image::tag": "1.5.0"}
+	if len(prod) != len(expected) {
+		t.Errorf("expected prod layer to only keep its own keys, got %v", prod)
+	}
+	for path, want := range expected {
+		if !values.ValuesEqual(prod[path], want) {
+			t.Errorf("prod %s = %v, want %v", path, prod[path], want)
+		}
+	}
+}
+
+func TestUpgradeLayers_ImageUpgradesOnlyInSettingLayer(t *testing.T) {
+	plan := layeredPlan()
+	changes := values.DetectCustomImageTags(plan.UserValues, plan.OldDefaults, plan.NewDefaults)
+	if len(changes) != 1 {
+		t.Fatalf("expected one custom image tag, got %d", len(changes))
+	}
+
+	layers, err := upgradeLayers(plan, values.RemovedKeep, changes, false)
+	if err != nil {
+		t.Fatalf("upgradeLayers() error = %v", err)
+	}
+
+	prod, _ := values.ParseYAML(layers[1].UpgradedYAML)
+	if prod["image::tag"] != "2.0.0" {
+		t.Errorf("expected prod image tag to be upgraded, got %v", prod["image::tag"])
+	}
+}
+
+func TestWriteUpgrade_Layers(t *testing.T) {
+	tmpDir := t.TempDir()
+	output := &UpgradeOutput{Layers: []LayerOutput{
+		{ValuesFile: "envs/base.yaml", UpgradedYAML: "a: 1\n"},
+		{ValuesFile: "envs/prod.yaml", UpgradedYAML: "b: 2\n"},
+	}}
+	target := &outputTarget{Chart: "app", ToVersion: "2.0.0", ValuesFiles: []string{"envs/base.yaml", "envs/prod.yaml"}, OutputDir: tmpDir}
+
+	if err := writeUpgrade(target, output); err != nil {
+		t.Fatalf("writeUpgrade() error = %v", err)
+	}
+
+	for i, suffix := range []string{"-base.yaml", "-prod.yaml"} {
+		path := output.Layers[i].OutputPath
+		if !strings.HasSuffix(path, suffix) || filepath.Dir(path) != tmpDir {
+			t.Errorf("unexpected output path %q for layer %d", path, i)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read layer output: %v", err)
+		}
+		if string(content) != output.Layers[i].UpgradedYAML {
+			t.Errorf("layer %d content = %q", i, content)
+		}
+	}
+}
+
+func TestJoinLayers(t *testing.T) {
+	joined := joinLayers([]LayerOutput{
+		{ValuesFile: "base.yaml", UpgradedYAML: "a: 1\n"},
+		{ValuesFile: "prod.yaml", UpgradedYAML: "b: 2\n"},
+	})
+
+	expected := "# Source: base.yaml\na: 1\n---\n# Source: prod.yaml\nb: 2\n"
+	if joined != expected {
+		t.Errorf("joinLayers() = %q, want %q", joined, expected)
+	}
+}
+
+func TestValidateValuesFiles(t *testing.T) {
+	if err := validateValuesFiles(nil); err == nil {
+		t.Error("expected error without values files")
+	}
+	if err := validateValuesFiles([]string{StdioPath, StdioPath}); err == nil {
+		t.Error("expected error when stdin is used twice")
+	}
+	if err := validateValuesFiles([]string{StdioPath, "/nonexistent/values.yaml"}); err == nil {
+		t.Error("expected error for missing values file")
+	}
+}
+
+func TestOutputTarget_ValidateLayers(t *testing.T) {
+	target := &outputTarget{ValuesFiles: []string{"base.yaml", "prod.yaml"}, OutputFile: "values.yaml"}
+	if err := target.validate(); err == nil {
+		t.Error("expected error for a single output file with multiple values files")
+	}
+
+	target = &outputTarget{ValuesFiles: []string{"base.yaml", "prod.yaml"}, OutputFile: StdioPath}
+	if err := target.validate(); err != nil {
+		t.Errorf("unexpected error streaming layered output: %v", err)
+	}
+}
+
+func TestUpgradeLayers_OverridesNotWritten(t *testing.T) {
+	oldDefaults := values.Values{"replicaCount": 1, "persistence::size": "8Gi"}
+	newDefaults := values.Values{"replicaCount": 1, "primary::persistence::size": "8Gi"}
+	file := values.Layer{Source: "values.yaml", Values: values.Values{"replicaCount": 2}}
+	overrides := values.Layer{Source: SetValuesSource, Values: values.Values{"replicaCount": 5, "persistence::size": "50Gi"}}
+
+	userValues, sources := values.Coalesce([]values.Layer{file, overrides})
+	classification := values.Classify(userValues, oldDefaults)
+	values.MarkRemovedInTarget(classification, oldDefaults, newDefaults)
+	values.AttributeSources(classification, sources)
+
+	plan := &upgradePlan{
+		OldDefaults:    oldDefaults,
+		NewDefaults:    newDefaults,
+		UserValues:     userValues,
+		Layers:         []values.Layer{file},
+		Overrides:      overrides.Values,
+		Classification: classification,
+	}
+
+	layers, err := upgradeLayers(plan, values.RemovedKeep, nil, false)
+	if err != nil {
+		t.Fatalf("upgradeLayers() error = %v", err)
+	}
+	written, _ := values.ParseYAML(joinLayers(layers))
+	if written["replicaCount"] != 2 {
+		t.Errorf("expected the file's own value to be written, got %v", written["replicaCount"])
+	}
+	if _, exists := written["persistence::size"]; exists {
+		t.Error("expected --set keys to stay out of the written file")
+	}
+
+	removed := removedOverrides(plan)
+	if len(removed) != 1 || removed[0].Path != "persistence::size" {
+		t.Fatalf("expected persistence::size as removed override, got %+v", removed)
+	}
+	if len(removed[0].RenamedTo) != 1 || removed[0].RenamedTo[0] != "primary::persistence::size" {
+		t.Errorf("expected rename candidate primary::persistence::size, got %v", removed[0].RenamedTo)
+	}
+}
+
+func TestUpgradeLayers_PreserveComments(t *testing.T) {
+	content := `# Our settings
+common: &common
+  tag: 1.0.0 # pinned
+api:
+  image: *common
+worker:
+  image:
+    <<: *common
+    pullPolicy: Always
+`
+	oldDefaults := values.Values{"common::tag": "1.0.0", "api::image::tag": "1.0.0", "worker::image::tag": "1.0.0", "worker::image::pullPolicy": "IfNotPresent"}
+	newDefaults := values.Values{"common::tag": "2.0.0", "api::image::tag": "2.0.0", "worker::image::tag": "2.0.0", "worker::image::pullPolicy": "IfNotPresent", "metrics::enabled": false}
+
+	userValues, err := values.ParseYAML(content)
+	if err != nil {
+		t.Fatalf("failed to parse values: %v", err)
+	}
+	layer := values.Layer{Source: "values.yaml", Values: userValues, Content: content}
+
+	plan := &upgradePlan{
+		OldDefaults:    oldDefaults,
+		NewDefaults:    newDefaults,
+		UserValues:     userValues,
+		Layers:         []values.Layer{layer},
+		NewComments:    values.CommentMap{"metrics.enabled": "Enable metrics"},
+		Classification: values.Classify(userValues, oldDefaults),
+	}
+
+	layers, err := upgradeLayers(plan, values.RemovedKeep, nil, true)
+	if err != nil {
+		t.Fatalf("upgradeLayers() error = %v", err)
+	}
+
+	upgraded := layers[0].UpgradedYAML
+	for _, want := range []string{"# Our settings", "common: &common\n  tag: 2.0.0 # pinned", "image: *common", "<<: *common", "pullPolicy: Always", "metrics:\n  ## Enable metrics\n  enabled: false"} {
+		if !strings.Contains(upgraded, want) {
+			t.Errorf("expected upgraded YAML to contain %q, got:\n%s", want, upgraded)
+		}
+	}
+
+	parsed, _ := values.ParseYAML(upgraded)
+	if parsed["worker::image::tag"] != "2.0.0" {
+		t.Errorf("expected merged tag to follow its anchor, got %v", parsed["worker::image::tag"])
+	}
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/manifest"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// Kinds of releases reported by outdated, besides the GitOps resource kinds
+const (
+	KindHelmfileRelease = "Helmfile"   // Release in a helmfile.yaml
+	KindDependency      = "Dependency" // Subchart pinned in a Chart.yaml
+)
+
+// OutdatedInput contains input parameters for outdated
+type OutdatedInput struct {
+	Path         string // Directory or file with GitOps manifests and Chart.yaml files
+	Helmfile     string // Read releases from this helmfile instead of Path
+	Environment  string // Helmfile environment used to resolve values file paths
+	Chart        string // Only report releases of this chart (default: all)
+	VersionsOnly bool   // Skip fetching chart defaults, so customized keys are not counted
+}
+
+// OutdatedOutput contains the results of outdated
+type OutdatedOutput struct {
+	Releases []OutdatedResult
+}
+
+// OutdatedResult holds the available versions for one release
+type OutdatedResult struct {
+	File            string
+	Kind            string
+	Name            string
+	Namespace       string
+	Chart           string
+	Repository      string
+	Version         string
+	Newer           *helm.NewerVersions          // Newest patch, minor and major versions, nil on error
+	Classification  *values.ClassificationResult // User values against the current version, nil when not fetched
+	PinnedImageTags []string                     // Image tag paths the user pins
+	Err             error                        // Why the release could not be checked; other releases still are
+}
+
+// Outdated lists the releases declared in manifests, a helmfile or Chart.yaml dependencies
+// and reports the newer chart versions available in their repositories
+func Outdated(ctx context.Context, input *OutdatedInput) (*OutdatedOutput, error) {
+	slog.Debug("starting outdated",
+		"path", input.Path,
+		"helmfile", input.Helmfile,
+		"environment", input.Environment,
+		"chart", input.Chart,
+	)
+
+	checker := &outdatedChecker{
+		input:    input,
+		versions: make(map[string][]*semver.Version),
+		defaults: make(map[string]values.Values),
+	}
+
+	if input.Helmfile != "" {
+		if err := checker.helmfile(ctx); err != nil {
+			return nil, err
+		}
+	} else if err := checker.scan(ctx); err != nil {
+		return nil, err
+	}
+
+	return &OutdatedOutput{Releases: checker.results}, nil
+}
+
+// outdatedChecker looks up releases, reusing repository indexes and chart defaults that
+// several releases share
+type outdatedChecker struct {
+	input    *OutdatedInput
+	versions map[string][]*semver.Version // Chart versions by repository and chart
+	defaults map[string]values.Values     // Flattened chart defaults by repository, chart and version
+	results  []OutdatedResult
+}
+
+// scan checks the GitOps releases and Chart.yaml dependencies under the input path
+func (c *outdatedChecker) scan(ctx context.Context) error {
+	files, err := manifest.Scan(c.input.Path)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		for _, release := range file.Releases {
+			result := OutdatedResult{
+				File:       release.File,
+				Kind:       release.Kind,
+				Name:       release.Name,
+				Namespace:  release.Namespace,
+				Chart:      release.Chart,
+				Repository: release.Repository,
+				Version:    release.Version,
+			}
+			if release.Repository == "" {
+				result.Err = fmt.Errorf("chart repository could not be resolved")
+			}
+			c.check(ctx, result, release.Values)
+		}
+	}
+
+	charts, err := manifest.ScanCharts(c.input.Path)
+	if err != nil {
+		return err
+	}
+	for _, chart := range charts {
+		var parentValues values.Values
+		var valuesErr error
+		if chart.ValuesFile != "" {
+			parentValues, valuesErr = values.ParseFile(chart.ValuesFile)
+		}
+
+		for _, dependency := range chart.Dependencies {
+			// Local subcharts are versioned together with their parent
+			if strings.HasPrefix(dependency.Repository, "file://") {
+				continue
+			}
+
+			result := OutdatedResult{
+				File:       chart.Path,
+				Kind:       KindDependency,
+				Name:       dependency.Key(),
+				Chart:      dependency.Name,
+				Repository: dependency.Repository,
+				Version:    dependency.Version,
+			}
+			switch {
+			case valuesErr != nil:
+				result.Err = fmt.Errorf("failed to read %s: %w", chart.ValuesFile, valuesErr)
+			case !strings.Contains(dependency.Repository, "://"):
+				result.Err = fmt.Errorf("repository %q is not a URL", dependency.Repository)
+			}
+			c.check(ctx, result, parentValues.Subtree(dependency.Key()))
+		}
+	}
+	return nil
+}
+
+// helmfile checks the releases of the input helmfile
+func (c *outdatedChecker) helmfile(ctx context.Context) error {
+	helmfile, err := manifest.ParseHelmfile(c.input.Helmfile, c.input.Environment)
+	if err != nil {
+		return err
+	}
+	for _, release := range helmfile.Releases {
+		result := OutdatedResult{
+			File:       helmfile.Path,
+			Kind:       KindHelmfileRelease,
+			Name:       release.Name,
+			Namespace:  release.Namespace,
+			Chart:      release.Chart,
+			Repository: release.Repository,
+			Version:    release.Version,
+		}
+		if release.Repository == "" {
+			result.Err = fmt.Errorf("chart is not from a repository declared in the helmfile")
+		}
+
+		var userValues values.Values
+		if result.Err == nil {
+			read, err := readUserValues(release.ValuesFiles, helm.SetValues{}, nil)
+			if err != nil {
+				result.Err = err
+			} else {
+				userValues = read.Combined
+			}
+		}
+		c.check(ctx, result, userValues)
+	}
+	return nil
+}
+
+// check looks up the newer versions of one release and records the result. A result that
+// already has an error is recorded as is
+func (c *outdatedChecker) check(ctx context.Context, result OutdatedResult, userValues values.Values) {
+	if c.input.Chart != "" && result.Chart != c.input.Chart {
+		return
+	}
+
+	if result.Err == nil {
+		result.Err = c.lookup(ctx, &result, userValues)
+	}
+	if result.Err != nil {
+		slog.Warn("failed to check release", "file", result.File, "name", result.Name, "error", result.Err)
+	}
+	c.results = append(c.results, result)
+}
+
+// lookup fills in the newer versions, pinned image tags and, unless only versions are
+// wanted, the classification of the user values against the current chart version
+func (c *outdatedChecker) lookup(ctx context.Context, result *OutdatedResult, userValues values.Values) error {
+	if err := unsupportedSource(result.Repository, result.Version); err != nil {
+		return err
+	}
+
+	key := result.Repository + " " + result.Chart
+	versions, ok := c.versions[key]
+	if !ok {
+		var err error
+		if versions, err = helm.ListVersions(ctx, result.Repository, result.Chart); err != nil {
+			return err
+		}
+		c.versions[key] = versions
+	}
+
+	newer, err := helm.FindNewer(versions, result.Version)
+	if err != nil {
+		return err
+	}
+	result.Newer = newer
+	result.PinnedImageTags = values.PinnedImageTags(userValues)
+
+	if c.input.VersionsOnly {
+		return nil
+	}
+
+	key += " " + result.Version
+	defaults, ok := c.defaults[key]
+	if !ok {
+		chart, err := helm.NewChartSource(result.Repository).GetChart(ctx, result.Chart, result.Version)
+		if err != nil {
+			return fmt.Errorf("failed to fetch chart defaults: %w", err)
+		}
+		defaults = values.Flatten(chart.Defaults)
+		c.defaults[key] = defaults
+	}
+	result.Classification = values.Classify(userValues, defaults)
+	return nil
+}
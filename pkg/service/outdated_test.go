@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const outdatedIndex = `apiVersion: v1
+entries:
+  app:
+  - name: app
+    version: 2.1.0
+  - name: app
+    version: 1.3.0
+  - name: app
+    version: 1.0.1
+  - name: app
+    version: 1.0.0
+generated: "2024-01-01T00:00:00Z"
+`
+
+// outdatedRepo serves a chart repository index and points Helm's cache at a temp directory
+func outdatedRepo(t *testing.T) string {
+	t.Helper()
+	t.Setenv("HELM_REPOSITORY_CACHE", t.TempDir())
+	t.Setenv("HELM_REPOSITORY_CONFIG", filepath.Join(t.TempDir(), "repositories.yaml"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(outdatedIndex))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestOutdated(t *testing.T) {
+	repoURL := outdatedRepo(t)
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"release.yaml": helmReleaseManifest + "---\n" + `apiVersion: source.toolkit.fluxcd.io/v1
+kind: HelmRepository
+metadata:
+  name: charts
+  namespace: apps
+spec:
+  url: ` + repoURL + "\n",
+		"platform/Chart.yaml": `apiVersion: v2
+name: platform
+version: 0.1.0
+dependencies:
+  - name: app
+    version: 1.3.0
+    repository: ` + repoURL + `
+    alias: backend
+  - name: common
+    version: 0.1.0
+    repository: file://../common
+  - name: other
+    version: 1.0.0
+    repository: "@stable"
+`,
+		"platform/values.yaml": "backend:\n  replicaCount: 2\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	output, err := Outdated(context.Background(), &OutdatedInput{Path: dir, VersionsOnly: true})
+	if err != nil {
+		t.Fatalf("Outdated() error = %v", err)
+	}
+	if len(output.Releases) != 3 {
+		t.Fatalf("expected the release and two repository dependencies, got %+v", output.Releases)
+	}
+
+	release := output.Releases[0]
+	if release.Err != nil {
+		t.Fatalf("unexpected error for %s: %v", release.Name, release.Err)
+	}
+	if release.Newer.Patch != "1.0.1" || release.Newer.Minor != "1.3.0" || release.Newer.Major != "2.1.0" {
+		t.Errorf("unexpected newer versions %+v", release.Newer)
+	}
+	if len(release.PinnedImageTags) != 1 || release.PinnedImageTags[0] != "image::tag" {
+		t.Errorf("expected the pinned image tag to be reported, got %v", release.PinnedImageTags)
+	}
+	if release.Classification != nil {
+		t.Error("expected no classification when only versions are checked")
+	}
+
+	dependency := output.Releases[1]
+	if dependency.Kind != KindDependency || dependency.Name != "backend" || dependency.Err != nil {
+		t.Fatalf("unexpected dependency result %+v", dependency)
+	}
+	if dependency.Newer.Patch != "" || dependency.Newer.Minor != "" || dependency.Newer.Major != "2.1.0" {
+		t.Errorf("unexpected newer versions %+v", dependency.Newer)
+	}
+
+	if named := output.Releases[2]; named.Err == nil || !strings.Contains(named.Err.Error(), "not a URL") {
+		t.Errorf("expected an error for a repository name, got %+v", named)
+	}
+
+	output, err = Outdated(context.Background(), &OutdatedInput{Path: dir, Chart: "other", VersionsOnly: true})
+	if err != nil {
+		t.Fatalf("Outdated() error = %v", err)
+	}
+	if len(output.Releases) != 1 || output.Releases[0].Chart != "other" {
+		t.Errorf("expected only releases of the chart, got %+v", output.Releases)
+	}
+}
+
+func TestOutdated_Helmfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "helmfile.yaml")
+	content := `releases:
+  - name: app
+    chart: ./charts/app
+    version: 1.0.0
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write helmfile: %v", err)
+	}
+
+	output, err := Outdated(context.Background(), &OutdatedInput{Helmfile: path})
+	if err != nil {
+		t.Fatalf("Outdated() error = %v", err)
+	}
+	if len(output.Releases) != 1 || output.Releases[0].Kind != KindHelmfileRelease || output.Releases[0].Err == nil {
+		t.Errorf("expected the local chart to be reported with an error, got %+v", output.Releases)
+	}
+
+	if _, err := Outdated(context.Background(), &OutdatedInput{Helmfile: filepath.Join(dir, "missing.yaml")}); err == nil {
+		t.Error("expected error for a missing helmfile")
+	}
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// outputTarget describes where an upgraded values file is written
+type outputTarget struct {
+	Chart       string
+	ToVersion   string
+	ValuesFiles []string  // Input values files, overwritten in in-place mode
+	OutputDir   string    // Directory for timestamped output files, or "-" for stdout
+	OutputFile  string    // Exact output path, takes precedence over OutputDir, or "-" for stdout
+	InPlace     bool      // Overwrite the input values file
+	Backup      bool      // Keep a .bak copy of an existing file before overwriting it
+	Stdout      io.Writer // Destination when streaming to stdout (default: os.Stdout)
+	Layer       string    // Name of the layered values file this target writes, appended to generated file names
+}
+
+// validate checks that the output options don't contradict each other
+func (t *outputTarget) validate() error {
+	if t.InPlace && t.OutputFile != "" {
+		return fmt.Errorf("in-place mode and an output file cannot be used together")
+	}
+	if t.InPlace {
+		if len(t.ValuesFiles) == 0 {
+			return fmt.Errorf("in-place mode requires a values file")
+		}
+		for _, path := range t.ValuesFiles {
+			if path == StdioPath {
+				return fmt.Errorf("in-place mode requires a values file, not stdin")
+			}
+		}
+	}
+	if len(t.ValuesFiles) > 1 && t.OutputFile != "" && t.OutputFile != StdioPath {
+		return fmt.Errorf("an output file cannot be used with multiple values files")
+	}
+	return nil
+}
+
+// forLayer returns the target for one of several layered values files
+func (t *outputTarget) forLayer(valuesFile string) *outputTarget {
+	layer := *t
+	layer.ValuesFiles = []string{valuesFile}
+
+	// Generated file names only need telling apart when there are several layers
+	if len(t.ValuesFiles) > 1 {
+		layer.Layer = "stdin"
+		if valuesFile != StdioPath {
+			layer.Layer = strings.TrimSuffix(filepath.Base(valuesFile), filepath.Ext(valuesFile))
+		}
+	}
+	return &layer
+}
+
+// streaming reports whether the upgraded values go to stdout instead of a file
+func (t *outputTarget) streaming() bool {
+	return StreamsOutput(t.OutputDir, t.OutputFile, t.InPlace)
+}
+
+// StreamsOutput reports whether the given output options write the upgraded values to stdout
+func StreamsOutput(outputDir, outputFile string, inPlace bool) bool {
+	if inPlace {
+		return false
+	}
+	if outputFile != "" {
+		return outputFile == StdioPath
+	}
+	return outputDir == StdioPath
+}
+
+// path returns the file the upgraded values are written to
+func (t *outputTarget) path() string {
+	switch {
+	case t.InPlace:
+		return t.ValuesFiles[0]
+	case t.OutputFile != "":
+		return t.OutputFile
+	default:
+		suffix := ""
+		if t.Layer != "" {
+			suffix = "-" + t.Layer
+		}
+		fileName := fmt.Sprintf("%s-%s-%s%s.yaml", t.Chart, t.ToVersion, time.Now().Format("2006-01-02-150405"), suffix)
+		return filepath.Join(t.OutputDir, fileName)
+	}
+}
+
+// write writes the upgraded values to the target path and returns that path
+func (t *outputTarget) write(content string) (string, error) {
+	if t.streaming() {
+		stdout := t.Stdout
+		if stdout == nil {
+			stdout = os.Stdout
+		}
+		if _, err := io.WriteString(stdout, content); err != nil {
+			return "", fmt.Errorf("failed to write upgraded values to stdout: %w", err)
+		}
+		return StdioPath, nil
+	}
+
+	outputPath := t.path()
+	slog.Debug("writing output file", "path", outputPath, "inPlace", t.InPlace, "backup", t.Backup)
+
+	// Create output directory if needed
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	if t.Backup {
+		if err := backupFile(outputPath); err != nil {
+			return "", err
+		}
+	}
+
+	if err := writeFileAtomic(outputPath, []byte(content)); err != nil {
+		return "", fmt.Errorf("failed to write upgraded values: %w", err)
+	}
+
+	return outputPath, nil
+}
+
+// backupFile copies an existing file to <path>.bak. Missing files are not an error
+func backupFile(path string) error {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read file for backup: %w", err)
+	}
+
+	backupPath := path + ".bak"
+	if err := writeFileAtomic(backupPath, content); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	slog.Debug("wrote backup", "path", backupPath)
+	return nil
+}
+
+// writeFileAtomic writes data to a temp file in the target directory and renames it into place,
+// so readers never observe a partially written file. An existing file's permissions are kept
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	// Clean up the temp file on any failure; after a successful rename this is a no-op
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputTarget_Path(t *testing.T) {
+	tests := []struct {
+		name   string
+		target *outputTarget
+		check  func(t *testing.T, path string)
+	}{
+		{
+			name:   "in place",
+			target: &outputTarget{ValuesFiles: []string{"values.yaml"}, OutputDir: "out", InPlace: true},
+			check: func(t *testing.T, path string) {
+				if path != "values.yaml" {
+					t.Errorf("expected values.yaml, got %s", path)
+				}
+			},
+		},
+		{
+			name:   "output file",
+			target: &outputTarget{ValuesFiles: []string{"values.yaml"}, OutputDir: "out", OutputFile: "upgraded/values.yaml"},
+			check: func(t *testing.T, path string) {
+				if path != "upgraded/values.yaml" {
+					t.Errorf("expected upgraded/values.yaml, got %s", path)
+				}
+			},
+		},
+		{
+			name:   "timestamped",
+			target: &outputTarget{Chart: "postgresql", ToVersion: "16.0.0", OutputDir: "out"},
+			check: func(t *testing.T, path string) {
+				if filepath.Dir(path) != "out" {
+					t.Errorf("expected file in out/, got %s", path)
+				}
+				base := filepath.Base(path)
+				if !strings.HasPrefix(base, "postgresql-16.0.0-") || !strings.HasSuffix(base, ".yaml") {
+					t.Errorf("unexpected timestamped file name %s", base)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, tt.target.path())
+		})
+	}
+}
+
+func TestOutputTarget_Validate(t *testing.T) {
+	target := &outputTarget{InPlace: true, OutputFile: "values.yaml"}
+	if err := target.validate(); err == nil {
+		t.Error("expected error when combining in-place and output file")
+	}
+
+	target = &outputTarget{ValuesFiles: []string{"values.yaml"}, InPlace: true}
+	if err := target.validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestOutputTarget_WriteInPlaceWithBackup(t *testing.T) {
+	tmpDir := t.TempDir()
+	valuesFile := filepath.Join(tmpDir, "values.yaml")
+	if err := os.WriteFile(valuesFile, []byte("key: old\n"), 0600); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	target := &outputTarget{ValuesFiles: []string{valuesFile}, InPlace: true, Backup: true}
+	outputPath, err := target.write("key: new\n")
+	if err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	if outputPath != valuesFile {
+		t.Errorf("expected output path %s, got %s", valuesFile, outputPath)
+	}
+
+	content, _ := os.ReadFile(valuesFile)
+	if string(content) != "key: new\n" {
+		t.Errorf("expected updated content, got %q", content)
+	}
+
+	backup, err := os.ReadFile(valuesFile + ".bak")
+	if err != nil {
+		t.Fatalf("expected backup file: %v", err)
+	}
+	if string(backup) != "key: old\n" {
+		t.Errorf("expected original content in backup, got %q", backup)
+	}
+
+	info, _ := os.Stat(valuesFile)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected file mode to be preserved, got %v", info.Mode().Perm())
+	}
+
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 2 {
+		t.Errorf("expected only the values file and its backup, got %d entries", len(entries))
+	}
+}
+
+func TestOutputTarget_WriteOutputFileCreatesDirectory(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "nested", "values.yaml")
+
+	target := &outputTarget{OutputFile: outputFile, Backup: true}
+	if _, err := target.write("key: value\n"); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	if _, err := os.Stat(outputFile); err != nil {
+		t.Errorf("expected output file to exist: %v", err)
+	}
+	if _, err := os.Stat(outputFile + ".bak"); !os.IsNotExist(err) {
+		t.Error("expected no backup when the output file did not exist")
+	}
+}
+
+func TestStreamsOutput(t *testing.T) {
+	tests := []struct {
+		name       string
+		outputDir  string
+		outputFile string
+		inPlace    bool
+		want       bool
+	}{
+		{"output dir stdout", "-", "", false, true},
+		{"output file stdout", "./out", "-", false, true},
+		{"output file overrides dir", "-", "values.yaml", false, false},
+		{"in place", "-", "", true, false},
+		{"directory", "./out", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StreamsOutput(tt.outputDir, tt.outputFile, tt.inPlace); got != tt.want {
+				t.Errorf("StreamsOutput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputTarget_WriteStdout(t *testing.T) {
+	outputDir := t.TempDir()
+	var stdout bytes.Buffer
+
+	target := &outputTarget{OutputFile: StdioPath, OutputDir: outputDir, Stdout: &stdout}
+	outputPath, err := target.write("key: value\n")
+	if err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	if outputPath != StdioPath {
+		t.Errorf("expected output path %q, got %q", StdioPath, outputPath)
+	}
+	if stdout.String() != "key: value\n" {
+		t.Errorf("expected upgraded values on stdout, got %q", stdout.String())
+	}
+
+	entries, _ := os.ReadDir(outputDir)
+	if len(entries) != 0 {
+		t.Errorf("expected no files written when streaming, got %d", len(entries))
+	}
+}
+
+func TestOutputTarget_ValidateInPlaceStdin(t *testing.T) {
+	target := &outputTarget{ValuesFiles: []string{StdioPath}, InPlace: true}
+	if err := target.validate(); err == nil {
+		t.Error("expected error for in-place mode with stdin values")
+	}
+
+	// Values read from a release have no file to overwrite
+	target = &outputTarget{InPlace: true}
+	if err := target.validate(); err == nil {
+		t.Error("expected error for in-place mode without a values file")
+	}
+}
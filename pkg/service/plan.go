@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// planInput contains the parameters shared by every command that upgrades values
+type planInput struct {
+	Chart       string
+	Repository  string
+	Source      helm.ChartSource // Where charts are fetched from (default: chosen from Repository)
+	FromVersion string
+	ToVersion   string
+	ValuesFiles []string // Layered values files, later files override earlier ones
+	Stdin       io.Reader
+	SetValues   helm.SetValues // --set style overrides layered on top of ValuesFiles
+	UserValues  values.Values  // Already loaded user values (e.g. from a release); skips ValuesFiles
+	Policy      *values.Policy // Policy rules consulted by the merge
+	Layers      []values.Layer // Already read values files; skips ValuesFiles
+}
+
+// upgradePlan holds the intermediate results of upgrading a values file, before anything is written
+type upgradePlan struct {
+	NewChart       *helm.ChartInfo
+	OldDefaults    values.Values
+	NewDefaults    values.Values
+	UserValues     values.Values  // Coalesced user values from every layer
+	Layers         []values.Layer // Individual values files, in order
+	Overrides      values.Values  // --set style overrides, not written to any file
+	NewComments    values.CommentMap
+	Classification *values.ClassificationResult
+	Policy         *values.Policy
+	Upgraded       values.Values
+}
+
+// planUpgrade fetches both chart versions, classifies the user values against the old
+// defaults and merges them onto the new defaults
+func planUpgrade(ctx context.Context, input *planInput) (*upgradePlan, error) {
+	oldChart, newChart, err := fetchCharts(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Flatten defaults, including the defaults of any subcharts
+	oldDefaults := values.Flatten(oldChart.Defaults)
+	slog.Debug("parsed old defaults", "count", len(oldDefaults))
+
+	newDefaults := values.Flatten(newChart.Defaults)
+	slog.Debug("parsed new defaults", "count", len(newDefaults))
+
+	// Parse user values
+	userValues := input.UserValues
+	var (
+		layers    []values.Layer
+		overrides values.Values
+		sources   map[string]string
+	)
+	if userValues == nil {
+		slog.Debug("parsing user values", "files", input.ValuesFiles, "layers", len(input.Layers))
+
+		read, err := userValuesFor(input.ValuesFiles, input.Layers, input.SetValues, input.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		layers, overrides, userValues, sources = read.Files, read.Overrides, read.Combined, read.Sources
+	}
+
+	slog.Debug("parsed user values", "count", len(userValues), "layers", len(layers))
+
+	// Classify user values against old defaults
+	slog.Debug("classifying user values")
+
+	classification := values.Classify(userValues, oldDefaults)
+	values.MarkRemovedInTarget(classification, oldDefaults, newDefaults)
+	values.AttributeSources(classification, sources)
+	values.ApplyPolicy(classification, input.Policy)
+
+	slog.Debug("classification complete",
+		"customized", classification.Customized,
+		"copiedDefault", classification.CopiedDefault,
+		"unknown", classification.Unknown,
+		"removed", classification.Removed,
+	)
+
+	// Extract comments from new chart defaults
+	slog.Debug("extracting comments from target chart")
+
+	newComments := values.ExtractComments(newChart.Values)
+	slog.Debug("extracted comments", "count", len(newComments))
+
+	// Merge values
+	slog.Debug("generating upgraded values")
+
+	return &upgradePlan{
+		NewChart:       newChart,
+		OldDefaults:    oldDefaults,
+		NewDefaults:    newDefaults,
+		UserValues:     userValues,
+		Layers:         layers,
+		Overrides:      overrides,
+		NewComments:    newComments,
+		Classification: classification,
+		Policy:         input.Policy,
+		Upgraded:       values.Merge(userValues, oldDefaults, newDefaults, input.Policy),
+	}, nil
+}
+
+// fetchCharts fetches the old and new chart versions in parallel.
+// When both versions are the same the chart is only fetched once
+func fetchCharts(ctx context.Context, input *planInput) (*helm.ChartInfo, *helm.ChartInfo, error) {
+	slog.Debug("fetching chart defaults",
+		"oldVersion", input.FromVersion,
+		"newVersion", input.ToVersion,
+	)
+
+	source := chartSource(input.Source, input.Repository)
+
+	if input.FromVersion == input.ToVersion {
+		chart, err := source.GetChart(ctx, input.Chart, input.FromVersion)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch chart defaults: %w", err)
+		}
+		return chart, chart, nil
+	}
+
+	var (
+		oldChart, newChart       *helm.ChartInfo
+		oldFetchErr, newFetchErr error
+		wg                       sync.WaitGroup
+	)
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		oldChart, oldFetchErr = source.GetChart(ctx, input.Chart, input.FromVersion)
+	}()
+
+	go func() {
+		defer wg.Done()
+		newChart, newFetchErr = source.GetChart(ctx, input.Chart, input.ToVersion)
+	}()
+
+	wg.Wait()
+
+	// Check for fetch errors
+	if oldFetchErr != nil {
+		return nil, nil, fmt.Errorf("failed to fetch old chart defaults: %w", oldFetchErr)
+	}
+	if newFetchErr != nil {
+		return nil, nil, fmt.Errorf("failed to fetch new chart defaults: %w", newFetchErr)
+	}
+
+	return oldChart, newChart, nil
+}
+
+// chartSource returns source, or the source for repository when none was given
+func chartSource(source helm.ChartSource, repository string) helm.ChartSource {
+	if source != nil {
+		return source
+	}
+	return helm.NewChartSource(repository)
+}
+
+// validateSchema checks the upgraded values against the target chart's values.schema.json
+func (p *upgradePlan) validateSchema(upgraded values.Values) []string {
+	// Helm removes null keys before validating, so deletions can't violate the schema
+	effective := make(values.Values, len(upgraded))
+	for path, value := range upgraded {
+		if value != nil {
+			effective[path] = value
+		}
+	}
+
+	violations := helm.ValidateValues(p.NewChart.Schema, values.Unflatten(effective))
+	if len(violations) > 0 {
+		slog.Debug("schema violations in upgraded values", "count", len(violations))
+	}
+	return violations
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/helm/helmtest"
+)
+
+func TestReadReleaseValues(t *testing.T) {
+	cfg := helmtest.NewActionConfig(t, helmtest.Release("db", 1, "12.1.0", map[string]interface{}{
+		"replicaCount": 3,
+		"auth":         map[string]interface{}{"database": "app"},
+	}))
+
+	rel, userValues, err := readReleaseValues(cfg, "db", "default")
+	if err != nil {
+		t.Fatalf("readReleaseValues() error = %v", err)
+	}
+
+	if rel.ChartVersion != "12.1.0" {
+		t.Errorf("expected chart version 12.1.0, got %s", rel.ChartVersion)
+	}
+	if userValues["replicaCount"] != 3 {
+		t.Errorf("expected replicaCount=3, got %v (%T)", userValues["replicaCount"], userValues["replicaCount"])
+	}
+	if userValues["auth::database"] != "app" {
+		t.Errorf("expected auth::database=app, got %v", userValues["auth::database"])
+	}
+}
+
+func TestUpgrade_ReleaseResolvesFromVersion(t *testing.T) {
+	cfg := helmtest.NewActionConfig(t, helmtest.Release("db", 1, "12.1.0", nil))
+
+	// The deployed version becomes --from, so targeting it is rejected before any chart is fetched
+	_, err := Upgrade(context.Background(), &UpgradeInput{
+		Chart:         "postgresql",
+		Repository:    "https://charts.bitnami.com/bitnami",
+		ToVersion:     "12.1.0",
+		Release:       "db",
+		ReleaseConfig: cfg,
+		DryRun:        true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "identical: 12.1.0") {
+		t.Errorf("expected identical versions error, got %v", err)
+	}
+}
+
+func TestUpgrade_ReleaseNotFound(t *testing.T) {
+	_, err := Upgrade(context.Background(), &UpgradeInput{
+		Chart:         "postgresql",
+		Repository:    "https://charts.bitnami.com/bitnami",
+		ToVersion:     "16.0.0",
+		Release:       "missing",
+		ReleaseConfig: helmtest.NewActionConfig(t),
+		DryRun:        true,
+	})
+	if err == nil {
+		t.Error("expected error for missing release")
+	}
+}
+
+func TestUpgrade_ReleaseAndValuesFile(t *testing.T) {
+	_, err := Upgrade(context.Background(), &UpgradeInput{
+		Chart:       "postgresql",
+		Repository:  "https://charts.bitnami.com/bitnami",
+		ToVersion:   "16.0.0",
+		ValuesFiles: []string{"values.yaml"},
+		Release:     "db",
+		DryRun:      true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "cannot be used together") {
+		t.Errorf("expected conflicting sources error, got %v", err)
+	}
+}
+
+func TestUpgrade_ReleaseAndSetValues(t *testing.T) {
+	_, err := Upgrade(context.Background(), &UpgradeInput{
+		Chart:      "postgresql",
+		Repository: "https://charts.bitnami.com/bitnami",
+		ToVersion:  "16.0.0",
+		Release:    "db",
+		SetValues:  helm.SetValues{Values: []string{"a=b"}},
+		DryRun:     true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "--set") {
+		t.Errorf("expected --set with release error, got %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/manifest"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+// ScanInput contains input parameters for scan
+type ScanInput struct {
+	Path          string                  // Directory or file holding the manifests
+	Chart         string                  // Only handle releases of this chart (default: all)
+	ToVersion     string                  // Upgrade to this version, or "latest"; empty only classifies
+	DryRun        bool                    // Upgrade without rewriting the manifests
+	UpgradeImages bool                    // Upgrade custom image tags that match the old chart default
+	RemovedKeys   values.RemovedKeyAction // How to write user keys removed in the target chart
+	Policy        *values.Policy          // Policy rules for keys that must not be upgraded as usual
+}
+
+// ScanOutput contains the results of scan
+type ScanOutput struct {
+	Releases     []ScanResult
+	ChangedFiles []string // Manifests rewritten, or that would be in a dry run
+}
+
+// ScanResult holds the outcome for one release found in the manifests
+type ScanResult struct {
+	File           string
+	Kind           string
+	Name           string
+	Namespace      string
+	Chart          string
+	Repository     string
+	FromVersion    string
+	ToVersion      string // Empty when only classifying
+	Classification *values.ClassificationResult
+	Upgraded       bool  // Whether the inline values and version were rewritten
+	Err            error // Why the release could not be handled; other releases still are
+}
+
+// Scan finds the Flux HelmReleases and Argo CD Applications under a path and classifies their
+// inline values, or upgrades them to a new chart version and rewrites the manifests in place
+func Scan(ctx context.Context, input *ScanInput) (*ScanOutput, error) {
+	slog.Debug("starting scan",
+		"path", input.Path,
+		"chart", input.Chart,
+		"toVersion", input.ToVersion,
+		"dryRun", input.DryRun,
+	)
+
+	files, err := manifest.Scan(input.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &ScanOutput{}
+	for _, file := range files {
+		for _, release := range file.Releases {
+			if input.Chart != "" && release.Chart != input.Chart {
+				continue
+			}
+
+			result := scanRelease(ctx, release, input)
+			if result.Err != nil {
+				slog.Warn("failed to handle release", "file", release.File, "name", release.Name, "error", result.Err)
+			}
+			output.Releases = append(output.Releases, result)
+		}
+
+		if !file.Changed() {
+			continue
+		}
+		output.ChangedFiles = append(output.ChangedFiles, file.Path)
+		if input.DryRun {
+			continue
+		}
+
+		content, err := file.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFileAtomic(file.Path, content); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.Path, err)
+		}
+		slog.Debug("rewrote manifest", "path", file.Path)
+	}
+
+	return output, nil
+}
+
+// scanRelease classifies or upgrades a single release. Inline values only hold the keys the
+// user set, so they are upgraded like a layered values file and don't pick up chart defaults
+func scanRelease(ctx context.Context, release *manifest.Release, input *ScanInput) ScanResult {
+	result := ScanResult{
+		File:        release.File,
+		Kind:        release.Kind,
+		Name:        release.Name,
+		Namespace:   release.Namespace,
+		Chart:       release.Chart,
+		Repository:  release.Repository,
+		FromVersion: release.Version,
+	}
+
+	if release.Repository == "" {
+		result.Err = fmt.Errorf("chart repository could not be resolved")
+		return result
+	}
+	if err := unsupportedScanSource(release.Repository, release.Version, input.ToVersion); err != nil {
+		result.Err = err
+		return result
+	}
+
+	toVersion := release.Version
+	if input.ToVersion != "" {
+		resolved, err := helm.ResolveVersion(ctx, release.Repository, release.Chart, input.ToVersion)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		toVersion = resolved
+	}
+
+	plan, err := planUpgrade(ctx, &planInput{
+		Chart:       release.Chart,
+		Repository:  release.Repository,
+		FromVersion: release.Version,
+		ToVersion:   toVersion,
+		UserValues:  release.Values,
+		Policy:      input.Policy,
+	})
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Classification = plan.Classification
+
+	if input.ToVersion == "" || toVersion == release.Version {
+		return result
+	}
+	result.ToVersion = toVersion
+
+	if err := upgradeRelease(release, plan, input, toVersion); err != nil {
+		result.Err = err
+		return result
+	}
+	result.Upgraded = true
+	return result
+}
+
+// upgradeRelease rewrites the inline values and chart version of a release
+func upgradeRelease(release *manifest.Release, plan *upgradePlan, input *ScanInput, toVersion string) error {
+	if len(release.Values) > 0 {
+		upgraded := values.MergeLayer(plan.UserValues, plan.OldDefaults, plan.NewDefaults, plan.Policy)
+
+		removedKeysComment, err := applyRemovedKeyAction(upgraded, plan.Classification, input.RemovedKeys)
+		if err != nil {
+			return err
+		}
+
+		if input.UpgradeImages {
+			if changes := values.DetectCustomImageTags(plan.UserValues, plan.OldDefaults, plan.NewDefaults); len(changes) > 0 {
+				upgraded = values.ApplyImageUpgrades(upgraded, changes)
+			}
+		}
+
+		original, err := release.ValuesYAML()
+		if err != nil {
+			return err
+		}
+		patched, err := values.PatchYAML(original, upgraded, nil)
+		if err != nil {
+			return fmt.Errorf("failed to upgrade inline values: %w", err)
+		}
+		if err := release.SetValues(patched + removedKeysComment); err != nil {
+			return err
+		}
+	}
+
+	return release.SetVersion(toVersion)
+}
+
+// unsupportedSource reports why a chart can't be looked up in a repository index: OCI
+// registries have no index, and a version must be pinned to compare against
+func unsupportedSource(repository, version string) error {
+	if strings.HasPrefix(repository, "oci://") {
+		return fmt.Errorf("OCI chart repositories are not supported")
+	}
+	return unpinnedVersion(version)
+}
+
+// unsupportedScanSource reports why a scanned release can't be classified or upgraded to
+// toVersion. Charts are pulled from OCI registries by version, so only resolving the latest
+// version needs a repository index
+func unsupportedScanSource(repository, version, toVersion string) error {
+	if toVersion == helm.LatestVersion && strings.HasPrefix(repository, "oci://") {
+		return fmt.Errorf("OCI chart repositories have no index to find the latest version in, pass --to a version")
+	}
+	return unpinnedVersion(version)
+}
+
+// unpinnedVersion reports why a chart version can't be compared against
+func unpinnedVersion(version string) error {
+	switch {
+	case version == "":
+		return fmt.Errorf("chart version is not pinned")
+	case strings.ContainsAny(version, "*xX^~<>=| ,"):
+		return fmt.Errorf("chart version %s is a range, not a pinned version", version)
+	}
+	return nil
+}
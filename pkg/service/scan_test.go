@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/manifest"
+	"github.com/itsvictorfy/hvu/pkg/values"
+)
+
+const helmReleaseManifest = `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: app
+  namespace: apps
+spec:
+  chart:
+    spec:
+      chart: app
+      version: 1.0.0
+      sourceRef:
+        kind: HelmRepository
+        name: charts
+  values:
+    replicaCount: 3 # prod
+    image:
+      tag: 1.0.0
+`
+
+// scanManifest writes a manifest to a temp directory and returns the release it declares
+func scanManifest(t *testing.T, content string) (*manifest.File, *manifest.Release) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "release.yaml"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	files, err := manifest.Scan(dir)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(files) != 1 || len(files[0].Releases) != 1 {
+		t.Fatalf("expected one release, got %v", files)
+	}
+	return files[0], files[0].Releases[0]
+}
+
+func TestUpgradeRelease(t *testing.T) {
+	file, release := scanManifest(t, helmReleaseManifest)
+
+	oldDefaults := values.Values{"replicaCount": 1, "image::tag": "1.0.0"}
+	newDefaults := values.Values{"replicaCount": 1, "image::tag": "2.0.0", "metrics::enabled": false}
+	plan := &upgradePlan{
+		OldDefaults:    oldDefaults,
+		NewDefaults:    newDefaults,
+		UserValues:     release.Values,
+		Classification: values.Classify(release.Values, oldDefaults),
+	}
+
+	if err := upgradeRelease(release, plan, &ScanInput{}, "2.0.0"); err != nil {
+		t.Fatalf("upgradeRelease() error = %v", err)
+	}
+
+	out, err := file.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+	for _, want := range []string{"version: 2.0.0", "replicaCount: 3 # prod", "tag: 2.0.0"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected manifest to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(string(out), "metrics") {
+		t.Errorf("expected new chart defaults to stay out of inline values, got:\n%s", out)
+	}
+}
+
+func TestUpgradeRelease_RemovedKeysComment(t *testing.T) {
+	file, release := scanManifest(t, helmReleaseManifest)
+
+	oldDefaults := values.Values{"replicaCount": 1, "image::tag": "1.0.0"}
+	newDefaults := values.Values{"image::tag": "2.0.0"}
+	classification := values.Classify(release.Values, oldDefaults)
+	values.MarkRemovedInTarget(classification, oldDefaults, newDefaults)
+	plan := &upgradePlan{
+		OldDefaults:    oldDefaults,
+		NewDefaults:    newDefaults,
+		UserValues:     release.Values,
+		Classification: classification,
+	}
+
+	if err := upgradeRelease(release, plan, &ScanInput{RemovedKeys: values.RemovedComment}, "2.0.0"); err != nil {
+		t.Fatalf("upgradeRelease() error = %v", err)
+	}
+
+	out, err := file.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+	for _, want := range []string{"# Keys removed in the target chart version", "# replicaCount: 3", "tag: 2.0.0"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected manifest to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(string(out), "\n    replicaCount: 3") {
+		t.Errorf("expected removed key to be dropped from the values, got:\n%s", out)
+	}
+}
+
+func TestScanRelease_Unsupported(t *testing.T) {
+	tests := []struct {
+		name    string
+		release *manifest.Release
+		wantErr string
+	}{
+		{"no repository", &manifest.Release{Chart: "app", Version: "1.0.0"}, "could not be resolved"},
+		{"oci latest", &manifest.Release{Chart: "app", Version: "1.0.0", Repository: "oci://ghcr.io/org"}, "OCI"},
+		{"unpinned", &manifest.Release{Chart: "app", Repository: "https://charts.example.com"}, "not pinned"},
+		{"range", &manifest.Release{Chart: "app", Version: ">=1.0.0", Repository: "https://charts.example.com"}, "range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := scanRelease(context.Background(), tt.release, &ScanInput{ToVersion: helm.LatestVersion})
+			if result.Err == nil || !strings.Contains(result.Err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, result.Err)
+			}
+		})
+	}
+}
+
+func TestUnsupportedScanSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		repository string
+		version    string
+		toVersion  string
+		wantErr    bool
+	}{
+		{"oci to latest", "oci://ghcr.io/org", "1.0.0", helm.LatestVersion, true},
+		{"oci to version", "oci://ghcr.io/org", "1.0.0", "2.0.0", false},
+		{"oci classify only", "oci://ghcr.io/org", "1.0.0", "", false},
+		{"repository to latest", "https://charts.example.com", "1.0.0", helm.LatestVersion, false},
+		{"oci unpinned", "oci://ghcr.io/org", "", "2.0.0", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := unsupportedScanSource(tt.repository, tt.version, tt.toVersion)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unsupportedScanSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScan_ChartFilter(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "release.yaml"), []byte(helmReleaseManifest), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	output, err := Scan(context.Background(), &ScanInput{Path: dir, Chart: "other"})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(output.Releases) != 0 {
+		t.Errorf("expected releases of other charts to be skipped, got %v", output.Releases)
+	}
+
+	// Without a HelmRepository the release is reported, not fatal
+	output, err = Scan(context.Background(), &ScanInput{Path: dir})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(output.Releases) != 1 || output.Releases[0].Err == nil {
+		t.Errorf("expected one release with an error, got %+v", output.Releases)
+	}
+
+	if _, err := Scan(context.Background(), &ScanInput{Path: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("expected error for a missing path")
+	}
+}
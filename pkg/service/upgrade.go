@@ -1,13 +1,15 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log/slog"
-	"os"
-	"path/filepath"
-	"sync"
-	"time"
+	"strings"
 
+	"helm.sh/helm/v3/pkg/action"
+
+	"github.com/itsvictorfy/hvu/pkg/git"
 	"github.com/itsvictorfy/hvu/pkg/helm"
 	"github.com/itsvictorfy/hvu/pkg/values"
 )
@@ -16,133 +18,224 @@ import (
 type UpgradeInput struct {
 	Chart         string
 	Repository    string
-	FromVersion   string
+	Source        helm.ChartSource // Where charts are fetched from (default: chosen from Repository)
+	FromVersion   string           // Defaults to the deployed chart version when Release is set
 	ToVersion     string
-	ValuesFile    string
-	OutputDir     string
+	ValuesFiles   []string              // Values files layered in order like repeated helm -f flags, "-" for stdin
+	Values        []values.Layer        // Already read values files, used instead of ValuesFiles
+	Release       string                // Read user values from this deployed release instead of ValuesFiles
+	Namespace     string                // Namespace of Release (default: current kubeconfig namespace)
+	ReleaseConfig *action.Configuration // Helm configuration Release is read from (default: current kubeconfig)
+	SetValues     helm.SetValues        // --set style overrides applied after ValuesFiles, never written out
+	Stdin         io.Reader             // Source for a values file of "-" (default: os.Stdin)
+	Stdout        io.Writer             // Destination for an OutputDir or OutputFile of "-" (default: os.Stdout)
+	OutputDir     string                // Directory for timestamped output files, or "-" for stdout
+	OutputFile    string                // Exact output path, overrides OutputDir
+	InPlace       bool                  // Overwrite each values file instead of writing new files
+	Backup        bool                  // Keep a .bak copy of a file before overwriting it
 	DryRun        bool
-	UpgradeImages bool // If true, automatically upgrade custom image tags
+	UpgradeImages bool                    // If true, automatically upgrade custom image tags
+	RemovedKeys   values.RemovedKeyAction // How to write user keys removed in the target chart
+	Policy        *values.Policy          // Policy rules for keys that must not be upgraded as usual
+
+	// PreserveComments patches each values file instead of regenerating it from the chart's
+	// values.yaml, keeping the file's comments, key order, anchors and aliases
+	PreserveComments bool
+
+	Git       bool             // Commit the upgraded values files; implies InPlace
+	PatchFile string           // Write the upgrade as a patch to this path instead of committing; implies InPlace
+	Redactor  *values.Redactor // Masks sensitive values in the commit message
 }
 
 // UpgradeOutput contains the results of upgrade
 type UpgradeOutput struct {
 	Classification     *values.ClassificationResult
+	FromVersion        string // Source chart version, resolved from the release if not given
 	UpgradedYAML       string
 	OutputPath         string
 	OldDefaultsCount   int
 	NewDefaultsCount   int
 	UserValuesCount    int
-	CustomImageTags    []values.ImageChange // Detected custom image tags
-	ImageTagsUpgraded  bool                 // Whether user chose to upgrade image tags
-	PromptForImageTags bool                 // Whether to prompt user about image tags
+	CustomImageTags    []values.ImageChange     // Detected custom image tags
+	ImageTagsUpgraded  bool                     // Whether user chose to upgrade image tags
+	PromptForImageTags bool                     // Whether to prompt user about image tags
+	UpdatedDefaults    []values.ValueChange     // Copied defaults moved to a new default value
+	Conflicts          []values.Conflict        // Customized keys whose default also changed
+	SchemaViolations   []string                 // Target chart schema violations in the upgraded values
+	RemovedKeysComment string                   // Commented-out block of removed keys, appended to the YAML
+	Changelog          string                   // Changelog shipped with the target chart, if any
+	Layers             []LayerOutput            // Upgraded version of each values file when several are layered
+	RemovedOverrides   []RemovedOverride        // --set keys the target chart no longer has
+	NoOpDeletions      []string                 // Null deletions dropped because the key no longer exists
+	Policy             *values.PolicyReport     // Keys whose upgrade a policy changed or flagged
+	SecretMigrations   []values.SecretMigration // Hardcoded credentials that can move to a new existingSecret key
+	Commit             string                   // Commit recording the upgrade in git mode
+	PatchFile          string                   // Patch file holding the upgrade in git mode
+}
+
+// RemovedOverride describes a --set key that the target chart no longer has
+type RemovedOverride struct {
+	Path      string
+	Value     interface{}
+	RenamedTo []string // Keys new in the target chart with the same name, likely its new location
+}
+
+// Redacted returns a copy of the output with the sensitive values of its report and of the
+// upgraded values preview masked. The values files themselves are written before, unmasked
+func (o *UpgradeOutput) Redacted(r *values.Redactor) *UpgradeOutput {
+	redacted := *o
+	redacted.UpgradedYAML, redacted.RemovedKeysComment = redactPreview(r, o.UpgradedYAML, o.RemovedKeysComment)
+	redacted.Classification = r.Result(o.Classification)
+	redacted.UpdatedDefaults = r.Changes(o.UpdatedDefaults)
+	redacted.Conflicts = r.Conflicts(o.Conflicts)
+	redacted.Policy = r.PolicyReport(o.Policy)
+	if o.RemovedOverrides != nil {
+		redacted.RemovedOverrides = make([]RemovedOverride, len(o.RemovedOverrides))
+		for i, override := range o.RemovedOverrides {
+			override.Value = r.Value(override.Path, override.Value)
+			redacted.RemovedOverrides[i] = override
+		}
+	}
+	return &redacted
+}
+
+// redactPreview masks the sensitive values of upgraded YAML and of the removed keys block at its
+// end. If the YAML can't be parsed it is replaced as a whole rather than shown unmasked
+func redactPreview(r *values.Redactor, upgradedYAML, removedKeysComment string) (string, string) {
+	body, err := r.YAML(strings.TrimSuffix(upgradedYAML, removedKeysComment))
+	if err != nil {
+		slog.Debug("failed to redact upgraded values", "error", err)
+		return "# " + values.RedactedValue + "\n", ""
+	}
+	comment, err := r.CommentedYAML(removedKeysComment)
+	if err != nil {
+		slog.Debug("failed to redact removed keys", "error", err)
+		comment = ""
+	}
+	return body + comment, comment
+}
+
+// LayerOutput holds the upgraded version of one of several layered values files
+type LayerOutput struct {
+	ValuesFile         string
+	UpgradedYAML       string
+	OutputPath         string
+	RemovedKeysComment string
 }
 
 // Upgrade runs the upgrade logic
-func Upgrade(input *UpgradeInput) (*UpgradeOutput, error) {
+func Upgrade(ctx context.Context, input *UpgradeInput) (*UpgradeOutput, error) {
 	slog.Debug("starting upgrade",
 		"chart", input.Chart,
 		"repository", input.Repository,
 		"fromVersion", input.FromVersion,
 		"toVersion", input.ToVersion,
-		"valuesFile", input.ValuesFile,
+		"valuesFiles", input.ValuesFiles,
+		"release", input.Release,
 		"outputDir", input.OutputDir,
+		"outputFile", input.OutputFile,
+		"inPlace", input.InPlace,
 		"dryRun", input.DryRun,
 	)
 
-	// Validate values file exists
-	if _, err := os.Stat(input.ValuesFile); os.IsNotExist(err) {
-		return nil, fmt.Errorf("values file not found: %s", input.ValuesFile)
+	record := &gitRecord{Commit: input.Git, PatchFile: input.PatchFile, Files: input.ValuesFiles}
+
+	target := &outputTarget{
+		Chart:       input.Chart,
+		ToVersion:   input.ToVersion,
+		ValuesFiles: input.ValuesFiles,
+		OutputDir:   input.OutputDir,
+		OutputFile:  input.OutputFile,
+		InPlace:     input.InPlace || record.enabled(),
+		Backup:      input.Backup,
+		Stdout:      input.Stdout,
 	}
-
-	// Validate versions are different
-	if input.FromVersion == input.ToVersion {
-		return nil, fmt.Errorf("source and target versions are identical: %s", input.FromVersion)
+	if err := target.validate(); err != nil {
+		return nil, err
 	}
 
-	// Fetch old and new chart defaults in parallel
-	slog.Debug("fetching chart defaults",
-		"oldVersion", input.FromVersion,
-		"newVersion", input.ToVersion,
-	)
+	fromVersion := input.FromVersion
+	var releaseValues values.Values
 
-	var (
-		oldDefaultsYAML, newDefaultsYAML string
-		oldFetchErr, newFetchErr         error
-		wg                               sync.WaitGroup
-	)
-
-	wg.Add(2)
-
-	go func() {
-		defer wg.Done()
-		oldDefaultsYAML, oldFetchErr = helm.GetValuesFileByVersion(input.Repository, input.Chart, input.FromVersion)
-	}()
-
-	go func() {
-		defer wg.Done()
-		newDefaultsYAML, newFetchErr = helm.GetValuesFileByVersion(input.Repository, input.Chart, input.ToVersion)
-	}()
+	if input.Release != "" {
+		if len(input.ValuesFiles) > 0 || input.Values != nil {
+			return nil, fmt.Errorf("a values file and a release cannot be used together")
+		}
+		if !input.SetValues.Empty() {
+			return nil, fmt.Errorf("--set overrides cannot be used with a release, its values already include them")
+		}
+		if input.PreserveComments {
+			return nil, fmt.Errorf("preserving comments requires a values file, release values have none")
+		}
 
-	wg.Wait()
+		// Load user values and source version from the deployed release
+		rel, userValues, err := readReleaseValues(input.ReleaseConfig, input.Release, input.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		if rel.Chart != input.Chart {
+			slog.Warn("release was deployed from a different chart", "release", rel.Name, "deployedChart", rel.Chart, "chart", input.Chart)
+		}
+		if fromVersion == "" {
+			fromVersion = rel.ChartVersion
+		}
+		releaseValues = userValues
+	} else if input.Values == nil {
+		// Validate values files exist
+		if err := validateValuesFiles(input.ValuesFiles); err != nil {
+			return nil, err
+		}
+	}
 
-	// Check for fetch errors
-	if oldFetchErr != nil {
-		return nil, fmt.Errorf("failed to fetch old chart defaults: %w", oldFetchErr)
+	if fromVersion == "" {
+		return nil, fmt.Errorf("source version is required")
 	}
-	if newFetchErr != nil {
-		return nil, fmt.Errorf("failed to fetch new chart defaults: %w", newFetchErr)
+
+	// Check the repository before anything is written
+	var repo *git.Repo
+	if record.enabled() && !input.DryRun {
+		var err error
+		if repo, err = record.open(); err != nil {
+			return nil, err
+		}
 	}
 
-	// Parse old defaults
-	oldDefaults, err := values.ParseYAML(oldDefaultsYAML)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse old chart defaults: %w", err)
+	// Validate versions are different
+	if fromVersion == input.ToVersion {
+		return nil, fmt.Errorf("source and target versions are identical: %s", fromVersion)
 	}
-	slog.Debug("parsed old defaults", "count", len(oldDefaults))
 
-	// Parse new defaults
-	newDefaults, err := values.ParseYAML(newDefaultsYAML)
+	plan, err := planUpgrade(ctx, &planInput{
+		Chart:       input.Chart,
+		Repository:  input.Repository,
+		Source:      input.Source,
+		FromVersion: fromVersion,
+		ToVersion:   input.ToVersion,
+		ValuesFiles: input.ValuesFiles,
+		Layers:      input.Values,
+		Stdin:       input.Stdin,
+		SetValues:   input.SetValues,
+		UserValues:  releaseValues,
+		Policy:      input.Policy,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse new chart defaults: %w", err)
+		return nil, err
 	}
-	slog.Debug("parsed new defaults", "count", len(newDefaults))
 
-	// Parse user values
-	slog.Debug("parsing user values", "file", input.ValuesFile)
+	classification := plan.Classification
+	upgradedValues := plan.Upgraded
 
-	userValues, err := values.ParseFile(input.ValuesFile)
+	// Handle user keys that the target chart no longer supports
+	removedKeysComment, err := applyRemovedKeyAction(upgradedValues, classification, input.RemovedKeys)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse user values: %w", err)
+		return nil, err
 	}
 
-	slog.Debug("parsed user values", "count", len(userValues))
-
-	// Classify user values against old defaults
-	slog.Debug("classifying user values")
-
-	classification := values.Classify(userValues, oldDefaults)
-
-	slog.Debug("classification complete",
-		"customized", classification.Customized,
-		"copiedDefault", classification.CopiedDefault,
-		"unknown", classification.Unknown,
-	)
-
-	// Extract comments from new chart defaults
-	slog.Debug("extracting comments from target chart")
-
-	newComments := values.ExtractComments(newDefaultsYAML)
-	slog.Debug("extracted comments", "count", len(newComments))
-
-	// Merge values
-	slog.Debug("generating upgraded values")
-
-	upgradedValues := values.Merge(userValues, oldDefaults, newDefaults)
-
 	// Detect custom image tags
-	customImageTags := values.DetectCustomImageTags(userValues, oldDefaults, newDefaults)
+	customImageTags := values.DetectCustomImageTags(plan.UserValues, plan.OldDefaults, plan.NewDefaults)
 	promptForImageTags := false
 	imageTagsUpgraded := false
+	var imageUpgrades []values.ImageChange
 
 	if len(customImageTags) > 0 {
 		slog.Debug("detected custom image tags", "count", len(customImageTags))
@@ -150,6 +243,7 @@ func Upgrade(input *UpgradeInput) (*UpgradeOutput, error) {
 		if input.UpgradeImages {
 			// Auto-upgrade image tags
 			upgradedValues = values.ApplyImageUpgrades(upgradedValues, customImageTags)
+			imageUpgrades = customImageTags
 			imageTagsUpgraded = true
 			slog.Debug("applied image tag upgrades")
 		} else {
@@ -159,39 +253,54 @@ func Upgrade(input *UpgradeInput) (*UpgradeOutput, error) {
 	}
 
 	// Generate YAML output with comments from target chart
-	upgradedYAML, err := upgradedValues.ToYAMLWithComments(newComments)
+	upgradedYAML, err := upgradedValues.ToYAMLWithComments(plan.NewComments)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate YAML: %w", err)
 	}
+	upgradedYAML += removedKeysComment
 
 	output := &UpgradeOutput{
 		Classification:     classification,
+		FromVersion:        fromVersion,
 		UpgradedYAML:       upgradedYAML,
-		OldDefaultsCount:   len(oldDefaults),
-		NewDefaultsCount:   len(newDefaults),
-		UserValuesCount:    len(userValues),
+		OldDefaultsCount:   len(plan.OldDefaults),
+		NewDefaultsCount:   len(plan.NewDefaults),
+		UserValuesCount:    len(plan.UserValues),
 		CustomImageTags:    customImageTags,
 		ImageTagsUpgraded:  imageTagsUpgraded,
 		PromptForImageTags: promptForImageTags,
+		UpdatedDefaults:    values.UpdatedDefaults(classification, plan.NewDefaults),
+		Conflicts:          values.DetectConflicts(classification, plan.NewDefaults),
+		SchemaViolations:   plan.validateSchema(upgradedValues),
+		RemovedKeysComment: removedKeysComment,
+		Changelog:          plan.NewChart.Changelog,
+		RemovedOverrides:   removedOverrides(plan),
+		NoOpDeletions:      values.NoOpDeletions(classification, plan.NewDefaults),
+		Policy:             values.NewPolicyReport(classification, plan.NewDefaults),
+		SecretMigrations:   values.DetectSecretMigrations(plan.UserValues, plan.OldDefaults, plan.NewDefaults),
+	}
+
+	// Upgrade each values file separately when several are layered, when --set overrides
+	// must be kept out of the written file, or when each file is patched in place
+	if len(plan.Layers) > 1 || plan.Overrides != nil || input.PreserveComments {
+		output.Layers, err = upgradeLayers(plan, input.RemovedKeys, imageUpgrades, input.PreserveComments)
+		if err != nil {
+			return nil, err
+		}
+		output.UpgradedYAML = joinLayers(output.Layers)
 	}
 
 	// Write output (unless dry run or prompting for image tags)
 	if !input.DryRun && !promptForImageTags {
-		slog.Debug("writing output file", "dir", input.OutputDir)
-
-		// Create output directory if needed
-		if err := os.MkdirAll(input.OutputDir, 0755); err != nil {
-			return nil, fmt.Errorf("failed to create output directory: %w", err)
+		if err := writeUpgrade(target, output); err != nil {
+			return nil, err
 		}
-		fileName := fmt.Sprintf("%s-%s-%s.yaml", input.Chart, input.ToVersion, time.Now().Format("2006-01-02-150405"))
-		// Write upgraded values file
-		outputPath := filepath.Join(input.OutputDir, fileName)
-		if err := os.WriteFile(outputPath, []byte(upgradedYAML), 0644); err != nil {
-			return nil, fmt.Errorf("failed to write upgraded values: %w", err)
+		if repo != nil {
+			if err := record.record(repo, commitMessage(input.Chart, fromVersion, input.ToVersion, output.Redacted(input.Redactor)), output); err != nil {
+				return nil, err
+			}
 		}
-
-		output.OutputPath = outputPath
-		slog.Debug("upgrade complete", "outputPath", outputPath)
+		slog.Debug("upgrade complete", "outputPath", output.OutputPath, "layers", len(output.Layers))
 	} else if input.DryRun {
 		slog.Debug("dry run - no files written")
 	} else if promptForImageTags {
@@ -204,11 +313,19 @@ func Upgrade(input *UpgradeInput) (*UpgradeOutput, error) {
 // FinalizeUpgradeInput contains parameters for finalizing an upgrade after user prompt
 type FinalizeUpgradeInput struct {
 	OriginalOutput *UpgradeOutput
-	ApplyUpgrades  bool   // Whether to apply image tag upgrades
-	Chart          string // Chart name for filename
-	ToVersion      string // Target version for filename
+	ApplyUpgrades  bool     // Whether to apply image tag upgrades
+	Chart          string   // Chart name for filename
+	ToVersion      string   // Target version for filename
+	ValuesFiles    []string // Input values files, overwritten in in-place mode
+	Stdout         io.Writer
 	OutputDir      string
+	OutputFile     string
+	InPlace        bool
+	Backup         bool
 	DryRun         bool
+	Git            bool             // Commit the upgraded values files; implies InPlace
+	PatchFile      string           // Write the upgrade as a patch instead of committing; implies InPlace
+	Redactor       *values.Redactor // Masks sensitive values in the commit message
 }
 
 // FinalizeUpgrade applies the user's image tag decision and writes the final output
@@ -217,44 +334,251 @@ func FinalizeUpgrade(input *FinalizeUpgradeInput) (*UpgradeOutput, error) {
 
 	// If user chose to upgrade images, regenerate the YAML
 	if input.ApplyUpgrades && len(output.CustomImageTags) > 0 {
-		// Parse the current YAML to get values
-		currentValues, err := values.ParseYAML(output.UpgradedYAML)
+		if len(output.Layers) > 0 {
+			// Only the layer that sets an image tag gets the upgrade
+			for i := range output.Layers {
+				layer := &output.Layers[i]
+				changes := layerImageChanges(output.CustomImageTags, output.Classification, layer.ValuesFile)
+				if len(changes) == 0 {
+					continue
+				}
+
+				upgradedYAML, err := applyImageUpgradesToYAML(strings.TrimSuffix(layer.UpgradedYAML, layer.RemovedKeysComment), changes)
+				if err != nil {
+					return nil, err
+				}
+				layer.UpgradedYAML = upgradedYAML + layer.RemovedKeysComment
+			}
+			output.UpgradedYAML = joinLayers(output.Layers)
+		} else {
+			upgradedYAML, err := applyImageUpgradesToYAML(strings.TrimSuffix(output.UpgradedYAML, output.RemovedKeysComment), output.CustomImageTags)
+			if err != nil {
+				return nil, err
+			}
+			output.UpgradedYAML = upgradedYAML + output.RemovedKeysComment
+		}
+		output.ImageTagsUpgraded = true
+	}
+
+	output.PromptForImageTags = false
+
+	// Write output (unless dry run)
+	if !input.DryRun {
+		record := &gitRecord{Commit: input.Git, PatchFile: input.PatchFile, Files: input.ValuesFiles}
+		target := &outputTarget{
+			Chart:       input.Chart,
+			ToVersion:   input.ToVersion,
+			ValuesFiles: input.ValuesFiles,
+			OutputDir:   input.OutputDir,
+			OutputFile:  input.OutputFile,
+			InPlace:     input.InPlace || record.enabled(),
+			Backup:      input.Backup,
+			Stdout:      input.Stdout,
+		}
+		if err := target.validate(); err != nil {
+			return nil, err
+		}
+
+		var repo *git.Repo
+		if record.enabled() {
+			var err error
+			if repo, err = record.open(); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := writeUpgrade(target, output); err != nil {
+			return nil, err
+		}
+		if repo != nil {
+			if err := record.record(repo, commitMessage(input.Chart, output.FromVersion, input.ToVersion, output.Redacted(input.Redactor)), output); err != nil {
+				return nil, err
+			}
+		}
+		slog.Debug("upgrade finalized", "outputPath", output.OutputPath, "layers", len(output.Layers))
+	}
+
+	return output, nil
+}
+
+// applyRemovedKeyAction drops user keys removed in the target chart from the upgraded values
+// when requested. For the comment action it returns the dropped keys as a commented-out block
+func applyRemovedKeyAction(upgraded values.Values, classification *values.ClassificationResult, action values.RemovedKeyAction) (string, error) {
+	if action != values.RemovedDrop && action != values.RemovedComment {
+		return "", nil
+	}
+
+	dropped := make(values.Values)
+	for _, entry := range classification.Entries {
+		if entry.Classification != values.RemovedInTarget {
+			continue
+		}
+		if value, exists := upgraded[entry.Path]; exists {
+			dropped[entry.Path] = value
+			delete(upgraded, entry.Path)
+		}
+	}
+
+	slog.Debug("dropped keys removed in target chart", "count", len(dropped), "action", action)
+
+	if action != values.RemovedComment || len(dropped) == 0 {
+		return "", nil
+	}
+
+	comment, err := dropped.ToCommentedYAML("Keys removed in the target chart version (kept for reference):")
+	if err != nil {
+		return "", fmt.Errorf("failed to generate removed keys block: %w", err)
+	}
+	return "\n" + comment, nil
+}
+
+// applyImageUpgradesToYAML sets the given image tags in a values YAML document, keeping its
+// comments and anchors
+func applyImageUpgradesToYAML(content string, changes []values.ImageChange) (string, error) {
+	currentValues, err := values.ParseYAML(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse current YAML: %w", err)
+	}
+
+	upgradedYAML, err := values.PatchYAML(content, values.ApplyImageUpgrades(currentValues, changes), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to regenerate YAML: %w", err)
+	}
+	return upgradedYAML, nil
+}
+
+// upgradeLayers upgrades each layered values file on its own. The first file is merged like a
+// single values file and so picks up new chart defaults; later files only keep the keys they set.
+// With preserve, each file is patched instead of regenerated from the chart's values.yaml
+func upgradeLayers(plan *upgradePlan, action values.RemovedKeyAction, imageUpgrades []values.ImageChange, preserve bool) ([]LayerOutput, error) {
+	layers := make([]LayerOutput, 0, len(plan.Layers))
+
+	for i, layer := range plan.Layers {
+		var upgraded values.Values
+		if i == 0 {
+			upgraded = values.Merge(layer.Values, plan.OldDefaults, plan.NewDefaults, plan.Policy)
+		} else {
+			upgraded = values.MergeLayer(layer.Values, plan.OldDefaults, plan.NewDefaults, plan.Policy)
+		}
+
+		removedKeysComment, err := applyRemovedKeyAction(upgraded, plan.Classification, action)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse current YAML: %w", err)
+			return nil, err
 		}
 
-		// Apply image upgrades
-		upgradedValues := values.ApplyImageUpgrades(currentValues, output.CustomImageTags)
+		if changes := layerImageChanges(imageUpgrades, plan.Classification, layer.Source); len(changes) > 0 {
+			upgraded = values.ApplyImageUpgrades(upgraded, changes)
+		}
 
-		// Regenerate YAML (without comments for simplicity in this path)
-		upgradedYAML, err := upgradedValues.ToYAML()
+		upgradedYAML, err := layerYAML(layer, upgraded, plan.NewComments, preserve)
 		if err != nil {
-			return nil, fmt.Errorf("failed to regenerate YAML: %w", err)
+			return nil, err
 		}
 
-		output.UpgradedYAML = upgradedYAML
-		output.ImageTagsUpgraded = true
-	}
+		slog.Debug("upgraded layer", "file", layer.Source, "keys", len(upgraded))
 
-	output.PromptForImageTags = false
+		layers = append(layers, LayerOutput{
+			ValuesFile:         layer.Source,
+			UpgradedYAML:       upgradedYAML + removedKeysComment,
+			RemovedKeysComment: removedKeysComment,
+		})
+	}
 
-	// Write output (unless dry run)
-	if !input.DryRun {
-		slog.Debug("writing output file", "dir", input.OutputDir)
+	return layers, nil
+}
 
-		if err := os.MkdirAll(input.OutputDir, 0755); err != nil {
-			return nil, fmt.Errorf("failed to create output directory: %w", err)
+// layerYAML generates the upgraded YAML for a values file. When preserving comments the file
+// is patched; if that fails the YAML is regenerated with the chart's comments instead
+func layerYAML(layer values.Layer, upgraded values.Values, comments values.CommentMap, preserve bool) (string, error) {
+	if preserve {
+		patched, err := values.PatchYAML(layer.Content, upgraded, comments)
+		if err == nil {
+			return patched, nil
 		}
+		slog.Warn("could not preserve the layout of values file, regenerating it", "file", layer.Source, "error", err)
+	}
 
-		fileName := fmt.Sprintf("%s-%s-%s.yaml", input.Chart, input.ToVersion, time.Now().Format("2006-01-02-150405"))
-		outputPath := filepath.Join(input.OutputDir, fileName)
-		if err := os.WriteFile(outputPath, []byte(output.UpgradedYAML), 0644); err != nil {
-			return nil, fmt.Errorf("failed to write upgraded values: %w", err)
+	upgradedYAML, err := upgraded.ToYAMLWithComments(comments)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate YAML for %s: %w", layer.Source, err)
+	}
+	return upgradedYAML, nil
+}
+
+// layerImageChanges returns the image tag changes for keys whose effective value is set by source
+func layerImageChanges(changes []values.ImageChange, classification *values.ClassificationResult, source string) []values.ImageChange {
+	sources := make(map[string]string, len(classification.Entries))
+	for _, entry := range classification.Entries {
+		sources[entry.Path] = entry.Source
+	}
+
+	var result []values.ImageChange
+	for _, change := range changes {
+		if sources[change.Path] == source {
+			result = append(result, change)
 		}
+	}
+	return result
+}
+
+// joinLayers combines upgraded layers into one multi-document YAML stream, each document
+// headed by the values file it upgrades. A single layer is returned as is
+func joinLayers(layers []LayerOutput) string {
+	if len(layers) == 1 {
+		return layers[0].UpgradedYAML
+	}
+
+	docs := make([]string, len(layers))
+	for i, layer := range layers {
+		docs[i] = "# Source: " + layer.ValuesFile + "\n" + layer.UpgradedYAML
+	}
+	return strings.Join(docs, "---\n")
+}
 
+// writeUpgrade writes the upgraded values. Layered values files are written one file per layer,
+// except when streaming to stdout where the combined multi-document YAML is written instead
+func writeUpgrade(target *outputTarget, output *UpgradeOutput) error {
+	if len(output.Layers) == 0 || target.streaming() {
+		outputPath, err := target.write(output.UpgradedYAML)
+		if err != nil {
+			return err
+		}
 		output.OutputPath = outputPath
-		slog.Debug("upgrade finalized", "outputPath", outputPath)
+		for i := range output.Layers {
+			output.Layers[i].OutputPath = outputPath
+		}
+		return nil
 	}
 
-	return output, nil
+	for i := range output.Layers {
+		layer := &output.Layers[i]
+		outputPath, err := target.forLayer(layer.ValuesFile).write(layer.UpgradedYAML)
+		if err != nil {
+			return err
+		}
+		layer.OutputPath = outputPath
+	}
+	if len(output.Layers) == 1 {
+		output.OutputPath = output.Layers[0].OutputPath
+	}
+	return nil
+}
+
+// removedOverrides lists the --set keys removed in the target chart with their likely new names
+func removedOverrides(plan *upgradePlan) []RemovedOverride {
+	var removed []RemovedOverride
+
+	for _, entry := range plan.Classification.Entries {
+		if entry.Source != SetValuesSource || entry.Classification != values.RemovedInTarget {
+			continue
+		}
+
+		removed = append(removed, RemovedOverride{
+			Path:      entry.Path,
+			Value:     entry.UserValue,
+			RenamedTo: values.RenameCandidates(entry.Path, plan.OldDefaults, plan.NewDefaults),
+		})
+	}
+
+	return removed
 }
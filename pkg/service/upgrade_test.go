@@ -1,9 +1,15 @@
 package service
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/itsvictorfy/hvu/pkg/helm"
+	"github.com/itsvictorfy/hvu/pkg/values"
 )
 
 func TestUpgrade_MissingValuesFile(t *testing.T) {
@@ -12,12 +18,12 @@ func TestUpgrade_MissingValuesFile(t *testing.T) {
 		Repository:  "https://example.com/charts",
 		FromVersion: "1.0.0",
 		ToVersion:   "2.0.0",
-		ValuesFile:  "/nonexistent/path/values.yaml",
+		ValuesFiles: []string{"/nonexistent/path/values.yaml"},
 		OutputDir:   t.TempDir(),
 		DryRun:      true,
 	}
 
-	_, err := Upgrade(input)
+	_, err := Upgrade(context.Background(), input)
 
 	if err == nil {
 		t.Error("expected error for missing values file")
@@ -37,12 +43,12 @@ func TestUpgrade_SameVersion(t *testing.T) {
 		Repository:  "https://example.com/charts",
 		FromVersion: "1.0.0",
 		ToVersion:   "1.0.0", // Same version
-		ValuesFile:  valuesFile,
+		ValuesFiles: []string{valuesFile},
 		OutputDir:   tmpDir,
 		DryRun:      true,
 	}
 
-	_, err := Upgrade(input)
+	_, err := Upgrade(context.Background(), input)
 
 	if err == nil {
 		t.Error("expected error when fromVersion equals toVersion")
@@ -68,7 +74,7 @@ func TestUpgrade_InputValidation(t *testing.T) {
 				Repository:  "https://charts.example.com",
 				FromVersion: "1.0.0",
 				ToVersion:   "2.0.0",
-				ValuesFile:  "/nonexistent/values.yaml",
+				ValuesFiles: []string{"/nonexistent/values.yaml"},
 				OutputDir:   tmpDir,
 				DryRun:      true,
 			},
@@ -81,7 +87,7 @@ func TestUpgrade_InputValidation(t *testing.T) {
 				Repository:  "https://charts.example.com",
 				FromVersion: "1.0.0",
 				ToVersion:   "1.0.0",
-				ValuesFile:  valuesFile,
+				ValuesFiles: []string{valuesFile},
 				OutputDir:   tmpDir,
 				DryRun:      true,
 			},
@@ -94,7 +100,7 @@ func TestUpgrade_InputValidation(t *testing.T) {
 				Repository:  "https://invalid.nonexistent.repo",
 				FromVersion: "1.0.0",
 				ToVersion:   "2.0.0",
-				ValuesFile:  valuesFile,
+				ValuesFiles: []string{valuesFile},
 				OutputDir:   tmpDir,
 				DryRun:      true,
 			},
@@ -104,7 +110,7 @@ func TestUpgrade_InputValidation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := Upgrade(tt.input)
+			_, err := Upgrade(context.Background(), tt.input)
 			if (err != nil) != tt.wantError {
 				t.Errorf("Upgrade() error = %v, wantError %v", err, tt.wantError)
 			}
@@ -118,7 +124,7 @@ func TestUpgradeInput_Fields(t *testing.T) {
 		Repository:  "https://charts.bitnami.com/bitnami",
 		FromVersion: "15.0.0",
 		ToVersion:   "16.0.0",
-		ValuesFile:  "/path/to/values.yaml",
+		ValuesFiles: []string{"/path/to/values.yaml"},
 		OutputDir:   "/tmp/output",
 		DryRun:      true,
 	}
@@ -178,13 +184,13 @@ func TestUpgrade_DryRunDoesNotWriteFile(t *testing.T) {
 		Repository:  "https://invalid.repo", // Will fail, but dryRun should prevent file writes anyway
 		FromVersion: "1.0.0",
 		ToVersion:   "2.0.0",
-		ValuesFile:  valuesFile,
+		ValuesFiles: []string{valuesFile},
 		OutputDir:   outputDir,
 		DryRun:      true,
 	}
 
 	// This will fail due to invalid repo, but we're testing the dryRun behavior
-	_, _ = Upgrade(input)
+	_, _ = Upgrade(context.Background(), input)
 
 	// Output directory should not be created due to dry run (or error)
 	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
@@ -195,3 +201,242 @@ func TestUpgrade_DryRunDoesNotWriteFile(t *testing.T) {
 		}
 	}
 }
+
+func TestApplyRemovedKeyAction(t *testing.T) {
+	oldDefaults := values.Values{"kept": "a", "gone::custom": "x", "gone::copied": "y"}
+	newDefaults := values.Values{"kept": "a"}
+	userValues := values.Values{"kept": "a", "gone::custom": "mine", "gone::copied": "y"}
+
+	newUpgrade := func() (values.Values, *values.ClassificationResult) {
+		classification := values.Classify(userValues, oldDefaults)
+		values.MarkRemovedInTarget(classification, oldDefaults, newDefaults)
+		return values.Merge(userValues, oldDefaults, newDefaults, nil), classification
+	}
+
+	t.Run("keep", func(t *testing.T) {
+		upgraded, classification := newUpgrade()
+		comment, err := applyRemovedKeyAction(upgraded, classification, values.RemovedKeep)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if upgraded["gone::custom"] != "mine" {
+			t.Error("expected customized removed key to be kept")
+		}
+		if comment != "" {
+			t.Errorf("expected no comment block, got %q", comment)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		upgraded, classification := newUpgrade()
+		comment, err := applyRemovedKeyAction(upgraded, classification, values.RemovedDrop)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, exists := upgraded["gone::custom"]; exists {
+			t.Error("expected removed key to be dropped")
+		}
+		if upgraded["kept"] != "a" {
+			t.Error("expected other keys to be untouched")
+		}
+		if comment != "" {
+			t.Errorf("expected no comment block, got %q", comment)
+		}
+	})
+
+	t.Run("comment", func(t *testing.T) {
+		upgraded, classification := newUpgrade()
+		comment, err := applyRemovedKeyAction(upgraded, classification, values.RemovedComment)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, exists := upgraded["gone::custom"]; exists {
+			t.Error("expected removed key to be dropped from values")
+		}
+		if !strings.Contains(comment, "#     custom: mine") {
+			t.Errorf("expected removed key in comment block, got %q", comment)
+		}
+		if strings.Contains(comment, "copied") {
+			t.Errorf("expected copied defaults to stay out of the comment block, got %q", comment)
+		}
+	})
+}
+
+func TestUpgrade_ChartSource(t *testing.T) {
+	source := helm.NewMemorySource()
+	if err := source.AddValues("app", "1.0.0", "replicaCount: 1\nimage:\n  tag: \"1.0\"\nlegacy: true\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	if err := source.AddValues("app", "2.0.0", "replicaCount: 1\nimage:\n  tag: \"2.0\"\nmetrics:\n  enabled: false\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	valuesFile := filepath.Join(tmpDir, "values.yaml")
+	if err := os.WriteFile(valuesFile, []byte("replicaCount: 3\nimage:\n  tag: \"1.0\"\n"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	output, err := Upgrade(context.Background(), &UpgradeInput{
+		Chart:       "app",
+		Source:      source,
+		FromVersion: "1.0.0",
+		ToVersion:   "2.0.0",
+		ValuesFiles: []string{valuesFile},
+		OutputDir:   tmpDir,
+		DryRun:      true,
+	})
+	if err != nil {
+		t.Fatalf("Upgrade() error = %v", err)
+	}
+
+	if output.Classification.Customized != 1 || output.Classification.CopiedDefault != 1 {
+		t.Errorf("unexpected classification %+v", output.Classification)
+	}
+	for _, want := range []string{"replicaCount: 3", "tag: \"2.0\"", "metrics:"} {
+		if !strings.Contains(output.UpgradedYAML, want) {
+			t.Errorf("expected upgraded values to contain %q, got:\n%s", want, output.UpgradedYAML)
+		}
+	}
+
+	if _, err := Upgrade(context.Background(), &UpgradeInput{
+		Chart:       "app",
+		Source:      source,
+		FromVersion: "1.0.0",
+		ToVersion:   "3.0.0",
+		ValuesFiles: []string{valuesFile},
+		OutputDir:   tmpDir,
+		DryRun:      true,
+	}); err == nil {
+		t.Error("expected error for a version the source does not have")
+	}
+}
+
+func TestUpgrade_Policy(t *testing.T) {
+	source := helm.NewMemorySource()
+	if err := source.AddValues("app", "1.0.0", "replicaCount: 1\nimage:\n  tag: \"1.0\"\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	if err := source.AddValues("app", "2.0.0", "replicaCount: 2\nimage:\n  tag: \"2.0\"\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	valuesFile := filepath.Join(tmpDir, "values.yaml")
+	if err := os.WriteFile(valuesFile, []byte("replicaCount: 3\nimage:\n  tag: \"1.0\"\n"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	output, err := Upgrade(context.Background(), &UpgradeInput{
+		Chart:       "app",
+		Source:      source,
+		FromVersion: "1.0.0",
+		ToVersion:   "2.0.0",
+		ValuesFiles: []string{valuesFile},
+		OutputDir:   tmpDir,
+		DryRun:      true,
+		Policy: &values.Policy{Rules: []values.PolicyRule{
+			{Path: "image.tag", Action: values.PolicyPin},
+			{Path: "replicaCount", Action: values.PolicyAlwaysUpdate},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Upgrade() error = %v", err)
+	}
+
+	for _, want := range []string{"replicaCount: 2", "tag: \"1.0\""} {
+		if !strings.Contains(output.UpgradedYAML, want) {
+			t.Errorf("expected upgraded values to contain %q, got:\n%s", want, output.UpgradedYAML)
+		}
+	}
+	if len(output.Policy.Pinned) != 1 || len(output.Policy.ForcedUpdates) != 1 {
+		t.Errorf("unexpected policy report %+v", output.Policy)
+	}
+	if len(output.Conflicts) != 0 {
+		t.Errorf("expected no conflicts, got %+v", output.Conflicts)
+	}
+}
+
+func TestUpgrade_SecretMigrations(t *testing.T) {
+	source := helm.NewMemorySource()
+	if err := source.AddValues("app", "1.0.0", "auth:\n  username: app\n  password: \"\"\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	if err := source.AddValues("app", "2.0.0", "auth:\n  username: app\n  password: \"\"\n  existingSecret: \"\"\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	valuesFile := filepath.Join(tmpDir, "values.yaml")
+	if err := os.WriteFile(valuesFile, []byte("auth:\n  username: admin\n  password: hunter2\n"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	output, err := Upgrade(context.Background(), &UpgradeInput{
+		Chart:       "app",
+		Source:      source,
+		FromVersion: "1.0.0",
+		ToVersion:   "2.0.0",
+		ValuesFiles: []string{valuesFile},
+		OutputDir:   tmpDir,
+		DryRun:      true,
+	})
+	if err != nil {
+		t.Fatalf("Upgrade() error = %v", err)
+	}
+
+	want := []values.SecretMigration{{Path: "auth::password", SecretKey: "auth::existingSecret"}}
+	if !reflect.DeepEqual(output.SecretMigrations, want) {
+		t.Errorf("SecretMigrations = %+v, want %+v", output.SecretMigrations, want)
+	}
+	if !strings.Contains(output.UpgradedYAML, "password: hunter2") {
+		t.Errorf("expected the credential to be kept, got:\n%s", output.UpgradedYAML)
+	}
+}
+
+func TestUpgradeOutput_RedactedPreview(t *testing.T) {
+	source := helm.NewMemorySource()
+	if err := source.AddValues("app", "1.0.0", "auth:\n  password: \"\"\nlegacy:\n  token: \"\"\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+	if err := source.AddValues("app", "2.0.0", "auth:\n  password: \"\"\n"); err != nil {
+		t.Fatalf("AddValues() error = %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	valuesFile := filepath.Join(tmpDir, "values.yaml")
+	if err := os.WriteFile(valuesFile, []byte("auth:\n  password: hunter2\nlegacy:\n  token: s3cr3t\n"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	output, err := Upgrade(context.Background(), &UpgradeInput{
+		Chart:       "app",
+		Source:      source,
+		FromVersion: "1.0.0",
+		ToVersion:   "2.0.0",
+		ValuesFiles: []string{valuesFile},
+		OutputDir:   tmpDir,
+		DryRun:      true,
+		RemovedKeys: values.RemovedComment,
+	})
+	if err != nil {
+		t.Fatalf("Upgrade() error = %v", err)
+	}
+
+	redactor, err := values.NewRedactor(nil)
+	if err != nil {
+		t.Fatalf("NewRedactor() error = %v", err)
+	}
+	shown := output.Redacted(redactor)
+	for _, secret := range []string{"hunter2", "s3cr3t"} {
+		if strings.Contains(shown.UpgradedYAML, secret) {
+			t.Errorf("expected %q to be masked in the preview, got:\n%s", secret, shown.UpgradedYAML)
+		}
+		if !strings.Contains(output.UpgradedYAML, secret) {
+			t.Errorf("expected %q to be kept in the upgraded values, got:\n%s", secret, output.UpgradedYAML)
+		}
+	}
+	if !strings.Contains(shown.UpgradedYAML, "password: <redacted>") || !strings.Contains(shown.UpgradedYAML, "token: <redacted>") {
+		t.Errorf("unexpected redacted preview:\n%s", shown.UpgradedYAML)
+	}
+}
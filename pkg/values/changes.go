@@ -0,0 +1,209 @@
+package values
+
+import (
+	"strings"
+)
+
+// ValueChange describes a key whose value differs between two chart versions
+type ValueChange struct {
+	Path     string
+	OldValue interface{}
+	NewValue interface{}
+}
+
+// UpdatedDefaults returns the copied defaults whose value changes in the new defaults.
+// These are the keys an upgrade moves to a new value on the user's behalf
+func UpdatedDefaults(result *ClassificationResult, newDefaults Values) []ValueChange {
+	var changes []ValueChange
+
+	for _, entry := range result.Entries {
+		if entry.Classification != CopiedDefault || entry.Policy == PolicyPin {
+			continue
+		}
+
+		newDefault, exists := newDefaults[entry.Path]
+		if !exists || ValuesEqual(entry.DefaultValue, newDefault) {
+			continue
+		}
+
+		changes = append(changes, ValueChange{
+			Path:     entry.Path,
+			OldValue: entry.DefaultValue,
+			NewValue: newDefault,
+		})
+	}
+
+	return changes
+}
+
+// DefaultsDiff holds how a chart's defaults changed between two versions
+type DefaultsDiff struct {
+	Added   []ValueChange // Keys only in the new defaults, with no OldValue
+	Removed []ValueChange // Keys only in the old defaults, with no NewValue
+	Changed []ValueChange // Keys whose default value changed
+}
+
+// DiffDefaults compares two versions of a chart's defaults. Each list is sorted by path
+func DiffDefaults(oldDefaults, newDefaults Values) *DefaultsDiff {
+	diff := &DefaultsDiff{}
+
+	for _, path := range oldDefaults.GetPaths() {
+		oldValue := oldDefaults[path]
+		newValue, exists := newDefaults[path]
+		switch {
+		case !exists:
+			diff.Removed = append(diff.Removed, ValueChange{Path: path, OldValue: oldValue})
+		case !ValuesEqual(oldValue, newValue):
+			diff.Changed = append(diff.Changed, ValueChange{Path: path, OldValue: oldValue, NewValue: newValue})
+		}
+	}
+
+	for _, path := range newDefaults.GetPaths() {
+		if _, exists := oldDefaults[path]; !exists {
+			diff.Added = append(diff.Added, ValueChange{Path: path, NewValue: newDefaults[path]})
+		}
+	}
+
+	return diff
+}
+
+// MarkRemovedInTarget reclassifies entries whose path exists in the old defaults but not in the
+// new defaults as RemovedInTarget, along with entries below a map the new defaults drop, such as
+// podAnnotations.foo when the target chart no longer has podAnnotations. The entry keeps its old
+// default so callers can still tell whether the user had customized it
+func MarkRemovedInTarget(result *ClassificationResult, oldDefaults, newDefaults Values) {
+	for i := range result.Entries {
+		entry := &result.Entries[i]
+
+		if !removedInTarget(entry.Path, oldDefaults, newDefaults) {
+			continue
+		}
+
+		switch entry.Classification {
+		case Deletion:
+			// Reported by NoOpDeletions instead
+			continue
+		case Customized:
+			result.Customized--
+		case CopiedDefault:
+			result.CopiedDefault--
+		case Unknown:
+			result.Unknown--
+		}
+
+		entry.Classification = RemovedInTarget
+		result.Removed++
+	}
+}
+
+// removedInTarget reports whether the new defaults drop a path of the old defaults, or the
+// nearest parent of the path that the old defaults set
+func removedInTarget(path string, oldDefaults, newDefaults Values) bool {
+	if _, existsInOld := oldDefaults[path]; existsInOld {
+		_, existsInNew := newDefaults[path]
+		return !existsInNew
+	}
+
+	parts := strings.Split(path, pathSeparator)
+	for i := len(parts) - 1; i > 0; i-- {
+		parentPath := strings.Join(parts[:i], pathSeparator)
+		if KeyExists(parentPath, oldDefaults) {
+			return !KeyExists(parentPath, newDefaults)
+		}
+	}
+	return false
+}
+
+// ToCommentedYAML converts Values to YAML with every line commented out, preceded by a header comment
+func (v Values) ToCommentedYAML(header string) (string, error) {
+	content, err := v.ToYAML()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("# " + header + "\n")
+	for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+		b.WriteString("# " + line + "\n")
+	}
+	return b.String(), nil
+}
+
+// Conflict describes a key the user customized whose default also changed in the target chart
+type Conflict struct {
+	Path       string
+	UserValue  interface{}
+	OldDefault interface{}
+	NewDefault interface{}
+}
+
+// DetectConflicts finds customized keys whose chart default changed between versions.
+// The user's value is preserved on upgrade, but the chart authors moved the default too,
+// so the customization may need revisiting
+func DetectConflicts(result *ClassificationResult, newDefaults Values) []Conflict {
+	var conflicts []Conflict
+
+	for _, entry := range result.Entries {
+		// Keys a policy updates or flags for review are reported by NewPolicyReport instead
+		if entry.Classification != Customized || entry.DefaultValue == nil || entry.Policy == PolicyAlwaysUpdate || entry.Policy == PolicyRequireReview {
+			continue
+		}
+
+		newDefault, exists := newDefaults[entry.Path]
+		if !exists || ValuesEqual(entry.DefaultValue, newDefault) {
+			continue
+		}
+
+		conflicts = append(conflicts, Conflict{
+			Path:       entry.Path,
+			UserValue:  entry.UserValue,
+			OldDefault: entry.DefaultValue,
+			NewDefault: newDefault,
+		})
+	}
+
+	return conflicts
+}
+
+// RenameCandidates returns keys that are new in the target chart and end in the same key name as
+// a removed path. Charts usually remove a key by moving it, so these are its likely new names.
+// Keys that end in the whole removed path (e.g. "primary.persistence.size" for
+// "persistence.size") are preferred over keys that only share the last name
+func RenameCandidates(path string, oldDefaults, newDefaults Values) []string {
+	parts := strings.Split(path, pathSeparator)
+	name := parts[len(parts)-1]
+
+	var moved, sameName []string
+	for _, newPath := range newDefaults.GetPaths() {
+		if _, existsInOld := oldDefaults[newPath]; existsInOld {
+			continue
+		}
+		if strings.HasSuffix(newPath, pathSeparator+path) {
+			moved = append(moved, newPath)
+			continue
+		}
+		newParts := strings.Split(newPath, pathSeparator)
+		if newParts[len(newParts)-1] == name {
+			sameName = append(sameName, newPath)
+		}
+	}
+
+	if len(moved) > 0 {
+		return moved
+	}
+	return sameName
+}
+
+// NoOpDeletions returns the paths the user set to null that no longer exist in the new defaults.
+// There is nothing left for them to delete, so they are dropped from the upgraded values
+func NoOpDeletions(result *ClassificationResult, newDefaults Values) []string {
+	var paths []string
+
+	for _, entry := range result.Entries {
+		if entry.Classification == Deletion && !KeyExists(entry.Path, newDefaults) {
+			paths = append(paths, entry.Path)
+		}
+	}
+
+	return paths
+}
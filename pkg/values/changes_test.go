@@ -0,0 +1,302 @@
+package values
+
+import (
+	"testing"
+)
+
+func TestUpdatedDefaults(t *testing.T) {
+	oldDefaults := Values{
+		"replicaCount":      1,
+		"image::tag":        "1.0.0",
+		"service::port":     80,
+		"removed::key":      "old",
+		"customized::value": "default",
+	}
+	newDefaults := Values{
+		"replicaCount":      1,
+		"image::tag":        "2.0.0",
+		"service::port":     8080,
+		"customized::value": "new-default",
+	}
+	userValues := Values{
+		"replicaCount":      1,
+		"image::tag":        "1.0.0",
+		"service::port":     80,
+		"removed::key":      "old",
+		"customized::value": "mine",
+	}
+
+	classification := Classify(userValues, oldDefaults)
+	changes := UpdatedDefaults(classification, newDefaults)
+
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 updated defaults, got %d: %v", len(changes), changes)
+	}
+
+	// Entries are sorted by path, so changes follow the same order
+	if changes[0].Path != "image::tag" || changes[0].OldValue != "1.0.0" || changes[0].NewValue != "2.0.0" {
+		t.Errorf("unexpected change for image::tag: %+v", changes[0])
+	}
+	if changes[1].Path != "service::port" || changes[1].OldValue != 80 || changes[1].NewValue != 8080 {
+		t.Errorf("unexpected change for service::port: %+v", changes[1])
+	}
+}
+
+func TestDiffDefaults(t *testing.T) {
+	oldDefaults := Values{
+		"replicaCount":  1,
+		"image::tag":    "1.0.0",
+		"legacy::mode":  "on",
+		"service::port": 80,
+	}
+	newDefaults := Values{
+		"replicaCount":    1,
+		"image::tag":      "2.0.0",
+		"service::port":   80,
+		"metrics::port":   9090,
+		"metrics::enable": false,
+	}
+
+	diff := DiffDefaults(oldDefaults, newDefaults)
+
+	if len(diff.Added) != 2 || diff.Added[0].Path != "metrics::enable" || diff.Added[1].NewValue != 9090 {
+		t.Errorf("unexpected added keys %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Path != "legacy::mode" || diff.Removed[0].OldValue != "on" {
+		t.Errorf("unexpected removed keys %+v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Path != "image::tag" || diff.Changed[0].NewValue != "2.0.0" {
+		t.Errorf("unexpected changed keys %+v", diff.Changed)
+	}
+
+	if same := DiffDefaults(oldDefaults, oldDefaults); len(same.Added)+len(same.Removed)+len(same.Changed) != 0 {
+		t.Errorf("expected no differences between identical defaults, got %+v", same)
+	}
+}
+
+func TestMarkRemovedInTarget_RemovedParent(t *testing.T) {
+	oldDefaults := Values{
+		"podAnnotations":       map[string]interface{}{},
+		"nodeSelector":         map[string]interface{}{},
+		"config::a":            "a",
+		"extraEnv::replaced":   "old",
+		"service::annotations": map[string]interface{}{},
+	}
+	newDefaults := Values{
+		"nodeSelector":         map[string]interface{}{},
+		"extraEnv::renamed":    "new",
+		"service::annotations": map[string]interface{}{},
+	}
+	userValues := Values{
+		"podAnnotations::foo":       "bar",
+		"nodeSelector::disk":        "ssd",
+		"config::b":                 "b",
+		"extraEnv::mine":            "x",
+		"service::annotations::foo": "bar",
+	}
+
+	result := Classify(userValues, oldDefaults)
+	MarkRemovedInTarget(result, oldDefaults, newDefaults)
+
+	want := map[string]Classification{
+		"podAnnotations::foo":       RemovedInTarget,
+		"nodeSelector::disk":        Customized,
+		"config::b":                 RemovedInTarget,
+		"extraEnv::mine":            Customized,
+		"service::annotations::foo": Customized,
+	}
+	for _, entry := range result.Entries {
+		if entry.Classification != want[entry.Path] {
+			t.Errorf("expected %s to be %s, got %s", entry.Path, want[entry.Path], entry.Classification)
+		}
+	}
+	if result.Removed != 2 || result.Customized != 3 {
+		t.Errorf("expected 2 removed and 3 customized, got %+v", result)
+	}
+}
+
+func TestMarkRemovedInTarget(t *testing.T) {
+	oldDefaults := Values{
+		"kept":       "value",
+		"dropped::a": "a",
+		"dropped::b": "b",
+	}
+	newDefaults := Values{
+		"kept": "value",
+	}
+	userValues := Values{
+		"kept":       "value",
+		"dropped::a": "a",      // copied default
+		"dropped::b": "custom", // customized
+		"unknown":    "mine",
+	}
+
+	result := Classify(userValues, oldDefaults)
+	MarkRemovedInTarget(result, oldDefaults, newDefaults)
+
+	if result.Removed != 2 {
+		t.Errorf("expected 2 removed, got %d", result.Removed)
+	}
+	if result.Customized != 0 {
+		t.Errorf("expected 0 customized, got %d", result.Customized)
+	}
+	if result.CopiedDefault != 1 {
+		t.Errorf("expected 1 copied default, got %d", result.CopiedDefault)
+	}
+	if result.Unknown != 1 {
+		t.Errorf("expected 1 unknown, got %d", result.Unknown)
+	}
+	if result.Total != 4 {
+		t.Errorf("expected total to stay 4, got %d", result.Total)
+	}
+
+	for _, entry := range result.Entries {
+		switch entry.Path {
+		case "dropped::a", "dropped::b":
+			if entry.Classification != RemovedInTarget {
+				t.Errorf("expected %s to be REMOVED_IN_TARGET, got %s", entry.Path, entry.Classification)
+			}
+			if entry.DefaultValue != oldDefaults[entry.Path] {
+				t.Errorf("expected %s to keep its old default, got %v", entry.Path, entry.DefaultValue)
+			}
+		case "unknown":
+			if entry.Classification != Unknown {
+				t.Errorf("expected unknown to stay UNKNOWN, got %s", entry.Classification)
+			}
+		}
+	}
+}
+
+func TestParseRemovedKeyAction(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    RemovedKeyAction
+		wantErr bool
+	}{
+		{"", RemovedKeep, false},
+		{"keep", RemovedKeep, false},
+		{"drop", RemovedDrop, false},
+		{"comment", RemovedComment, false},
+		{"delete", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRemovedKeyAction(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRemovedKeyAction(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRemovedKeyAction(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToCommentedYAML(t *testing.T) {
+	v := Values{
+		"primary::oldSetting": "on",
+	}
+
+	out, err := v.ToCommentedYAML("Removed keys:")
+	if err != nil {
+		t.Fatalf("ToCommentedYAML() error = %v", err)
+	}
+
+	expected := "# Removed keys:\n# primary:\n#     oldSetting: \"on\"\n"
+	if out != expected {
+		t.Errorf("unexpected output:\n%q\nwant:\n%q", out, expected)
+	}
+
+	parsed, err := ParseYAML(out)
+	if err != nil {
+		t.Fatalf("commented YAML should still parse: %v", err)
+	}
+	if len(parsed) != 0 {
+		t.Errorf("expected commented YAML to contain no values, got %v", parsed)
+	}
+}
+
+func TestDetectConflicts(t *testing.T) {
+	oldDefaults := Values{
+		"replicaCount":  1,
+		"service::port": 80,
+		"image::tag":    "1.0.0",
+	}
+	newDefaults := Values{
+		"replicaCount":  2,
+		"service::port": 80,
+		"image::tag":    "2.0.0",
+	}
+	userValues := Values{
+		"replicaCount":  3,       // customized, default changed -> conflict
+		"service::port": 8080,    // customized, default unchanged
+		"image::tag":    "1.0.0", // copied default
+	}
+
+	classification := Classify(userValues, oldDefaults)
+	conflicts := DetectConflicts(classification, newDefaults)
+
+	if len(conflicts) != 1 {
+		t.Fatalf("expected 1 conflict, got %d: %+v", len(conflicts), conflicts)
+	}
+
+	conflict := conflicts[0]
+	if conflict.Path != "replicaCount" || conflict.UserValue != 3 || conflict.OldDefault != 1 || conflict.NewDefault != 2 {
+		t.Errorf("unexpected conflict: %+v", conflict)
+	}
+}
+
+func TestRenameCandidates(t *testing.T) {
+	oldDefaults := Values{"postgresqlPassword": "", "auth::username": "", "replicaCount": 1, "persistence::size": "8Gi"}
+	newDefaults := Values{
+		"auth::password":                  "",
+		"auth::username":                  "",
+		"primary::replicaCount":           1,
+		"primary::persistence::size":      "8Gi",
+		"readReplicas::resources::size":   "small",
+		"readReplicas::persistence::size": "8Gi",
+	}
+
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{path: "replicaCount", expected: []string{"primary::replicaCount"}},
+		{path: "postgresqlPassword", expected: nil},
+		{path: "legacy::username", expected: nil}, // auth::username already existed
+		{path: "persistence::size", expected: []string{"primary::persistence::size", "readReplicas::persistence::size"}},
+		{path: "legacy::size", expected: []string{"primary::persistence::size", "readReplicas::persistence::size", "readReplicas::resources::size"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := RenameCandidates(tt.path, oldDefaults, newDefaults)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("RenameCandidates(%q) = %v, want %v", tt.path, got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("RenameCandidates(%q)[%d] = %q, want %q", tt.path, i, got[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNoOpDeletions(t *testing.T) {
+	oldDefaults := Values{"legacy::enabled": true, "resources::limits::cpu": "100m", "team": "core"}
+	newDefaults := Values{"resources::limits::cpu": "200m", "team": "core"}
+	userValues := Values{"legacy": nil, "resources": nil, "team": nil}
+
+	result := Classify(userValues, oldDefaults)
+	MarkRemovedInTarget(result, oldDefaults, newDefaults)
+
+	noOps := NoOpDeletions(result, newDefaults)
+	if len(noOps) != 1 || noOps[0] != "legacy" {
+		t.Errorf("expected only legacy to be a no-op deletion, got %v", noOps)
+	}
+	if result.Removed != 0 {
+		t.Errorf("expected deletions not to be marked removed, got %d", result.Removed)
+	}
+}
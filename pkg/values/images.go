@@ -87,3 +87,14 @@ func ApplyImageUpgrades(values Values, upgrades []ImageChange) Values {
 
 	return result
 }
+
+// PinnedImageTags returns the image tag paths the user sets to a fixed tag, sorted
+func PinnedImageTags(userValues Values) []string {
+	var paths []string
+	for _, path := range userValues.GetPaths() {
+		if tag, ok := userValues[path].(string); ok && tag != "" && isImageTagPath(path) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
@@ -259,3 +259,24 @@ func TestApplyImageUpgrades_NilUpgrades(t *testing.T) {
 		t.Errorf("expected image::tag to remain '1.0.0', got %v", result["image::tag"])
 	}
 }
+
+func TestPinnedImageTags(t *testing.T) {
+	userValues := Values{
+		"image::tag":              "1.2.3",
+		"sidecar::image::tag":     "",
+		"metrics::image::tag":     "0.9.0",
+		"image::repository":       "nginx",
+		"metrics::image::pullTag": "latest",
+	}
+
+	got := PinnedImageTags(userValues)
+	expected := []string{"image::tag", "metrics::image::tag"}
+	if len(got) != len(expected) {
+		t.Fatalf("PinnedImageTags() = %v, want %v", got, expected)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("PinnedImageTags()[%d] = %s, want %s", i, got[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package values
+
+import (
+	"strings"
+)
+
+// Layer is one values file in a stack applied in order, like repeated helm -f flags
+type Layer struct {
+	Source  string // File the values were read from
+	Values  Values
+	Content string // Raw file content, kept so the file can be patched in place
+}
+
+// Coalesce combines layers the way Helm combines repeated -f flags: later layers override
+// earlier ones key by key, a scalar replaces a map set by an earlier layer and a map replaces
+// an earlier scalar. It returns the combined values and the source of every combined key
+func Coalesce(layers []Layer) (Values, map[string]string) {
+	result := make(Values)
+	sources := make(map[string]string)
+
+	for _, layer := range layers {
+		for _, path := range layer.Values.GetPaths() {
+			value := layer.Values[path]
+			prefix := path + pathSeparator
+
+			// An empty map merges into an earlier map instead of replacing it
+			if emptyMap, ok := value.(map[string]interface{}); ok && len(emptyMap) == 0 && hasChildren(result, prefix) {
+				continue
+			}
+
+			// Drop anything an earlier layer nested under this key
+			for existing := range result {
+				if strings.HasPrefix(existing, prefix) {
+					delete(sources, existing)
+				}
+			}
+			deleteChildren(result, path)
+
+			// Drop earlier scalars (or empty maps) this key now nests under
+			parts := strings.Split(path, pathSeparator)
+			for i := 1; i < len(parts); i++ {
+				parent := strings.Join(parts[:i], pathSeparator)
+				delete(result, parent)
+				delete(sources, parent)
+			}
+
+			result[path] = value
+			sources[path] = layer.Source
+		}
+	}
+
+	return result, sources
+}
+
+// hasChildren reports whether any path in v starts with prefix
+func hasChildren(v Values, prefix string) bool {
+	for path := range v {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// AttributeSources records on each entry the values file that set it
+func AttributeSources(result *ClassificationResult, sources map[string]string) {
+	for i := range result.Entries {
+		result.Entries[i].Source = sources[result.Entries[i].Path]
+	}
+}
+
+// MergeLayer upgrades a single overlay values file. Keys that matched the old default move to
+// the new default (or are dropped when the target chart no longer has them), deletions are kept
+// while the key still exists and every other key is kept. Unlike Merge, new chart defaults the
+// layer didn't set are not added. The policy applies like it does in Merge
+func MergeLayer(layerValues, oldDefaults, newDefaults Values, policy *Policy) Values {
+	result := make(Values)
+
+	for path, value := range layerValues {
+		if isDeletion(path, value, oldDefaults) {
+			if KeyExists(path, newDefaults) {
+				result[path] = nil
+			}
+			continue
+		}
+
+		if applyPolicy(result, path, value, newDefaults, policy) {
+			continue
+		}
+
+		oldDefault, existsInOld := oldDefaults[path]
+		if !existsInOld || !ValuesEqual(value, oldDefault) {
+			result[path] = value
+			continue
+		}
+		if newDefault, existsInNew := newDefaults[path]; existsInNew {
+			result[path] = newDefault
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,108 @@
+package values
+
+import (
+	"testing"
+)
+
+func TestCoalesce(t *testing.T) {
+	layers := []Layer{
+		{Source: "base.yaml", Values: Values{
+			"replicaCount":        1,
+			"image::tag":          "1.0.0",
+			"resources::limits":   "none",
+			"nodeSelector::zone":  "a",
+			"podAnnotations::foo": "bar",
+		}},
+		{Source: "prod.yaml", Values: Values{
+			"replicaCount":               3,
+			"resources::limits::cpu":     "1",
+			"nodeSelector":               "disabled",
+			"podAnnotations":             map[string]interface{}{},
+			"service::annotations::team": "db",
+		}},
+	}
+
+	combined, sources := Coalesce(layers)
+
+	expected := Values{
+		"replicaCount":               3,
+		"image::tag":                 "1.0.0",
+		"resources::limits::cpu":     "1",
+		"nodeSelector":               "disabled",
+		"podAnnotations::foo":        "bar",
+		"service::annotations::team": "db",
+	}
+	if len(combined) != len(expected) {
+		t.Errorf("expected %d keys, got %d: %v", len(expected), len(combined), combined)
+	}
+	for path, want := range expected {
+		if got := combined[path]; !ValuesEqual(got, want) {
+			t.Errorf("%s = %v, want %v", path, got, want)
+		}
+	}
+
+	expectedSources := map[string]string{
+		"replicaCount":           "prod.yaml",
+		"image::tag":             "base.yaml",
+		"resources::limits::cpu": "prod.yaml",
+		"nodeSelector":           "prod.yaml",
+		"podAnnotations::foo":    "base.yaml",
+	}
+	for path, want := range expectedSources {
+		if got := sources[path]; got != want {
+			t.Errorf("source of %s = %q, want %q", path, got, want)
+		}
+	}
+	if _, exists := sources["resources::limits"]; exists {
+		t.Error("expected replaced key to have no source")
+	}
+}
+
+func TestAttributeSources(t *testing.T) {
+	result := Classify(Values{"a": 1, "b": 2}, Values{"a": 1})
+	AttributeSources(result, map[string]string{"a": "base.yaml", "b": "prod.yaml"})
+
+	for _, entry := range result.Entries {
+		want := map[string]string{"a": "base.yaml", "b": "prod.yaml"}[entry.Path]
+		if entry.Source != want {
+			t.Errorf("source of %s = %q, want %q", entry.Path, entry.Source, want)
+		}
+	}
+}
+
+func TestMergeLayer(t *testing.T) {
+	layer := Values{
+		"replicaCount": 1,        // copied default, updated
+		"image::tag":   "custom", // customized, kept
+		"legacy":       true,     // copied default removed in target, dropped
+		"extra":        "x",      // unknown, kept
+	}
+	oldDefaults := Values{"replicaCount": 1, "image::tag": "1.0.0", "legacy": true, "other": "o"}
+	newDefaults := Values{"replicaCount": 2, "image::tag": "2.0.0", "other": "n"}
+
+	result := MergeLayer(layer, oldDefaults, newDefaults, nil)
+
+	expected := Values{"replicaCount": 2, "image::tag": "custom", "extra": "x"}
+	if len(result) != len(expected) {
+		t.Errorf("expected %d keys, got %d: %v", len(expected), len(result), result)
+	}
+	for path, want := range expected {
+		if got := result[path]; !ValuesEqual(got, want) {
+			t.Errorf("%s = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestMergeLayer_Deletions(t *testing.T) {
+	oldDefaults := Values{"podLabels::team": "core", "legacy": true}
+	newDefaults := Values{"podLabels::team": "core"}
+
+	result := MergeLayer(Values{"podLabels::team": nil, "legacy": nil}, oldDefaults, newDefaults, nil)
+
+	if value, exists := result["podLabels::team"]; !exists || value != nil {
+		t.Errorf("expected deletion to be kept, got %v", value)
+	}
+	if _, exists := result["legacy"]; exists {
+		t.Error("expected no-op deletion to be dropped")
+	}
+}
@@ -0,0 +1,376 @@
+package values
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mergeKey is the YAML merge key that inlines the keys of one or more anchored maps
+const mergeKey = "<<"
+
+// PatchYAML rewrites a values document so it holds exactly the target values while keeping its
+// layout: key order, comments, anchors, aliases and merge keys survive. Values are changed where
+// they are defined, so updating an anchored value also updates its aliases; an alias or merged
+// key is only expanded in place when it must differ from its anchor. Keys new to the document
+// are appended with their chart comment
+func PatchYAML(content string, target Values, comments CommentMap) (string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return "", fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode}
+	}
+	if len(doc.Content) == 0 {
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return "", fmt.Errorf("values document is not a map")
+	}
+
+	p := &patcher{root: root, doc: &doc, target: target, comments: comments}
+
+	// First change values where they are defined, keeping anchors shared with their aliases
+	diffs, err := p.diff()
+	if err != nil {
+		return "", err
+	}
+	for _, path := range diffs {
+		p.apply(path, false)
+	}
+
+	// Then fix the paths still off, expanding aliases and merged keys where they have to differ.
+	// Every step leaves one more path correct, so this ends within one pass per path
+	for range len(target) + len(diffs) + 1 {
+		diffs, err = p.diff()
+		if err != nil {
+			return "", err
+		}
+		if len(diffs) == 0 {
+			return encodeDocument(&doc, DetectIndent(content))
+		}
+		if !p.apply(diffs[0], true) {
+			break
+		}
+	}
+
+	return "", fmt.Errorf("failed to patch %s", PathToDisplayFormat(diffs[0]))
+}
+
+// patcher applies target values to a parsed YAML document
+type patcher struct {
+	root     *yaml.Node
+	doc      *yaml.Node
+	target   Values
+	comments CommentMap
+}
+
+// diff returns the paths where the document differs from the target values, in sorted order
+func (p *patcher) diff() ([]string, error) {
+	var nested map[string]interface{}
+	if err := p.doc.Decode(&nested); err != nil {
+		return nil, fmt.Errorf("failed to decode patched YAML: %w", err)
+	}
+	current := Flatten(nested)
+
+	var paths []string
+	for path, value := range p.target {
+		if existing, exists := current[path]; !exists || !ValuesEqual(existing, value) {
+			paths = append(paths, path)
+		}
+	}
+	for path := range current {
+		// An empty map the target fills in is kept in place rather than deleted and re-added
+		if _, exists := p.target[path]; !exists && !hasChildren(p.target, path+pathSeparator) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// apply sets or deletes path in the document. Without local it only follows keys defined in
+// place; with local it expands aliases and merged keys on the way so the change affects path
+// alone. It reports whether the document was changed
+func (p *patcher) apply(path string, local bool) bool {
+	parts := strings.Split(path, pathSeparator)
+	for i := range parts {
+		parts[i] = unescapeKeyDots(parts[i])
+	}
+
+	value, set := p.target[path]
+	mapping, index := p.find(parts, set, local)
+	if mapping == nil {
+		return false
+	}
+
+	if !set {
+		mapping.Content = append(mapping.Content[:index-1], mapping.Content[index+1:]...)
+		return true
+	}
+
+	node := mapping.Content[index]
+	if node.Kind == yaml.AliasNode {
+		node = &yaml.Node{}
+		mapping.Content[index] = node
+	}
+	return setNode(node, value) == nil
+}
+
+// find returns the mapping holding the last key of parts and the index of its value node.
+// With create, missing keys are added as maps; a key to delete that is only merged in from an
+// anchor is made deletable by expanding the merge
+func (p *patcher) find(parts []string, create, local bool) (*yaml.Node, int) {
+	current := p.root
+
+	for i, part := range parts {
+		last := i == len(parts)-1
+		index := valueIndex(current, part)
+
+		if index < 0 && inherited(current, part) != nil {
+			if !local {
+				return nil, -1
+			}
+			if last && !create {
+				expandMerges(current)
+			} else {
+				inheritKey(current, part)
+			}
+			index = valueIndex(current, part)
+		}
+
+		if index < 0 {
+			if !create {
+				return nil, -1
+			}
+			current.Content = append(current.Content, p.keyNode(parts[:i+1]), &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+			index = len(current.Content) - 1
+		}
+
+		if last {
+			return current, index
+		}
+
+		child := current.Content[index]
+		if child.Kind == yaml.AliasNode {
+			if !local {
+				return nil, -1
+			}
+			child = copyNode(child.Alias)
+			current.Content[index] = child
+		}
+		if child.Kind != yaml.MappingNode {
+			if !create {
+				return nil, -1
+			}
+			*child = yaml.Node{
+				Kind:        yaml.MappingNode,
+				Tag:         "!!map",
+				Anchor:      child.Anchor,
+				HeadComment: child.HeadComment,
+				LineComment: child.LineComment,
+				FootComment: child.FootComment,
+			}
+		}
+		if child.Style&yaml.FlowStyle != 0 && len(child.Content) == 0 {
+			child.Style = 0
+		}
+		current = child
+	}
+
+	return nil, -1
+}
+
+// keyNode creates the key for a new entry, headed by the chart's comment for it
+func (p *patcher) keyNode(parts []string) *yaml.Node {
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: parts[len(parts)-1]}
+	if comment := p.comments[strings.Join(parts, ".")]; comment != "" {
+		key.HeadComment = "## " + comment
+	}
+	return key
+}
+
+// valueIndex returns the index of the value node for key defined directly in mapping, or -1
+func valueIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if k := mapping.Content[i]; k.Kind == yaml.ScalarNode && k.Value == key && k.Tag != "!!merge" {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// mergeSources returns the maps merged into mapping through merge keys, earliest first.
+// Keys from earlier maps take precedence over later ones
+func mergeSources(mapping *yaml.Node) []*yaml.Node {
+	var sources []*yaml.Node
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if k := mapping.Content[i]; k.Value != mergeKey || k.Tag != "!!merge" {
+			continue
+		}
+
+		value := mapping.Content[i+1]
+		items := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			items = value.Content
+		}
+		for _, item := range items {
+			item = resolveAlias(item)
+			if item.Kind == yaml.MappingNode {
+				sources = append(sources, item)
+			}
+		}
+	}
+	return sources
+}
+
+// inherited returns the key and value nodes that mapping gets for key through a merge key
+func inherited(mapping *yaml.Node, key string) []*yaml.Node {
+	for _, source := range mergeSources(mapping) {
+		if index := valueIndex(source, key); index >= 0 {
+			return source.Content[index-1 : index+1]
+		}
+		if pair := inherited(source, key); pair != nil {
+			return pair
+		}
+	}
+	return nil
+}
+
+// inheritKey copies a merged key into mapping, where it overrides the merged one
+func inheritKey(mapping *yaml.Node, key string) {
+	pair := inherited(mapping, key)
+	mapping.Content = append(mapping.Content, copyNode(pair[0]), copyNode(pair[1]))
+}
+
+// expandMerges replaces the merge keys of mapping with copies of the keys they merge in
+func expandMerges(mapping *yaml.Node) {
+	var merged []*yaml.Node
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		seen[mapping.Content[i].Value] = true
+	}
+
+	var collect func(source *yaml.Node)
+	collect = func(source *yaml.Node) {
+		for i := 0; i+1 < len(source.Content); i += 2 {
+			key := source.Content[i]
+			if key.Tag == "!!merge" || seen[key.Value] {
+				continue
+			}
+			seen[key.Value] = true
+			merged = append(merged, copyNode(key), copyNode(source.Content[i+1]))
+		}
+		for _, nested := range mergeSources(source) {
+			collect(nested)
+		}
+	}
+	for _, source := range mergeSources(mapping) {
+		collect(source)
+	}
+
+	content := make([]*yaml.Node, 0, len(mapping.Content)+len(merged))
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if key := mapping.Content[i]; key.Value == mergeKey && key.Tag == "!!merge" {
+			content = append(content, merged...)
+			merged = nil
+			continue
+		}
+		content = append(content, mapping.Content[i], mapping.Content[i+1])
+	}
+	mapping.Content = content
+}
+
+// resolveAlias follows aliases to the node they refer to
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// copyNode deep copies a node, resolving aliases. Anchors are dropped so the copy doesn't
+// redefine an anchor that later aliases refer to
+func copyNode(node *yaml.Node) *yaml.Node {
+	node = resolveAlias(node)
+	clone := *node
+	clone.Anchor = ""
+	clone.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		if child.Kind == yaml.AliasNode {
+			clone.Content[i] = child
+			continue
+		}
+		clone.Content[i] = copyNode(child)
+	}
+	return &clone
+}
+
+// setNode replaces the value of node, keeping its comments, anchor and quoting style
+func setNode(node *yaml.Node, value interface{}) error {
+	var replacement yaml.Node
+	if err := replacement.Encode(value); err != nil {
+		return err
+	}
+
+	if node.Kind == yaml.ScalarNode && replacement.Kind == yaml.ScalarNode &&
+		node.Tag == "!!str" && replacement.Tag == "!!str" && node.Style != 0 {
+		replacement.Style = node.Style
+	}
+	replacement.Anchor = node.Anchor
+	replacement.HeadComment = node.HeadComment
+	replacement.LineComment = node.LineComment
+	replacement.FootComment = node.FootComment
+
+	*node = replacement
+	return nil
+}
+
+// DetectIndent returns the indentation of the first nested line of a YAML document, default 2
+func DetectIndent(content string) int {
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		// Sequences written flush with their parent key say nothing about the indentation
+		if trimmed == "" || trimmed == line || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		return max(len(line)-len(trimmed), 2)
+	}
+	return 2
+}
+
+// encodeDocument marshals a YAML document with the given indentation
+func encodeDocument(doc *yaml.Node, indent int) (string, error) {
+	untagMergeKeys(doc)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(indent)
+	if err := encoder.Encode(doc); err != nil {
+		return "", fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// untagMergeKeys clears the resolved tag of merge keys, which the encoder would otherwise
+// write out as "!!merge <<"
+func untagMergeKeys(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if key := node.Content[i]; key.Value == mergeKey && key.Tag == "!!merge" {
+				key.Tag = ""
+			}
+		}
+	}
+	for _, child := range node.Content {
+		untagMergeKeys(child)
+	}
+}
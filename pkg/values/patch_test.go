@@ -0,0 +1,215 @@
+package values
+
+import (
+	"strings"
+	"testing"
+)
+
+const anchoredValues = `# Shared resources
+base: &defaults
+  replicas: 1
+  resources:
+    limits:
+      cpu: 100m
+api:
+  <<: *defaults
+  replicas: 3 # scaled up
+worker:
+  <<: *defaults
+sidecar: *defaults
+`
+
+func TestParseYAML_AnchorsAndMergeKeys(t *testing.T) {
+	parsed, err := ParseYAML(anchoredValues)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := Values{
+		"base::replicas":                  1,
+		"base::resources::limits::cpu":    "100m",
+		"api::replicas":                   3,
+		"api::resources::limits::cpu":     "100m",
+		"worker::replicas":                1,
+		"worker::resources::limits::cpu":  "100m",
+		"sidecar::replicas":               1,
+		"sidecar::resources::limits::cpu": "100m",
+	}
+	if len(parsed) != len(expected) {
+		t.Errorf("expected %d keys, got %d: %v", len(expected), len(parsed), parsed)
+	}
+	for path, value := range expected {
+		if !ValuesEqual(parsed[path], value) {
+			t.Errorf("%s: expected %v, got %v", path, value, parsed[path])
+		}
+	}
+
+	// Merged keys are classified like keys written out in full
+	defaults := Values{"worker::replicas": 1, "api::replicas": 1}
+	result := Classify(Values{"worker::replicas": parsed["worker::replicas"], "api::replicas": parsed["api::replicas"]}, defaults)
+	for _, entry := range result.Entries {
+		want := CopiedDefault
+		if entry.Path == "api::replicas" {
+			want = Customized
+		}
+		if entry.Classification != want {
+			t.Errorf("%s: expected %s, got %s", entry.Path, want, entry.Classification)
+		}
+	}
+}
+
+func TestPatchYAML(t *testing.T) {
+	original, err := ParseYAML(anchoredValues)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		change      func(v Values)
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:     "unchanged values keep the document",
+			change:   func(v Values) {},
+			contains: []string{"# Shared resources", "base: &defaults", "<<: *defaults", "sidecar: *defaults", "replicas: 3 # scaled up"},
+		},
+		{
+			name: "anchored value updated once for every alias",
+			change: func(v Values) {
+				for _, prefix := range []string{"base", "api", "worker", "sidecar"} {
+					v[prefix+"::resources::limits::cpu"] = "200m"
+				}
+			},
+			contains:    []string{"cpu: 200m", "<<: *defaults", "sidecar: *defaults"},
+			notContains: []string{"100m"},
+		},
+		{
+			name:        "merged key that differs is overridden in place",
+			change:      func(v Values) { v["worker::replicas"] = 2 },
+			contains:    []string{"worker:\n  <<: *defaults\n  replicas: 2", "sidecar: *defaults"},
+			notContains: []string{"worker::replicas"},
+		},
+		{
+			name:     "alias that differs is expanded",
+			change:   func(v Values) { v["sidecar::replicas"] = 5 },
+			contains: []string{"base: &defaults", "sidecar:\n  replicas: 5", "worker:\n  <<: *defaults"},
+		},
+		{
+			name: "new keys are appended with their chart comment",
+			change: func(v Values) {
+				v["api::image::tag"] = "1.2.3"
+			},
+			contains: []string{"  image:\n    ## Image tag\n    tag: 1.2.3"},
+		},
+		{
+			name: "removed keys are deleted",
+			change: func(v Values) {
+				delete(v, "sidecar::replicas")
+				delete(v, "sidecar::resources::limits::cpu")
+			},
+			contains:    []string{"worker:\n  <<: *defaults\n"},
+			notContains: []string{"sidecar"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := make(Values, len(original))
+			for path, value := range original {
+				target[path] = value
+			}
+			tt.change(target)
+
+			patched, err := PatchYAML(anchoredValues, target, CommentMap{"api.image.tag": "Image tag"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, want := range tt.contains {
+				if !strings.Contains(patched, want) {
+					t.Errorf("expected output to contain %q, got:\n%s", want, patched)
+				}
+			}
+			for _, unwanted := range tt.notContains {
+				if strings.Contains(patched, unwanted) {
+					t.Errorf("expected output not to contain %q, got:\n%s", unwanted, patched)
+				}
+			}
+
+			// The patched document must hold exactly the target values
+			reparsed, err := ParseYAML(patched)
+			if err != nil {
+				t.Fatalf("patched YAML does not parse: %v", err)
+			}
+			if len(reparsed) != len(target) {
+				t.Errorf("expected %d keys, got %d", len(target), len(reparsed))
+			}
+			for path, value := range target {
+				if !ValuesEqual(reparsed[path], value) {
+					t.Errorf("%s: expected %v, got %v", path, value, reparsed[path])
+				}
+			}
+		})
+	}
+}
+
+func TestPatchYAML_DeleteMergedKey(t *testing.T) {
+	target := Values{
+		"base::replicas":                  1,
+		"base::resources::limits::cpu":    "100m",
+		"api::replicas":                   3,
+		"api::resources::limits::cpu":     "100m",
+		"worker::resources::limits::cpu":  "100m",
+		"sidecar::replicas":               1,
+		"sidecar::resources::limits::cpu": "100m",
+	}
+
+	patched, err := PatchYAML(anchoredValues, target, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reparsed, err := ParseYAML(patched)
+	if err != nil {
+		t.Fatalf("patched YAML does not parse: %v", err)
+	}
+	if _, exists := reparsed["worker::replicas"]; exists {
+		t.Errorf("expected merged key to be deleted, got:\n%s", patched)
+	}
+	if reparsed["worker::resources::limits::cpu"] != "100m" {
+		t.Errorf("expected other merged keys to be kept, got:\n%s", patched)
+	}
+	if !strings.Contains(patched, "sidecar: *defaults") {
+		t.Errorf("expected unrelated aliases to be kept, got:\n%s", patched)
+	}
+}
+
+func TestPatchYAML_EmptyDocument(t *testing.T) {
+	patched, err := PatchYAML("", Values{"image::tag": "1.0", "enabled": true}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if patched != "enabled: true\nimage:\n  tag: \"1.0\"\n" {
+		t.Errorf("unexpected output:\n%s", patched)
+	}
+}
+
+func TestDetectIndent(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected int
+	}{
+		{"a: 1\n", 2},
+		{"# comment\na:\n    b: 1\n", 4},
+		{"list:\n- a\nmap:\n  b: 1\n", 2},
+		{"list:\n  - name: a\n    value: 1\n", 2},
+	}
+
+	for _, tt := range tests {
+		if got := DetectIndent(tt.content); got != tt.expected {
+			t.Errorf("DetectIndent(%q) = %d, expected %d", tt.content, got, tt.expected)
+		}
+	}
+}
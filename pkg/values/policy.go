@@ -0,0 +1,208 @@
+package values
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyAction controls how an upgrade treats the keys a policy rule matches
+type PolicyAction string
+
+const (
+	PolicyPin           PolicyAction = "pin"            // Keep the user's value even when it is a copied default the chart moved
+	PolicyAlwaysUpdate  PolicyAction = "always-update"  // Move the key to the new default even when customized
+	PolicyIgnore        PolicyAction = "ignore"         // Keep the user's value and leave the key out of the classification
+	PolicyRequireReview PolicyAction = "require-review" // Upgrade as usual, but report default changes for review
+)
+
+// PolicyRule applies an action to the keys matching a path glob. Globs use dots between keys,
+// "\." for a dot within a key, "*" matches within one key and "**" matches any number of keys.
+// A rule also matches every key below the paths it matches
+type PolicyRule struct {
+	Path   string       `yaml:"path"`
+	Action PolicyAction `yaml:"action"`
+}
+
+// Policy holds the rules of a policy file. The first rule matching a key decides its action.
+// A nil Policy has no rules
+type Policy struct {
+	Rules []PolicyRule `yaml:"policies"`
+}
+
+// LoadPolicy reads the policies of a config file such as .hvu.yaml
+func LoadPolicy(path string) (*Policy, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	policy, err := ParsePolicy(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// ParsePolicy parses the policies section of a config file and validates its rules
+func ParsePolicy(content []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := yaml.Unmarshal(content, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policies: %w", err)
+	}
+
+	for i, rule := range policy.Rules {
+		if rule.Path == "" {
+			return nil, fmt.Errorf("policy %d has no path", i+1)
+		}
+		switch rule.Action {
+		case PolicyPin, PolicyAlwaysUpdate, PolicyIgnore, PolicyRequireReview:
+		default:
+			return nil, fmt.Errorf("policy %s has invalid action %q (must be pin, always-update, ignore or require-review)", rule.Path, rule.Action)
+		}
+		for _, part := range splitPolicyPath(rule.Path) {
+			if _, err := path.Match(part, ""); err != nil {
+				return nil, fmt.Errorf("policy %s has an invalid glob: %w", rule.Path, err)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// Action returns the action of the first rule matching a flattened path, or "" when no rule does
+func (p *Policy) Action(flatPath string) PolicyAction {
+	if p == nil {
+		return ""
+	}
+
+	parts := strings.Split(flatPath, pathSeparator)
+	for i, part := range parts {
+		parts[i] = unescapeKeyDots(part)
+	}
+	for _, rule := range p.Rules {
+		if matchPolicyPath(splitPolicyPath(rule.Path), parts) {
+			return rule.Action
+		}
+	}
+	return ""
+}
+
+// splitPolicyPath splits a rule's glob into keys at every dot not escaped as "\."
+func splitPolicyPath(glob string) []string {
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case glob[i] == '\\' && i+1 < len(glob) && glob[i+1] == '.':
+			part.WriteByte('.')
+			i++
+		case glob[i] == '.':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(glob[i])
+		}
+	}
+	return append(parts, part.String())
+}
+
+// matchPolicyPath reports whether a glob's parts match the path's parts or a parent of the path
+func matchPolicyPath(glob, parts []string) bool {
+	if len(glob) == 0 {
+		return true
+	}
+	if glob[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchPolicyPath(glob[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(glob[0], parts[0]); !matched {
+		return false
+	}
+	return matchPolicyPath(glob[1:], parts[1:])
+}
+
+// ApplyPolicy records each entry's policy action and removes ignored keys from the
+// classification and its counts
+func ApplyPolicy(result *ClassificationResult, policy *Policy) {
+	if policy == nil {
+		return
+	}
+
+	entries := result.Entries[:0]
+	for _, entry := range result.Entries {
+		entry.Policy = policy.Action(entry.Path)
+		if entry.Policy != PolicyIgnore {
+			entries = append(entries, entry)
+			continue
+		}
+
+		switch entry.Classification {
+		case Customized:
+			result.Customized--
+		case CopiedDefault:
+			result.CopiedDefault--
+		case Unknown:
+			result.Unknown--
+		case RemovedInTarget:
+			result.Removed--
+		case Deletion:
+			result.Deletions--
+		}
+		result.Total--
+		result.Ignored++
+	}
+	result.Entries = entries
+}
+
+// PolicyReport lists the keys whose upgrade a policy changed or flagged
+type PolicyReport struct {
+	Pinned         []ValueChange // Copied defaults kept at their old value although the chart moved them
+	ForcedUpdates  []ValueChange // Customized keys moved to the new default, OldValue is the user's value
+	ReviewRequired []ValueChange // Keys whose chart default changed and that must be reviewed
+}
+
+// Empty reports whether no policy applied to the upgrade
+func (r *PolicyReport) Empty() bool {
+	return r == nil || len(r.Pinned)+len(r.ForcedUpdates)+len(r.ReviewRequired) == 0
+}
+
+// NewPolicyReport lists the entries whose policy changed or flagged their upgrade. ApplyPolicy
+// must have been called on the classification
+func NewPolicyReport(result *ClassificationResult, newDefaults Values) *PolicyReport {
+	report := &PolicyReport{}
+
+	for _, entry := range result.Entries {
+		if entry.Policy == "" || entry.Classification == Deletion {
+			continue
+		}
+		newDefault, existsInNew := newDefaults[entry.Path]
+		defaultChanged := existsInNew && !ValuesEqual(entry.DefaultValue, newDefault)
+
+		switch entry.Policy {
+		case PolicyPin:
+			if entry.Classification == CopiedDefault && defaultChanged {
+				report.Pinned = append(report.Pinned, ValueChange{Path: entry.Path, OldValue: entry.DefaultValue, NewValue: newDefault})
+			}
+		case PolicyAlwaysUpdate:
+			if existsInNew && !ValuesEqual(entry.UserValue, newDefault) && entry.Classification != CopiedDefault {
+				report.ForcedUpdates = append(report.ForcedUpdates, ValueChange{Path: entry.Path, OldValue: entry.UserValue, NewValue: newDefault})
+			}
+		case PolicyRequireReview:
+			if entry.Classification == RemovedInTarget || (entry.DefaultValue != nil && defaultChanged) {
+				report.ReviewRequired = append(report.ReviewRequired, ValueChange{Path: entry.Path, OldValue: entry.DefaultValue, NewValue: newDefault})
+			}
+		}
+	}
+
+	return report
+}
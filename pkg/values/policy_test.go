@@ -0,0 +1,229 @@
+package values
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		rules   int
+		wantErr string
+	}{
+		{
+			name:    "valid rules",
+			content: "policies:\n  - path: image.tag\n    action: pin\n  - path: \"**.resources\"\n    action: require-review\n",
+			rules:   2,
+		},
+		{
+			name:    "no policies",
+			content: "repositories: {}\n",
+			rules:   0,
+		},
+		{
+			name:    "missing path",
+			content: "policies:\n  - action: pin\n",
+			wantErr: "has no path",
+		},
+		{
+			name:    "invalid action",
+			content: "policies:\n  - path: image.tag\n    action: freeze\n",
+			wantErr: "invalid action",
+		},
+		{
+			name:    "invalid glob",
+			content: "policies:\n  - path: \"image.[tag\"\n    action: pin\n",
+			wantErr: "invalid glob",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := ParsePolicy([]byte(tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParsePolicy() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePolicy() error = %v", err)
+			}
+			if len(policy.Rules) != tt.rules {
+				t.Errorf("got %d rules, want %d", len(policy.Rules), tt.rules)
+			}
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".hvu.yaml")
+	if err := os.WriteFile(path, []byte("policies:\n  - path: image.tag\n    action: pin\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy() error = %v", err)
+	}
+	if policy.Action("image::tag") != PolicyPin {
+		t.Errorf("expected image.tag to be pinned, got %q", policy.Action("image::tag"))
+	}
+
+	if _, err := LoadPolicy(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected error for a missing policy file")
+	}
+}
+
+func TestPolicy_Action(t *testing.T) {
+	policy := &Policy{Rules: []PolicyRule{
+		{Path: "image.tag", Action: PolicyPin},
+		{Path: "metrics", Action: PolicyIgnore},
+		{Path: "*.image.tag", Action: PolicyAlwaysUpdate},
+		{Path: "**.resources", Action: PolicyRequireReview},
+		{Path: "annotations.example\\.com/team", Action: PolicyPin},
+		{Path: "image", Action: PolicyIgnore}, // shadowed by image.tag for that key
+	}}
+
+	tests := []struct {
+		path string
+		want PolicyAction
+	}{
+		{"image::tag", PolicyPin},
+		{"image::repository", PolicyIgnore},
+		{"metrics::enabled", PolicyIgnore},
+		{"metrics", PolicyIgnore},
+		{"sidecar::image::tag", PolicyAlwaysUpdate},
+		{"a::b::image::tag", ""},
+		{"resources::limits::cpu", PolicyRequireReview},
+		{"primary::resources::requests::memory", PolicyRequireReview},
+		{"primary::replicaCount", ""},
+		{"annotations::example.com/team", PolicyPin},
+		{"annotations::example", ""},
+		{"replicaCount", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := policy.Action(tt.path); got != tt.want {
+				t.Errorf("Action(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	var none *Policy
+	if got := none.Action("image::tag"); got != "" {
+		t.Errorf("nil policy Action() = %q, want none", got)
+	}
+}
+
+func TestApplyPolicy(t *testing.T) {
+	defaults := Values{
+		"image::tag":      "1.0",
+		"replicaCount":    1,
+		"metrics::port":   9090,
+		"metrics::enable": false,
+	}
+	user := Values{
+		"image::tag":      "1.0",
+		"replicaCount":    3,
+		"metrics::port":   9100,
+		"metrics::enable": false,
+		"extra":           "x",
+	}
+
+	result := Classify(user, defaults)
+	ApplyPolicy(result, &Policy{Rules: []PolicyRule{
+		{Path: "metrics", Action: PolicyIgnore},
+		{Path: "image.tag", Action: PolicyPin},
+	}})
+
+	if result.Ignored != 2 {
+		t.Errorf("Ignored = %d, want 2", result.Ignored)
+	}
+	if result.Total != 3 || result.Customized != 1 || result.CopiedDefault != 1 || result.Unknown != 1 {
+		t.Errorf("unexpected counts %+v", result)
+	}
+	for _, entry := range result.Entries {
+		if strings.HasPrefix(entry.Path, "metrics") {
+			t.Errorf("expected ignored key %s to be removed", entry.Path)
+		}
+		if entry.Path == "image::tag" && entry.Policy != PolicyPin {
+			t.Errorf("expected image.tag entry to record the pin policy, got %q", entry.Policy)
+		}
+	}
+}
+
+func TestMerge_Policy(t *testing.T) {
+	oldDefaults := Values{
+		"image::tag":    "1.0",
+		"replicaCount":  1,
+		"metrics::port": 9090,
+		"probe::delay":  10,
+	}
+	newDefaults := Values{
+		"image::tag":    "2.0",
+		"replicaCount":  2,
+		"metrics::port": 9191,
+		"probe::delay":  30,
+	}
+	userValues := Values{
+		"image::tag":    "1.0", // copied default, pinned
+		"replicaCount":  5,     // customized, always updated
+		"metrics::port": 9090,  // copied default, ignored
+		"probe::delay":  10,    // copied default, reviewed but updated
+	}
+	policy := &Policy{Rules: []PolicyRule{
+		{Path: "image.tag", Action: PolicyPin},
+		{Path: "replicaCount", Action: PolicyAlwaysUpdate},
+		{Path: "metrics", Action: PolicyIgnore},
+		{Path: "probe.*", Action: PolicyRequireReview},
+	}}
+
+	want := Values{
+		"image::tag":    "1.0",
+		"replicaCount":  2,
+		"metrics::port": 9090,
+		"probe::delay":  30,
+	}
+	for name, result := range map[string]Values{
+		"Merge":      Merge(userValues, oldDefaults, newDefaults, policy),
+		"MergeLayer": MergeLayer(userValues, oldDefaults, newDefaults, policy),
+	} {
+		for path, value := range want {
+			if !ValuesEqual(result[path], value) {
+				t.Errorf("%s: %s = %v, want %v", name, path, result[path], value)
+			}
+		}
+	}
+
+	classification := Classify(userValues, oldDefaults)
+	ApplyPolicy(classification, policy)
+	report := NewPolicyReport(classification, newDefaults)
+
+	if len(report.Pinned) != 1 || report.Pinned[0].Path != "image::tag" || report.Pinned[0].NewValue != "2.0" {
+		t.Errorf("unexpected pinned keys %+v", report.Pinned)
+	}
+	if len(report.ForcedUpdates) != 1 || report.ForcedUpdates[0].Path != "replicaCount" || report.ForcedUpdates[0].OldValue != 5 {
+		t.Errorf("unexpected forced updates %+v", report.ForcedUpdates)
+	}
+	if len(report.ReviewRequired) != 1 || report.ReviewRequired[0].Path != "probe::delay" {
+		t.Errorf("unexpected review required keys %+v", report.ReviewRequired)
+	}
+	if report.Empty() {
+		t.Error("expected report not to be empty")
+	}
+
+	if conflicts := DetectConflicts(classification, newDefaults); len(conflicts) != 0 {
+		t.Errorf("expected always-update keys not to conflict, got %+v", conflicts)
+	}
+	for _, change := range UpdatedDefaults(classification, newDefaults) {
+		if change.Path == "image::tag" {
+			t.Error("expected pinned key not to be reported as an updated default")
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package values
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RedactedValue replaces sensitive values in output
+const RedactedValue = "<redacted>"
+
+// sensitiveWords are words of key names whose values are credentials, wherever they appear in a path
+var sensitiveWords = map[string]bool{
+	"password":   true,
+	"passwd":     true,
+	"secret":     true,
+	"token":      true,
+	"apikey":     true,
+	"credential": true,
+}
+
+// referenceWords end key names that refer to a credential stored elsewhere rather than hold it,
+// such as existingSecret, secretName or passwordFile
+var referenceWords = map[string]bool{
+	"name": true,
+	"ref":  true,
+	"file": true,
+	"path": true,
+}
+
+// minBlobLength is the shortest string treated as an encoded key or certificate
+const minBlobLength = 40
+
+// Redactor masks sensitive values in output. A value is sensitive when its key names a credential,
+// such as auth.password or apiKey, when it looks like a base64 blob or PEM block, or when its path
+// matches one of the extra globs. Booleans, nulls and empty strings are never masked. A nil
+// Redactor masks nothing
+type Redactor struct {
+	globs [][]string
+}
+
+// builtinRedactor masks the values that the default rules detect, for logging
+var builtinRedactor = &Redactor{}
+
+// NewRedactor returns a redactor that also masks the values below paths matching globs. Globs use
+// the syntax of policy rule paths
+func NewRedactor(globs []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, glob := range globs {
+		parts := splitPolicyPath(glob)
+		for _, part := range parts {
+			if _, err := path.Match(part, ""); err != nil {
+				return nil, fmt.Errorf("invalid redact glob %s: %w", glob, err)
+			}
+		}
+		r.globs = append(r.globs, parts)
+	}
+	return r, nil
+}
+
+// Sensitive reports whether the value at a flattened path holds a credential, either as a whole
+// or in one of its list items, such as the value of an env entry named DB_PASSWORD
+func (r *Redactor) Sensitive(flatPath string, value interface{}) bool {
+	if r == nil {
+		return false
+	}
+	_, masked := r.redact(splitFlatPath(flatPath), value)
+	return masked
+}
+
+// Value returns value with its sensitive parts replaced by RedactedValue. Lists and maps are
+// copied rather than changed in place
+func (r *Redactor) Value(flatPath string, value interface{}) interface{} {
+	if r == nil {
+		return value
+	}
+	redacted, _ := r.redact(splitFlatPath(flatPath), value)
+	return redacted
+}
+
+// redact masks the value at a path, or the sensitive items and keys within it, and reports
+// whether anything was masked
+func (r *Redactor) redact(parts []string, value interface{}) (interface{}, bool) {
+	if !maskable(value) {
+		return value, false
+	}
+	if r.sensitivePath(parts) {
+		return RedactedValue, true
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		masked := false
+		for i, item := range v {
+			var itemMasked bool
+			redacted[i], itemMasked = r.redact(parts, item)
+			masked = masked || itemMasked
+		}
+		return redacted, masked
+	case map[string]interface{}:
+		// Entries such as env variables name their value: {name: DB_PASSWORD, value: hunter2}
+		name, _ := v["name"].(string)
+		namedSecret := name != "" && sensitiveKey([]string{name})
+
+		redacted := make(map[string]interface{}, len(v))
+		masked := false
+		for key, item := range v {
+			if key == "value" && namedSecret && maskable(item) {
+				redacted[key] = RedactedValue
+				masked = true
+				continue
+			}
+			var itemMasked bool
+			redacted[key], itemMasked = r.redact(append(parts[:len(parts):len(parts)], key), item)
+			masked = masked || itemMasked
+		}
+		return redacted, masked
+	case string:
+		if looksEncoded(v) {
+			return RedactedValue, true
+		}
+	}
+	return value, false
+}
+
+// YAML returns a values document with its sensitive values masked, keeping its layout and comments
+func (r *Redactor) YAML(content string) (string, error) {
+	if r == nil || strings.TrimSpace(content) == "" {
+		return content, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return "", fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	for _, node := range doc.Content {
+		r.redactNode(nil, node)
+	}
+	return encodeDocument(&doc, DetectIndent(content))
+}
+
+// CommentedYAML masks the sensitive values of a commented-out values block, such as the block of
+// keys removed in the target chart. Its first comment line is a header and is kept as it is
+func (r *Redactor) CommentedYAML(block string) (string, error) {
+	if r == nil || block == "" {
+		return block, nil
+	}
+
+	lines := strings.Split(strings.TrimRight(block, "\n"), "\n")
+	header := 0
+	for header < len(lines) && !strings.HasPrefix(lines[header], "#") {
+		header++
+	}
+	if header >= len(lines) {
+		return block, nil
+	}
+
+	var content strings.Builder
+	for _, line := range lines[header+1:] {
+		content.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "#"), " ") + "\n")
+	}
+	masked, err := r.YAML(content.String())
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, line := range lines[:header+1] {
+		b.WriteString(line + "\n")
+	}
+	for _, line := range strings.Split(strings.TrimRight(masked, "\n"), "\n") {
+		b.WriteString("# " + line + "\n")
+	}
+	return b.String(), nil
+}
+
+// redactNode masks the sensitive values in a YAML node at the path of keys parts, in place
+func (r *Redactor) redactNode(parts []string, node *yaml.Node) {
+	if len(parts) > 0 && node.Kind != yaml.MappingNode {
+		var value interface{}
+		if err := node.Decode(&value); err == nil && maskable(value) && r.sensitivePath(parts) {
+			maskNode(node)
+			return
+		}
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		// Entries such as env variables name their value: {name: DB_PASSWORD, value: hunter2}
+		namedSecret := false
+		if i := valueIndex(node, "name"); i >= 0 && node.Content[i].Kind == yaml.ScalarNode {
+			namedSecret = node.Content[i].Value != "" && sensitiveKey([]string{node.Content[i].Value})
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == "value" && namedSecret && value.Kind == yaml.ScalarNode && value.Value != "" {
+				maskNode(value)
+				continue
+			}
+			r.redactNode(append(parts[:len(parts):len(parts)], key.Value), value)
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			r.redactNode(parts, item)
+		}
+	case yaml.ScalarNode:
+		if node.Tag == "!!str" && looksEncoded(node.Value) {
+			maskNode(node)
+		}
+	}
+}
+
+// maskNode replaces a node with RedactedValue, keeping its anchor and comments
+func maskNode(node *yaml.Node) {
+	*node = yaml.Node{
+		Kind:        yaml.ScalarNode,
+		Tag:         "!!str",
+		Value:       RedactedValue,
+		Anchor:      node.Anchor,
+		HeadComment: node.HeadComment,
+		LineComment: node.LineComment,
+		FootComment: node.FootComment,
+	}
+}
+
+// sensitivePath reports whether the keys of a path name a credential or match an extra glob
+func (r *Redactor) sensitivePath(parts []string) bool {
+	for _, glob := range r.globs {
+		if matchPolicyPath(glob, parts) {
+			return true
+		}
+	}
+	return sensitiveKey(parts)
+}
+
+// maskable reports whether a value can hold a credential. Booleans, nulls and empty values can't
+func maskable(value interface{}) bool {
+	switch v := value.(type) {
+	case nil, bool:
+		return false
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+// splitFlatPath splits a flattened path into its keys
+func splitFlatPath(flatPath string) []string {
+	parts := strings.Split(flatPath, pathSeparator)
+	for i, part := range parts {
+		parts[i] = unescapeKeyDots(part)
+	}
+	return parts
+}
+
+// Result returns a copy of a classification with its sensitive values masked
+func (r *Redactor) Result(result *ClassificationResult) *ClassificationResult {
+	if r == nil || result == nil {
+		return result
+	}
+
+	redacted := *result
+	redacted.Entries = make([]ClassifiedValue, len(result.Entries))
+	for i, entry := range result.Entries {
+		entry.UserValue = r.Value(entry.Path, entry.UserValue)
+		entry.DefaultValue = r.Value(entry.Path, entry.DefaultValue)
+		redacted.Entries[i] = entry
+	}
+	return &redacted
+}
+
+// Changes returns a copy of changes with their sensitive values masked
+func (r *Redactor) Changes(changes []ValueChange) []ValueChange {
+	if r == nil || changes == nil {
+		return changes
+	}
+
+	redacted := make([]ValueChange, len(changes))
+	for i, change := range changes {
+		change.OldValue = r.Value(change.Path, change.OldValue)
+		change.NewValue = r.Value(change.Path, change.NewValue)
+		redacted[i] = change
+	}
+	return redacted
+}
+
+// Conflicts returns a copy of conflicts with their sensitive values masked
+func (r *Redactor) Conflicts(conflicts []Conflict) []Conflict {
+	if r == nil || conflicts == nil {
+		return conflicts
+	}
+
+	redacted := make([]Conflict, len(conflicts))
+	for i, conflict := range conflicts {
+		conflict.UserValue = r.Value(conflict.Path, conflict.UserValue)
+		conflict.OldDefault = r.Value(conflict.Path, conflict.OldDefault)
+		conflict.NewDefault = r.Value(conflict.Path, conflict.NewDefault)
+		redacted[i] = conflict
+	}
+	return redacted
+}
+
+// PolicyReport returns a copy of a policy report with its sensitive values masked
+func (r *Redactor) PolicyReport(report *PolicyReport) *PolicyReport {
+	if r == nil || report == nil {
+		return report
+	}
+
+	return &PolicyReport{
+		Pinned:         r.Changes(report.Pinned),
+		ForcedUpdates:  r.Changes(report.ForcedUpdates),
+		ReviewRequired: r.Changes(report.ReviewRequired),
+	}
+}
+
+// sensitiveKey reports whether a path's keys name a credential. Any key can name one, as in
+// auth.password or secrets.db.user, and a last key ending in "key" does, as in tls.key or apiKey.
+// Plurals such as auth.passwords count too. Keys that refer to a credential stored elsewhere,
+// such as auth.existingSecret, and the keys below them, as in secretKeyRef.key, don't
+func sensitiveKey(parts []string) bool {
+	for _, part := range parts {
+		words := keyWords(part)
+		if len(words) > 0 && (words[0] == "existing" || referenceWords[words[len(words)-1]]) {
+			return false
+		}
+	}
+
+	leaf := keyWords(parts[len(parts)-1])
+	if len(leaf) == 0 {
+		return false
+	}
+	if last := singular(leaf[len(leaf)-1]); last == "key" {
+		return true
+	}
+
+	for _, part := range parts {
+		for _, word := range keyWords(part) {
+			if sensitiveWords[singular(word)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// singular strips the plural "s" from a word of a key name, so passwords reads as password
+func singular(word string) string {
+	if len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") {
+		return strings.TrimSuffix(word, "s")
+	}
+	return word
+}
+
+// keyWords splits a key name into its lowercase words at camelCase boundaries and separators,
+// so "existingSecretName" and "existing_secret-name" both give existing, secret, name
+func keyWords(key string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(key)
+	for i, c := range runes {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			if len(word) > 0 {
+				words = append(words, strings.ToLower(string(word)))
+				word = nil
+			}
+			continue
+		}
+
+		// Start a word at "aB", and before the last capital of an acronym in "APIKey"
+		if unicode.IsUpper(c) && len(word) > 0 {
+			previousLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if previousLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				words = append(words, strings.ToLower(string(word)))
+				word = nil
+			}
+		}
+		word = append(word, c)
+	}
+	if len(word) > 0 {
+		words = append(words, strings.ToLower(string(word)))
+	}
+	return words
+}
+
+// looksEncoded reports whether a string looks like a PEM block or a long base64 blob, such as
+// an encoded key or certificate. Hex digests are not treated as blobs
+func looksEncoded(s string) bool {
+	if strings.Contains(s, "-----BEGIN ") {
+		return true
+	}
+	if len(s) < minBlobLength {
+		return false
+	}
+
+	var upper, lower, digit bool
+	for _, c := range s {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		case c == '+' || c == '/' || c == '-' || c == '_' || c == '=':
+		default:
+			return false
+		}
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+
+	trimmed := strings.TrimRight(s, "=")
+	for _, encoding := range []*base64.Encoding{base64.RawStdEncoding, base64.RawURLEncoding} {
+		if _, err := encoding.DecodeString(trimmed); err == nil {
+			return true
+		}
+	}
+	return false
+}
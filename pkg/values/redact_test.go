@@ -0,0 +1,207 @@
+package values
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactor_Sensitive(t *testing.T) {
+	redactor, err := NewRedactor([]string{"license", "**.webhookUrl"})
+	if err != nil {
+		t.Fatalf("NewRedactor() error = %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		value interface{}
+		want  bool
+	}{
+		{"auth::password", "hunter2", true},
+		{"auth::postgresPassword", "hunter2", true},
+		{"auth::password", 123456, true},
+		{"redis::auth::token", "abc", true},
+		{"smtp::apiKey", "abc", true},
+		{"tls::key", "abc", true},
+		{"aws::secretAccessKey", "abc", true},
+		{"credentials::username", "admin", true},
+		{"license", "ABC-123", true},
+		{"license::owner", "acme", true},
+		{"alerts::slack::webhookUrl", "https://hooks.example.com/x", true},
+		{"auth::existingSecret", "db-credentials", false},
+		{"tls::secretName", "tls-cert", false},
+		{"auth::passwordFile", "/run/secrets/password", false},
+		{"auth::usePasswordFiles", true, false},
+		{"auth::password", "", false},
+		{"auth::password", nil, false},
+		{"replicaCount", 3, false},
+		{"image::tag", "1.0", false},
+		{"monkey", "banana", false},
+		{"ca", "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n", true},
+		{"config::blob", "dGhpcyBpcyBhIHZlcnkgbG9uZyBiYXNlNjQgZW5jb2RlZCBzdHJpbmc=", true},
+		{"image::digest", "0123456789abcdef0123456789abcdef01234567", false},
+		{"image::repository", "registry.example.com/team/application-server-image", false},
+		{"auth::passwords", []interface{}{"a", "b"}, true},
+		{"redis::secrets::db", "abc", true},
+		{"api::tokens", []interface{}{"abc"}, true},
+		{"tls::keys", "abc", true},
+		{"env", []interface{}{map[string]interface{}{"name": "DB_PASSWORD", "value": "hunter2"}}, true},
+		{"env", []interface{}{map[string]interface{}{"name": "LOG_LEVEL", "value": "debug"}}, false},
+		{"env", []interface{}{map[string]interface{}{"name": "DB_PASSWORD", "valueFrom": map[string]interface{}{"secretKeyRef": map[string]interface{}{"name": "db", "key": "password"}}}}, false},
+		{"sidecars", []interface{}{map[string]interface{}{"name": "proxy", "token": "abc"}}, true},
+		{"ingress::hosts", []interface{}{"example.com"}, false},
+		{"auth::passwords", []interface{}{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := redactor.Sensitive(tt.path, tt.value); got != tt.want {
+				t.Errorf("Sensitive(%q, %v) = %v, want %v", tt.path, tt.value, got, tt.want)
+			}
+		})
+	}
+
+	var none *Redactor
+	if none.Sensitive("auth::password", "hunter2") {
+		t.Error("expected a nil redactor to mask nothing")
+	}
+}
+
+func TestRedactor_Value_Lists(t *testing.T) {
+	env := []interface{}{
+		map[string]interface{}{"name": "DB_PASSWORD", "value": "hunter2"},
+		map[string]interface{}{"name": "LOG_LEVEL", "value": "debug"},
+	}
+
+	got := builtinRedactor.Value("env", env)
+	want := []interface{}{
+		map[string]interface{}{"name": "DB_PASSWORD", "value": RedactedValue},
+		map[string]interface{}{"name": "LOG_LEVEL", "value": "debug"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Value() = %v, want %v", got, want)
+	}
+	if env[0].(map[string]interface{})["value"] != "hunter2" {
+		t.Error("expected the original list to be left unmasked")
+	}
+
+	if got := builtinRedactor.Value("auth::passwords", []interface{}{"a", "b"}); got != RedactedValue {
+		t.Errorf("expected a list of passwords to be masked, got %v", got)
+	}
+}
+
+func TestKeyWords(t *testing.T) {
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"password", []string{"password"}},
+		{"existingSecretName", []string{"existing", "secret", "name"}},
+		{"existing_secret-name", []string{"existing", "secret", "name"}},
+		{"APIKey", []string{"api", "key"}},
+		{"tls.key", []string{"tls", "key"}},
+		{"s3AccessKey", []string{"s3", "access", "key"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := keyWords(tt.key); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keyWords(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactor_Result(t *testing.T) {
+	result := Classify(
+		Values{"auth::password": "hunter2", "replicaCount": 3},
+		Values{"auth::password": "", "replicaCount": 1},
+	)
+
+	redacted := builtinRedactor.Result(result)
+	for _, entry := range redacted.Entries {
+		switch entry.Path {
+		case "auth::password":
+			if entry.UserValue != RedactedValue || entry.DefaultValue != "" {
+				t.Errorf("unexpected redacted entry %+v", entry)
+			}
+		case "replicaCount":
+			if entry.UserValue != 3 {
+				t.Errorf("expected replicaCount to be kept, got %v", entry.UserValue)
+			}
+		}
+	}
+	if redacted.Customized != 2 {
+		t.Errorf("expected counts to be kept, got %+v", redacted)
+	}
+
+	for _, entry := range result.Entries {
+		if entry.Path == "auth::password" && entry.UserValue != "hunter2" {
+			t.Error("expected the original classification to be left unmasked")
+		}
+	}
+}
+
+func TestNewRedactor_InvalidGlob(t *testing.T) {
+	if _, err := NewRedactor([]string{"auth.[password"}); err == nil {
+		t.Error("expected error for an invalid glob")
+	}
+}
+
+func TestRedactor_YAML(t *testing.T) {
+	content := `# Database settings
+auth:
+  username: app
+  password: hunter2 # rotate yearly
+  existingSecret: ""
+env:
+  - name: DB_PASSWORD
+    value: hunter2
+  - name: LOG_LEVEL
+    value: debug
+tokens: &tokens
+  - abc
+  - def
+copy: *tokens
+replicaCount: 3
+`
+	want := `# Database settings
+auth:
+  username: app
+  password: <redacted> # rotate yearly
+  existingSecret: ""
+env:
+  - name: DB_PASSWORD
+    value: <redacted>
+  - name: LOG_LEVEL
+    value: debug
+tokens: &tokens <redacted>
+copy: *tokens
+replicaCount: 3
+`
+
+	got, err := builtinRedactor.YAML(content)
+	if err != nil {
+		t.Fatalf("YAML() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("YAML() =\n%s\nwant\n%s", got, want)
+	}
+
+	var none *Redactor
+	if got, _ := none.YAML(content); got != content {
+		t.Error("expected a nil redactor to leave the document as it is")
+	}
+}
+
+func TestRedactor_CommentedYAML(t *testing.T) {
+	block := "\n# Keys removed in the target chart version (kept for reference):\n# legacy:\n#   password: hunter2\n#   port: 5432\n"
+	want := "\n# Keys removed in the target chart version (kept for reference):\n# legacy:\n#   password: <redacted>\n#   port: 5432\n"
+
+	got, err := builtinRedactor.CommentedYAML(block)
+	if err != nil {
+		t.Fatalf("CommentedYAML() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("CommentedYAML() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,89 @@
+package values
+
+import (
+	"sort"
+	"strings"
+)
+
+// SecretMigration describes a hardcoded credential that can move to a Secret, because the new
+// defaults add a key next to it that refers to an existing Secret
+type SecretMigration struct {
+	Path      string // Key holding the hardcoded credential, such as auth::password
+	SecretKey string // Key introduced by the new defaults, such as auth::existingSecret
+}
+
+// DetectSecretMigrations finds the credentials the user hardcodes where the new defaults introduce
+// an existingSecret-style sibling key that the user doesn't set yet, sorted by path
+func DetectSecretMigrations(userValues, oldDefaults, newDefaults Values) []SecretMigration {
+	// Secret references new in the target chart, by the path of their parent
+	references := make(map[string]string)
+	for path := range newDefaults {
+		if _, existed := oldDefaults[path]; existed || KeyExists(path, oldDefaults) {
+			continue
+		}
+		parent, leaf := splitLeaf(path)
+		if !secretReferenceKey(leaf) {
+			continue
+		}
+		// Prefer the shortest key, so existingSecret wins over existingSecretPasswordKey
+		if current, found := references[parent]; !found || len(path) < len(current) {
+			references[parent] = path
+		}
+	}
+	if len(references) == 0 {
+		return nil
+	}
+
+	var migrations []SecretMigration
+	for path, userVal := range userValues {
+		if userVal == nil || userVal == "" {
+			continue
+		}
+		if _, isBool := userVal.(bool); isBool {
+			continue
+		}
+
+		parent, leaf := splitLeaf(path)
+		secretKey, found := references[parent]
+		if !found || !sensitiveKey([]string{unescapeKeyDots(leaf)}) {
+			continue
+		}
+		if ValuesEqual(userVal, oldDefaults[path]) {
+			continue
+		}
+		if ref := userValues[secretKey]; ref != nil && ref != "" {
+			continue
+		}
+
+		migrations = append(migrations, SecretMigration{Path: path, SecretKey: secretKey})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Path < migrations[j].Path
+	})
+	return migrations
+}
+
+// secretReferenceKey reports whether a key names an existing Secret to read credentials from,
+// such as existingSecret or existingSecretName
+func secretReferenceKey(key string) bool {
+	words := keyWords(unescapeKeyDots(key))
+	if len(words) < 2 || words[0] != "existing" {
+		return false
+	}
+	for _, word := range words[1:] {
+		if word == "secret" {
+			return true
+		}
+	}
+	return false
+}
+
+// splitLeaf splits a flattened path into the path of its parent and its last key
+func splitLeaf(path string) (string, string) {
+	i := strings.LastIndex(path, pathSeparator)
+	if i < 0 {
+		return "", path
+	}
+	return path[:i], path[i+len(pathSeparator):]
+}
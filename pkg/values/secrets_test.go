@@ -0,0 +1,107 @@
+package values
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectSecretMigrations(t *testing.T) {
+	oldDefaults := Values{
+		"auth::password":         "",
+		"auth::username":         "app",
+		"metrics::token":         "",
+		"metrics::existingToken": "",
+		"redis::password":        "",
+		"redis::existingSecret":  "",
+		"smtp::password":         "",
+	}
+	newDefaults := Values{
+		"auth::password":                  "",
+		"auth::username":                  "app",
+		"auth::existingSecret":            "",
+		"auth::existingSecretPasswordKey": "password",
+		"metrics::token":                  "",
+		"metrics::existingToken":          "",
+		"redis::password":                 "",
+		"redis::existingSecret":           "",
+		"smtp::password":                  "",
+		"smtp::existingSecretName":        "",
+		"ldap::bindPassword":              "",
+		"ldap::existingSecret":            "",
+	}
+
+	tests := []struct {
+		name       string
+		userValues Values
+		want       []SecretMigration
+	}{
+		{
+			name:       "hardcoded password next to new existingSecret",
+			userValues: Values{"auth::password": "hunter2", "auth::username": "admin"},
+			want:       []SecretMigration{{Path: "auth::password", SecretKey: "auth::existingSecret"}},
+		},
+		{
+			name:       "existingSecretName variant",
+			userValues: Values{"smtp::password": "hunter2"},
+			want:       []SecretMigration{{Path: "smtp::password", SecretKey: "smtp::existingSecretName"}},
+		},
+		{
+			name:       "existingSecret already in old defaults",
+			userValues: Values{"redis::password": "hunter2"},
+		},
+		{
+			name:       "existingSecret already set",
+			userValues: Values{"auth::password": "hunter2", "auth::existingSecret": "db-credentials"},
+		},
+		{
+			name:       "password left at its default",
+			userValues: Values{"auth::password": ""},
+		},
+		{
+			name:       "non-credential sibling",
+			userValues: Values{"auth::username": "admin"},
+		},
+		{
+			name:       "reference without secret",
+			userValues: Values{"metrics::token": "abc"},
+		},
+		{
+			name:       "key new in target chart",
+			userValues: Values{"ldap::bindPassword": "hunter2"},
+			want:       []SecretMigration{{Path: "ldap::bindPassword", SecretKey: "ldap::existingSecret"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DetectSecretMigrations(tt.userValues, oldDefaults, newDefaults)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DetectSecretMigrations() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretReferenceKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"existingSecret", true},
+		{"existingSecretName", true},
+		{"existing_secret", true},
+		{"existingSecretPasswordKey", true},
+		{"secretName", false},
+		{"existingClaim", false},
+		{"existing", false},
+		{"password", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := secretReferenceKey(tt.key); got != tt.want {
+				t.Errorf("secretReferenceKey(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
@@ -18,14 +18,40 @@ const (
 	Customized    Classification = "CUSTOMIZED"     // Value differs from default (user change)
 	CopiedDefault Classification = "COPIED_DEFAULT" // Value matches default
 	Unknown       Classification = "UNKNOWN"        // Not in chart defaults (may be obsolete or custom)
+
+	RemovedInTarget Classification = "REMOVED_IN_TARGET" // In old defaults but dropped from the target chart
+	Deletion        Classification = "DELETION"          // Set to null to delete a chart default
 )
 
+// RemovedKeyAction controls how user keys removed in the target chart are written to the upgraded file
+type RemovedKeyAction string
+
+const (
+	RemovedKeep    RemovedKeyAction = "keep"    // Carry customized keys into the upgraded file
+	RemovedDrop    RemovedKeyAction = "drop"    // Leave removed keys out of the upgraded file
+	RemovedComment RemovedKeyAction = "comment" // Write removed keys as a commented-out block
+)
+
+// ParseRemovedKeyAction validates a removed key action name
+func ParseRemovedKeyAction(name string) (RemovedKeyAction, error) {
+	switch action := RemovedKeyAction(name); action {
+	case RemovedKeep, RemovedDrop, RemovedComment:
+		return action, nil
+	case "":
+		return RemovedKeep, nil
+	default:
+		return "", fmt.Errorf("invalid removed keys action %q (must be keep, drop or comment)", name)
+	}
+}
+
 // ClassifiedValue holds a value and its classification
 type ClassifiedValue struct {
 	Path           string      // Dot-separated path (e.g., "image.repository")
 	UserValue      interface{} // Value from user's values file
 	DefaultValue   interface{} // Value from chart defaults (nil if Unknown)
 	Classification Classification
+	Source         string       // Values file that set the key, when several files are layered
+	Policy         PolicyAction // Action of the policy rule matching the key, if any
 }
 
 // ClassificationResult holds the complete classification results
@@ -34,7 +60,10 @@ type ClassificationResult struct {
 	Customized    int
 	CopiedDefault int
 	Unknown       int
+	Removed       int
+	Deletions     int
 	Total         int
+	Ignored       int // Keys left out of the classification by an ignore policy
 }
 
 // Values represents a parsed values file as a flat key-value map
@@ -58,6 +87,17 @@ func ParseFile(path string) (Values, error) {
 	return ParseYAML(string(content))
 }
 
+// FromMap flattens values decoded outside this package, such as Helm release values stored
+// as JSON. Scalars are normalized through a YAML round trip so they compare equal to values
+// parsed from chart defaults (e.g. JSON's float64 3 becomes int 3)
+func FromMap(data map[string]interface{}) (Values, error) {
+	content, err := yaml.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal values: %w", err)
+	}
+	return ParseYAML(string(content))
+}
+
 // pathSeparator is used to separate path components in flattened keys
 const pathSeparator = "::"
 
@@ -167,7 +207,13 @@ func Classify(userValues, defaultValues Values) *ClassificationResult {
 			UserValue: userVal,
 		}
 
-		if defaultVal, exists := defaultValues[path]; exists {
+		if isDeletion(path, userVal, defaultValues) {
+			// Helm deletes a key set to null, so this overrides whatever the chart sets there
+			entry.DefaultValue = defaultValues[path]
+			entry.Classification = Deletion
+			result.Deletions++
+			slog.Debug("deletion", "path", path)
+		} else if defaultVal, exists := defaultValues[path]; exists {
 			// Exact path exists in defaults
 			entry.DefaultValue = defaultVal
 			if ValuesEqual(userVal, defaultVal) {
@@ -179,8 +225,8 @@ func Classify(userValues, defaultValues Values) *ClassificationResult {
 				result.Customized++
 				slog.Debug("customized value",
 					"path", path,
-					"userValue", FormatValue(userVal),
-					"defaultValue", FormatValue(defaultVal),
+					"userValue", FormatValue(builtinRedactor.Value(path, userVal)),
+					"defaultValue", FormatValue(builtinRedactor.Value(path, defaultVal)),
 				)
 			}
 		} else {
@@ -192,7 +238,7 @@ func Classify(userValues, defaultValues Values) *ClassificationResult {
 				parentEmptyMapMatches++
 				slog.Debug("customized value (parent was empty map)",
 					"path", path,
-					"userValue", FormatValue(userVal),
+					"userValue", FormatValue(builtinRedactor.Value(path, userVal)),
 					"parentPath", parentDefault,
 				)
 			} else if parentWithChildren := findParentWithChildren(path, defaultValues); parentWithChildren != "" {
@@ -202,7 +248,7 @@ func Classify(userValues, defaultValues Values) *ClassificationResult {
 				result.Customized++
 				slog.Debug("customized value (parent has children with different keys)",
 					"path", path,
-					"userValue", FormatValue(userVal),
+					"userValue", FormatValue(builtinRedactor.Value(path, userVal)),
 					"parentPath", parentWithChildren,
 				)
 			} else {
@@ -210,7 +256,7 @@ func Classify(userValues, defaultValues Values) *ClassificationResult {
 				result.Unknown++
 				slog.Debug("unknown value",
 					"path", path,
-					"userValue", FormatValue(userVal),
+					"userValue", FormatValue(builtinRedactor.Value(path, userVal)),
 					"reason", "not in defaults and no parent found",
 				)
 			}
@@ -296,8 +342,10 @@ func ValuesEqual(a, b interface{}) bool {
 	return reflect.DeepEqual(a, b)
 }
 
-// Merge creates an upgraded values file by:
-func Merge(userValues, oldDefaults, newDefaults Values) Values {
+// Merge creates an upgraded values file from the new defaults and the user's customizations.
+// Copied defaults move to the new default unless the policy pins them, and customized keys are
+// kept unless the policy always updates them
+func Merge(userValues, oldDefaults, newDefaults Values, policy *Policy) Values {
 	result := make(Values)
 
 	customizedParents := findCustomizedParentMaps(userValues, oldDefaults)
@@ -310,6 +358,19 @@ func Merge(userValues, oldDefaults, newDefaults Values) Values {
 	}
 
 	for path, userVal := range userValues {
+		if isDeletion(path, userVal, oldDefaults) {
+			// A deletion is only kept while there is still a default to delete
+			if KeyExists(path, newDefaults) {
+				deleteChildren(result, path)
+				result[path] = nil
+			}
+			continue
+		}
+
+		if applyPolicy(result, path, userVal, newDefaults, policy) {
+			continue
+		}
+
 		oldDefault, existsInOld := oldDefaults[path]
 
 		if !existsInOld || !ValuesEqual(userVal, oldDefault) {
@@ -320,18 +381,67 @@ func Merge(userValues, oldDefaults, newDefaults Values) Values {
 	return result
 }
 
+// applyPolicy sets a user key in result as its policy requires and reports whether it did.
+// Keys without a pin, ignore or always-update policy are left to the caller
+func applyPolicy(result Values, path string, userVal interface{}, newDefaults Values, policy *Policy) bool {
+	switch policy.Action(path) {
+	case PolicyPin, PolicyIgnore:
+		result[path] = userVal
+		return true
+	case PolicyAlwaysUpdate:
+		if newDefault, existsInNew := newDefaults[path]; existsInNew {
+			result[path] = newDefault
+			return true
+		}
+	}
+	return false
+}
+
+// isDeletion reports whether a user value is a null that deletes a key, rather than a copy of a
+// chart default that is itself null
+func isDeletion(path string, userVal interface{}, defaults Values) bool {
+	if userVal != nil {
+		return false
+	}
+	defaultVal, exists := defaults[path]
+	return !exists || defaultVal != nil
+}
+
+// KeyExists reports whether defaults set path, either directly or as a map with keys below it
+func KeyExists(path string, defaults Values) bool {
+	if _, exists := defaults[path]; exists {
+		return true
+	}
+	return hasChildren(defaults, path+pathSeparator)
+}
+
+// deleteChildren removes every key nested below path
+func deleteChildren(v Values, path string) {
+	prefix := path + pathSeparator
+	for existing := range v {
+		if strings.HasPrefix(existing, prefix) {
+			delete(v, existing)
+		}
+	}
+}
+
 // findCustomizedParentMaps finds parent paths where the user has customized children
 // with different keys than the old defaults. This indicates the user wants to replace
 // the entire map, not merge with it.
 func findCustomizedParentMaps(userValues, oldDefaults Values) map[string]bool {
 	customizedParents := make(map[string]bool)
 
-	for userPath := range userValues {
+	for userPath, userVal := range userValues {
 		// Skip if exact path exists in old defaults
 		if _, exists := oldDefaults[userPath]; exists {
 			continue
 		}
 
+		// Deleting a key doesn't replace its parent map
+		if userVal == nil {
+			continue
+		}
+
 		// Get the immediate parent (one level up)
 		parts := strings.Split(userPath, pathSeparator)
 		if len(parts) < 2 {
@@ -390,6 +500,28 @@ func (v Values) GetPaths() []string {
 	return paths
 }
 
+// Subtree returns the values under a top-level key, with the key removed from their paths
+func (v Values) Subtree(key string) Values {
+	prefix := escapeKeyDots(key) + pathSeparator
+	result := make(Values)
+	for path, value := range v {
+		if rest, ok := strings.CutPrefix(path, prefix); ok {
+			result[rest] = value
+		}
+	}
+	return result
+}
+
+// Nest returns the values moved under a top-level key, the inverse of Subtree
+func (v Values) Nest(key string) Values {
+	prefix := escapeKeyDots(key) + pathSeparator
+	result := make(Values, len(v))
+	for path, value := range v {
+		result[prefix+path] = value
+	}
+	return result
+}
+
 // PathToDisplayFormat converts an internal path (using "::" separator) to
 func PathToDisplayFormat(path string) string {
 	return strings.ReplaceAll(path, pathSeparator, ".")
@@ -1,6 +1,7 @@
 package values
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -252,7 +253,7 @@ func TestMerge_BasicMerge(t *testing.T) {
 		"key3": "old3",    // matches old default - should be updated
 	}
 
-	result := Merge(userValues, oldDefaults, newDefaults)
+	result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 	// Customized value should be preserved
 	if result["key1"] != "custom1" {
@@ -287,7 +288,7 @@ func TestMerge_PreservesUnknownKeys(t *testing.T) {
 		"unknown": "userValue",  // not in any defaults
 	}
 
-	result := Merge(userValues, oldDefaults, newDefaults)
+	result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 	// Unknown keys should be preserved (they might be custom additions)
 	if result["unknown"] != "userValue" {
@@ -423,7 +424,7 @@ func TestMerge_CopiedDefaultsGetUpdated(t *testing.T) {
 		"replicaCount":      1, // matches old default - should update
 	}
 
-	result := Merge(userValues, oldDefaults, newDefaults)
+	result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 	if result["image::tag"] != "16.0.0" {
 		t.Errorf("expected image.tag to be updated to 16.0.0, got %v", result["image::tag"])
@@ -453,7 +454,7 @@ func TestMerge_CustomizedValuesPreserved(t *testing.T) {
 		"memory":       "2Gi",    // customized - should preserve
 	}
 
-	result := Merge(userValues, oldDefaults, newDefaults)
+	result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 	if result["image::tag"] != "15.5.0" {
 		t.Errorf("expected customized image.tag to be preserved as 15.5.0, got %v", result["image::tag"])
@@ -483,7 +484,7 @@ func TestMerge_NewKeysAdded(t *testing.T) {
 		"existingKey": "value",
 	}
 
-	result := Merge(userValues, oldDefaults, newDefaults)
+	result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 	if result["newFeature"] != true {
 		t.Errorf("expected newFeature to be added, got %v", result["newFeature"])
@@ -513,7 +514,7 @@ func TestMerge_RemovedKeysFromDefaults(t *testing.T) {
 		"keptKey":       "value",       // matches old default - should update
 	}
 
-	result := Merge(userValues, oldDefaults, newDefaults)
+	result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 	// Customized deprecated key should be preserved
 	if result["deprecatedKey"] != "customValue" {
@@ -541,7 +542,7 @@ func TestMerge_UnknownUserKeysPreserved(t *testing.T) {
 		"another::custom": "anotherVal", // not in defaults - should preserve
 	}
 
-	result := Merge(userValues, oldDefaults, newDefaults)
+	result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 	if result["customAddition"] != "userValue" {
 		t.Errorf("expected customAddition to be preserved, got %v", result["customAddition"])
@@ -570,7 +571,7 @@ func TestMerge_EmptyMapHandling(t *testing.T) {
 		"resources::limits::memory": "1Gi",
 	}
 
-	result := Merge(userValues, oldDefaults, newDefaults)
+	result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 	// User additions to empty maps should be preserved
 	if result["nodeSelector::tier"] != "database" {
@@ -602,7 +603,7 @@ func TestMerge_ArrayValuesHandling(t *testing.T) {
 		"env": []interface{}{map[string]interface{}{"name": "FOO", "value": "bar"}}, // matches old default
 	}
 
-	result := Merge(userValues, oldDefaults, newDefaults)
+	result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 	// Customized tolerations should be preserved
 	tols, ok := result["tolerations"].([]interface{})
@@ -631,7 +632,7 @@ func TestMerge_TypeChanges(t *testing.T) {
 		"config": "simple-string", // matches old default
 	}
 
-	result := Merge(userValues, oldDefaults, newDefaults)
+	result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 	// Should update to new default (type changed)
 	configMap, ok := result["config"].(map[string]interface{})
@@ -658,7 +659,7 @@ func TestMerge_BooleanValues(t *testing.T) {
 		"feature::disabled": true, // matches old default
 	}
 
-	result := Merge(userValues, oldDefaults, newDefaults)
+	result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 	// Customized to true should be preserved
 	if result["feature::enabled"] != true {
@@ -692,7 +693,7 @@ func TestMerge_NumericValues(t *testing.T) {
 		"maxRetries": 10,   // customized - preserve
 	}
 
-	result := Merge(userValues, oldDefaults, newDefaults)
+	result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 	if result["replicas"] != 2 {
 		t.Errorf("expected replicas to be updated to 2, got %v", result["replicas"])
@@ -748,7 +749,7 @@ func TestMerge_MixedScenario(t *testing.T) {
 		"customKey":                            "userValue",          // unknown key
 	}
 
-	result := Merge(userValues, oldDefaults, newDefaults)
+	result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 	// Customized values preserved
 	if result["image::tag"] != "15.5.0" {
@@ -848,7 +849,7 @@ func TestMerge_EmptyInputs(t *testing.T) {
 		newDefaults := Values{"key": "new", "newKey": "value"}
 		userValues := Values{}
 
-		result := Merge(userValues, oldDefaults, newDefaults)
+		result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 		if result["key"] != "new" {
 			t.Errorf("expected key=new, got %v", result["key"])
@@ -863,7 +864,7 @@ func TestMerge_EmptyInputs(t *testing.T) {
 		newDefaults := Values{"key": "new"}
 		userValues := Values{"key": "custom", "userKey": "userVal"}
 
-		result := Merge(userValues, oldDefaults, newDefaults)
+		result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 		// User values are all "customized" since nothing matched old defaults
 		if result["key"] != "custom" {
@@ -879,7 +880,7 @@ func TestMerge_EmptyInputs(t *testing.T) {
 		newDefaults := Values{}
 		userValues := Values{"key": "custom"}
 
-		result := Merge(userValues, oldDefaults, newDefaults)
+		result := Merge(userValues, oldDefaults, newDefaults, nil)
 
 		// Customized value should be preserved
 		if result["key"] != "custom" {
@@ -887,3 +888,134 @@ func TestMerge_EmptyInputs(t *testing.T) {
 		}
 	})
 }
+
+func TestFromMap_NormalizesJSONNumbers(t *testing.T) {
+	// Helm stores release values as JSON, so integers come back as float64
+	data := map[string]interface{}{
+		"replicaCount": float64(3),
+		"ratio":        0.5,
+		"image": map[string]interface{}{
+			"tag": "1.0.0",
+		},
+	}
+
+	v, err := FromMap(data)
+	if err != nil {
+		t.Fatalf("FromMap() error = %v", err)
+	}
+
+	if v["replicaCount"] != 3 {
+		t.Errorf("expected replicaCount=int 3, got %T %v", v["replicaCount"], v["replicaCount"])
+	}
+	if v["ratio"] != 0.5 {
+		t.Errorf("expected ratio=0.5, got %v", v["ratio"])
+	}
+	if v["image::tag"] != "1.0.0" {
+		t.Errorf("expected image::tag=1.0.0, got %v", v["image::tag"])
+	}
+
+	defaults, _ := ParseYAML("replicaCount: 3\n")
+	if !ValuesEqual(v["replicaCount"], defaults["replicaCount"]) {
+		t.Error("expected normalized value to equal the parsed default")
+	}
+}
+
+func TestClassify_Deletion(t *testing.T) {
+	defaults := Values{
+		"resources::limits::cpu": "100m",
+		"podLabels::team":        "core",
+		"nodeSelector":           nil,
+	}
+	userValues := Values{
+		"resources":       nil, // deletes a map default
+		"podLabels::team": nil, // deletes a scalar default
+		"nodeSelector":    nil, // copies a null default
+		"legacy":          nil, // deletes nothing
+	}
+
+	result := Classify(userValues, defaults)
+
+	expected := map[string]Classification{
+		"resources":       Deletion,
+		"podLabels::team": Deletion,
+		"nodeSelector":    CopiedDefault,
+		"legacy":          Deletion,
+	}
+	for _, entry := range result.Entries {
+		if entry.Classification != expected[entry.Path] {
+			t.Errorf("%s classified as %s, want %s", entry.Path, entry.Classification, expected[entry.Path])
+		}
+	}
+	if result.Deletions != 3 || result.CopiedDefault != 1 || result.Customized != 0 {
+		t.Errorf("unexpected counts: %+v", result)
+	}
+}
+
+func TestMerge_Deletions(t *testing.T) {
+	oldDefaults := Values{
+		"resources::limits::cpu":   "100m",
+		"resources::requests::cpu": "50m",
+		"podLabels::team":          "core",
+		"legacySidecar::enabled":   true,
+	}
+	newDefaults := Values{
+		"resources::limits::cpu":   "200m",
+		"resources::requests::cpu": "50m",
+		"podLabels::team":          "core",
+		"podLabels::tier":          "backend",
+	}
+	userValues := Values{
+		"resources::limits": nil, // still exists, kept
+		"podLabels::team":   nil, // still exists, kept
+		"legacySidecar":     nil, // removed in target, dropped
+	}
+
+	result := Merge(userValues, oldDefaults, newDefaults, nil)
+
+	if value, exists := result["resources::limits"]; !exists || value != nil {
+		t.Errorf("expected resources.limits deletion to be kept, got %v (exists=%v)", value, exists)
+	}
+	if _, exists := result["resources::limits::cpu"]; exists {
+		t.Error("expected defaults below a deletion to be removed")
+	}
+	if result["resources::requests::cpu"] != "50m" {
+		t.Error("expected sibling defaults to be kept")
+	}
+	if value, exists := result["podLabels::team"]; !exists || value != nil {
+		t.Errorf("expected podLabels.team deletion to be kept, got %v", value)
+	}
+	if result["podLabels::tier"] != "backend" {
+		t.Error("expected new sibling default to be added")
+	}
+	if _, exists := result["legacySidecar"]; exists {
+		t.Error("expected deletion of a removed key to be dropped")
+	}
+
+	out, err := result.ToYAML()
+	if err != nil {
+		t.Fatalf("ToYAML() error = %v", err)
+	}
+	if !strings.Contains(out, "limits: null") {
+		t.Errorf("expected null to be written, got:\n%s", out)
+	}
+}
+
+func TestValues_SubtreeAndNest(t *testing.T) {
+	v := Values{
+		"postgresql::auth::username":     "app",
+		"postgresql::primary::resources": map[string]interface{}{},
+		"postgresqlExtra":                true,
+		"redis::enabled":                 false,
+	}
+
+	got := v.Subtree("postgresql")
+	if len(got) != 2 || got["auth::username"] != "app" {
+		t.Errorf("Subtree() = %v", got)
+	}
+	if nested := got.Nest("postgresql"); len(nested) != 2 || nested["postgresql::auth::username"] != "app" {
+		t.Errorf("Nest() = %v", nested)
+	}
+	if len(v.Subtree("missing")) != 0 {
+		t.Error("expected an empty subtree for a missing key")
+	}
+}